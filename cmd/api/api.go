@@ -3,8 +3,29 @@ package api
 import (
 	"database/sql"
 	"log"
+	"time"
 
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/service/command"
+	"github.com/dclouisDan/chat-app-api/service/conversation"
+	"github.com/dclouisDan/chat-app-api/service/digest"
+	"github.com/dclouisDan/chat-app-api/service/draft"
+	"github.com/dclouisDan/chat-app-api/service/eventlog"
+	"github.com/dclouisDan/chat-app-api/service/idempotency"
+	"github.com/dclouisDan/chat-app-api/service/invite"
+	"github.com/dclouisDan/chat-app-api/service/mailer"
+	"github.com/dclouisDan/chat-app-api/service/keys"
+	"github.com/dclouisDan/chat-app-api/service/message"
+	"github.com/dclouisDan/chat-app-api/service/moderation"
+	"github.com/dclouisDan/chat-app-api/service/notification"
+	"github.com/dclouisDan/chat-app-api/service/pubsub"
+	"github.com/dclouisDan/chat-app-api/service/ratelimit"
+	"github.com/dclouisDan/chat-app-api/service/realtime"
+	"github.com/dclouisDan/chat-app-api/service/report"
 	"github.com/dclouisDan/chat-app-api/service/user"
+	"github.com/dclouisDan/chat-app-api/service/webhook"
+	"github.com/dclouisDan/chat-app-api/types"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 )
@@ -22,17 +43,177 @@ func (s *APIServer) Run() error {
 	app := fiber.New()
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
-		AllowMethods: "POST,PUT,DELETE,GET,OPTIONS",
-		AllowHeaders: "Origin, Accept, Content-Type, Authorization",
+		AllowMethods: "POST,PUT,PATCH,DELETE,GET,OPTIONS",
+		AllowHeaders: "Origin, Accept, Content-Type, Authorization, X-Device-ID, Idempotency-Key",
 	}))
 
   api := app.Group("/chat-app-api/v1")
   api.Static("/", "./web/static")
 
+	limits, err := newRateLimitStore()
+	if err != nil {
+		return err
+	}
+	defer limits.Close()
+
+	// mounted ahead of the routes they limit
+	messageLimiter := ratelimit.NewLimiter(limits, "messages", int(config.Envs.MessageRateLimit))
+	api.Post("/login", ratelimit.New(ratelimit.NewLimiter(limits, "login", int(config.Envs.LoginRateLimit)), ratelimit.ByIP))
+	api.Post("/register", ratelimit.New(ratelimit.NewLimiter(limits, "register", int(config.Envs.RegisterRateLimit)), ratelimit.ByIP))
+	// each one sends an email, limited as registrations are
+	api.Post("/auth/verify-email/resend", ratelimit.New(ratelimit.NewLimiter(limits, "verify-email", int(config.Envs.RegisterRateLimit)), ratelimit.ByIP))
+	api.Post("/auth/forgot-password", ratelimit.New(ratelimit.NewLimiter(limits, "forgot-password", int(config.Envs.RegisterRateLimit)), ratelimit.ByIP))
+	// tokens are guessed as passwords are
+	api.Post("/auth/reset-password", ratelimit.New(ratelimit.NewLimiter(limits, "reset-password", int(config.Envs.LoginRateLimit)), ratelimit.ByIP))
+	api.Post("/conversations/:id/messages", ratelimit.New(messageLimiter, ratelimit.ByUser))
+	api.Post("/conversations/:id/polls", ratelimit.New(messageLimiter, ratelimit.ByUser))
+
 	userStore := user.NewStore(s.db)
-	userHandler := user.NewHandler(userStore)
+
+	// signed out tokens are refused until they expire
+	revocations := auth.NewRevocations(userStore, 30*time.Second)
+	auth.UseRevocations(revocations)
+	go revocations.Prune(time.Hour, nil)
+
+	// tokens of signed out devices are refused as well
+	sessions := auth.NewSessions(userStore, time.Minute)
+	auth.UseSessions(sessions)
+	go sessions.Prune(time.Hour, time.Second*time.Duration(config.Envs.RefreshTokenExpInSeconds), nil)
+
+	// emails are only logged without a relay, enough for development
+	var mail types.Mailer = mailer.NewLog()
+	if config.Envs.SMTPHost != "" {
+		smtp, err := mailer.NewSMTP(config.Envs.SMTPHost, config.Envs.SMTPPort, config.Envs.SMTPUsername, config.Envs.SMTPPassword, config.Envs.MailFrom)
+		if err != nil {
+			return err
+		}
+		mail = smtp
+	}
+
+	userHandler := user.NewHandler(userStore, userStore, userStore, userStore, userStore, userStore, revocations, sessions, mail)
 	userHandler.RegisterRoutes(api)
+	go user.CleanupPasswordResetTokens(userStore, time.Hour, nil)
+
+	ps, err := newPubSub()
+	if err != nil {
+		return err
+	}
+	defer ps.Close()
+
+	hub := realtime.NewHub()
+	go hub.EvictHistories(time.Minute, nil)
+	relay, err := realtime.NewRelay(hub, ps)
+	if err != nil {
+		return err
+	}
+
+	// who is connected to any instance, announced through the backplane
+	presence, err := realtime.NewPresence(hub, ps, time.Minute)
+	if err != nil {
+		return err
+	}
+	go presence.Announce(20*time.Second, nil)
+
+	// changes clients have to catch up on are logged before being relayed
+	eventStore := eventlog.NewStore(s.db)
+	eventLog := eventlog.NewLog(eventStore, relay)
+	go eventlog.Compact(eventStore, time.Duration(config.Envs.EventLogRetentionInHours)*time.Hour, time.Hour, nil)
+
+	eventHandler := eventlog.NewHandler(eventStore, userStore)
+	eventHandler.RegisterRoutes(api)
+
+	conversationStore := conversation.NewStore(s.db)
+
+	webhookStore := webhook.NewStore(s.db)
+	dispatcher := webhook.NewDispatcher(webhookStore)
+
+	conversationHandler := conversation.NewHandler(conversationStore, userStore, eventLog, dispatcher)
+	conversationHandler.RegisterRoutes(api)
+
+	keyStore := keys.NewStore(s.db)
+	keyHandler := keys.NewHandler(keyStore, conversationStore, userStore)
+	keyHandler.RegisterRoutes(api)
+
+	inviteStore := invite.NewStore(s.db)
+	inviteHandler := invite.NewHandler(inviteStore, conversationStore, userStore, eventLog, dispatcher)
+	inviteHandler.RegisterRoutes(api)
+
+	draftStore := draft.NewStore(s.db)
+	draftHandler := draft.NewHandler(draftStore, conversationStore, userStore, relay)
+	draftHandler.RegisterRoutes(api)
+
+	commandStore := command.NewStore(s.db)
+	commandRegistry := command.NewRegistry(commandStore)
+	commandHandler := command.NewHandler(commandStore, commandRegistry, conversationStore, userStore)
+	commandHandler.RegisterRoutes(api)
+
+	moderationStore := moderation.NewStore(s.db)
+	moderator, err := moderation.LoadPipeline(config.Envs.ModerationConfigFile, moderationStore)
+	if err != nil {
+		return err
+	}
+	moderationHandler := moderation.NewHandler(moderationStore, conversationStore, userStore)
+	moderationHandler.RegisterRoutes(api)
+
+	// users who are not connected hear of new messages through push
+	pushStore := notification.NewStore(s.db)
+	providers := []types.NotificationProvider{}
+	if config.Envs.VAPIDPublicKey != "" {
+		webPush, err := notification.NewWebPush(pushStore, config.Envs.VAPIDPublicKey, config.Envs.VAPIDPrivateKey, config.Envs.VAPIDSubject)
+		if err != nil {
+			return err
+		}
+		providers = append(providers, webPush)
+	}
+	notifier := notification.NewNotifier(eventLog, conversationStore, userStore, presence, providers...)
+	go notification.Cleanup(pushStore, time.Hour, nil)
+
+	notificationHandler := notification.NewHandler(pushStore, userStore, config.Envs.VAPIDPublicKey)
+	notificationHandler.RegisterRoutes(api)
+
+	// users away for longer are emailed what they missed
+	digestStore := digest.NewStore(s.db)
+	if config.Envs.SMTPHost != "" {
+		go digest.NewScheduler(digestStore, mail, presence, config.Envs.PublicHost).Run(5*time.Minute, nil)
+	}
+
+	digestHandler := digest.NewHandler(digestStore, userStore)
+	digestHandler.RegisterRoutes(api)
+
+	messageStore := message.NewStore(s.db)
+	messageHandler := message.NewHandler(messageStore, messageStore, conversationStore, draftStore, userStore, notifier, dispatcher, commandRegistry, moderator, idempotency.NewStore(s.db))
+	messageHandler.RegisterRoutes(api)
+
+	reportStore := report.NewStore(s.db)
+	reportHandler := report.NewHandler(reportStore, messageStore, conversationStore, userStore, messageHandler, eventLog, userHandler, relay)
+	reportHandler.RegisterRoutes(api)
+
+	realtimeHandler := realtime.NewHandler(hub, relay, messageHandler, messageLimiter, conversationStore, userStore)
+	realtimeHandler.RegisterRoutes(api)
+
+	webhookHandler := webhook.NewHandler(webhookStore, webhookStore, conversationStore, userStore, messageHandler, ratelimit.NewLimiter(limits, "incoming-webhooks", int(config.Envs.IncomingWebhookRateLimit)))
+	webhookHandler.RegisterRoutes(api)
   
 	log.Println("Listening on:", s.addr)
   return app.Listen(s.addr)
 }
+
+// newPubSub picks the backplane relaying real-time events between instances,
+// a single instance does not need one.
+func newPubSub() (types.PubSub, error) {
+	if config.Envs.RedisURL == "" {
+		return pubsub.NewMemory(), nil
+	}
+
+	return pubsub.NewRedis(config.Envs.RedisURL)
+}
+
+// newRateLimitStore keeps the rate limits in the same Redis as the events
+// when there is one, so they hold across instances.
+func newRateLimitStore() (types.RateLimitStore, error) {
+	if config.Envs.RedisURL == "" {
+		return ratelimit.NewMemory(), nil
+	}
+
+	return ratelimit.NewRedis(config.Envs.RedisURL)
+}
@@ -0,0 +1,2 @@
+ALTER TABLE conversations
+  ADD COLUMN `name` VARCHAR(255) DEFAULT NULL AFTER `id`;
@@ -0,0 +1,2 @@
+ALTER TABLE conversation_participants
+  ADD COLUMN `role` ENUM('member', 'admin') NOT NULL DEFAULT 'member' AFTER `user_id`;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS conversation_invites (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `conversation_id` INT UNSIGNED NOT NULL,
+  `created_by` INT UNSIGNED NOT NULL,
+  `code` VARCHAR(64) NOT NULL,
+  `maxUses` INT UNSIGNED DEFAULT NULL,
+  `uses` INT UNSIGNED NOT NULL DEFAULT 0,
+  `requiresApproval` BOOLEAN NOT NULL DEFAULT FALSE,
+  `expiresAt` TIMESTAMP NULL,
+  `revokedAt` TIMESTAMP NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (`code`),
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+  FOREIGN KEY (created_by) REFERENCES users(id)
+)
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS conversation_join_requests (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `conversation_id` INT UNSIGNED NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `invite_id` INT UNSIGNED NOT NULL,
+  `status` ENUM('pending', 'approved', 'rejected') NOT NULL DEFAULT 'pending',
+  `resolved_by` INT UNSIGNED DEFAULT NULL,
+  `resolvedAt` TIMESTAMP NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (invite_id) REFERENCES conversation_invites(id),
+  FOREIGN KEY (resolved_by) REFERENCES users(id)
+)
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS message_attachments (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `message_id` INT NOT NULL,
+  `fileName` VARCHAR(255) NOT NULL,
+  `path` VARCHAR(255) NOT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (message_id) REFERENCES messages(id)
+)
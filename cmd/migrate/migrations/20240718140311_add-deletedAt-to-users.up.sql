@@ -0,0 +1,2 @@
+ALTER TABLE users
+  ADD COLUMN `deletedAt` TIMESTAMP NULL AFTER `createdAt`;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS data_exports (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `status` ENUM('pending', 'completed', 'failed') NOT NULL DEFAULT 'pending',
+  `filePath` VARCHAR(255) DEFAULT NULL,
+  `error` TEXT DEFAULT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `completedAt` TIMESTAMP NULL,
+
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
@@ -0,0 +1,2 @@
+ALTER TABLE messages
+  ADD COLUMN `deletedAt` TIMESTAMP NULL;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS message_drafts (
+  `user_id` INT UNSIGNED NOT NULL,
+  `conversation_id` INT UNSIGNED NOT NULL,
+  `content` TEXT NOT NULL,
+  `updatedAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (user_id, conversation_id),
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id)
+)
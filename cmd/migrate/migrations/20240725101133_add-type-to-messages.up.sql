@@ -0,0 +1,2 @@
+ALTER TABLE messages
+  ADD COLUMN `type` ENUM('text', 'poll') NOT NULL DEFAULT 'text';
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS polls (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `message_id` INT NOT NULL,
+  `question` VARCHAR(500) NOT NULL,
+  `multipleChoice` BOOLEAN NOT NULL DEFAULT FALSE,
+  `anonymous` BOOLEAN NOT NULL DEFAULT FALSE,
+  `closesAt` TIMESTAMP NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (message_id),
+  FOREIGN KEY (message_id) REFERENCES messages(id)
+)
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS poll_options (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `poll_id` INT UNSIGNED NOT NULL,
+  `text` VARCHAR(255) NOT NULL,
+  `position` INT UNSIGNED NOT NULL,
+
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (poll_id) REFERENCES polls(id)
+)
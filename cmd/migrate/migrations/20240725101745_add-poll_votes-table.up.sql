@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS poll_votes (
+  `poll_id` INT UNSIGNED NOT NULL,
+  `option_id` INT UNSIGNED NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (option_id, user_id),
+  KEY (poll_id, user_id),
+  FOREIGN KEY (poll_id) REFERENCES polls(id),
+  FOREIGN KEY (option_id) REFERENCES poll_options(id),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `conversation_id` INT UNSIGNED NOT NULL,
+  `created_by` INT UNSIGNED NOT NULL,
+  `url` VARCHAR(2048) NOT NULL,
+  `secret` VARCHAR(255) NOT NULL,
+  `events` VARCHAR(255) NOT NULL,
+  `active` BOOLEAN NOT NULL DEFAULT TRUE,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+  FOREIGN KEY (created_by) REFERENCES users(id)
+)
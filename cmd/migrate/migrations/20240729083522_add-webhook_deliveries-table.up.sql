@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `webhook_id` INT UNSIGNED NOT NULL,
+  `event` VARCHAR(64) NOT NULL,
+  `payload` MEDIUMTEXT NOT NULL,
+  `status` ENUM('pending', 'succeeded', 'dead') NOT NULL DEFAULT 'pending',
+  `attempts` INT UNSIGNED NOT NULL DEFAULT 0,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updatedAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  KEY (webhook_id, status),
+  FOREIGN KEY (webhook_id) REFERENCES webhooks(id)
+)
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `delivery_id` INT UNSIGNED NOT NULL,
+  `attempt` INT UNSIGNED NOT NULL,
+  `statusCode` INT DEFAULT NULL,
+  `error` TEXT DEFAULT NULL,
+  `durationMs` INT UNSIGNED NOT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries(id)
+)
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS incoming_webhooks (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `conversation_id` INT UNSIGNED NOT NULL,
+  `created_by` INT UNSIGNED NOT NULL,
+  `name` VARCHAR(64) NOT NULL,
+  `avatarUrl` VARCHAR(2048) DEFAULT NULL,
+  `tokenHash` CHAR(64) NOT NULL,
+  `revokedAt` TIMESTAMP NULL DEFAULT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (tokenHash),
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+  FOREIGN KEY (created_by) REFERENCES users(id)
+)
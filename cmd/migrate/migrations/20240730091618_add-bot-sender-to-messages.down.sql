@@ -0,0 +1,5 @@
+ALTER TABLE messages
+  DROP FOREIGN KEY `fk_messages_incoming_webhook`,
+  DROP COLUMN `incoming_webhook_id`,
+  DROP COLUMN `senderName`,
+  DROP COLUMN `senderAvatar`;
@@ -0,0 +1,5 @@
+ALTER TABLE messages
+  ADD COLUMN `incoming_webhook_id` INT UNSIGNED DEFAULT NULL,
+  ADD COLUMN `senderName` VARCHAR(64) DEFAULT NULL,
+  ADD COLUMN `senderAvatar` VARCHAR(2048) DEFAULT NULL,
+  ADD CONSTRAINT `fk_messages_incoming_webhook` FOREIGN KEY (incoming_webhook_id) REFERENCES incoming_webhooks(id);
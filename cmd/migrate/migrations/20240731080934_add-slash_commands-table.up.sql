@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS slash_commands (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `conversation_id` INT UNSIGNED NOT NULL,
+  `created_by` INT UNSIGNED NOT NULL,
+  `name` VARCHAR(32) NOT NULL,
+  `description` VARCHAR(255) NOT NULL DEFAULT '',
+  `url` VARCHAR(2048) NOT NULL,
+  `secret` VARCHAR(255) NOT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (conversation_id, name),
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+  FOREIGN KEY (created_by) REFERENCES users(id)
+)
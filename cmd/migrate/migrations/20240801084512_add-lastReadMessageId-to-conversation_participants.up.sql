@@ -0,0 +1,2 @@
+ALTER TABLE conversation_participants
+  ADD COLUMN `lastReadMessageId` INT UNSIGNED DEFAULT NULL;
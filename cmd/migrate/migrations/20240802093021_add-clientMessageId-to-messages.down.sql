@@ -0,0 +1,3 @@
+ALTER TABLE messages
+  DROP INDEX `uq_messages_sender_client_message`,
+  DROP COLUMN `clientMessageId`;
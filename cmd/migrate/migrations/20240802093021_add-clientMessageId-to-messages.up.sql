@@ -0,0 +1,3 @@
+ALTER TABLE messages
+  ADD COLUMN `clientMessageId` VARCHAR(64) DEFAULT NULL,
+  ADD UNIQUE KEY `uq_messages_sender_client_message` (sender_id, clientMessageId);
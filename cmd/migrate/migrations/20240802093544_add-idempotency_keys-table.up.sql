@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `idempotencyKey` VARCHAR(255) NOT NULL,
+  `fingerprint` CHAR(64) NOT NULL,
+  `statusCode` INT DEFAULT NULL,
+  `body` MEDIUMBLOB DEFAULT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (user_id, idempotencyKey),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS user_event_sequences (
+  `user_id` INT UNSIGNED NOT NULL,
+  `lastSeq` BIGINT UNSIGNED NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (`user_id`),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
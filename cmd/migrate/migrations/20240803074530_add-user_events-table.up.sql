@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS user_events (
+  `id` BIGINT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `seq` BIGINT UNSIGNED NOT NULL,
+  `type` VARCHAR(32) NOT NULL,
+  `payload` JSON NOT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (user_id, seq),
+  INDEX (createdAt),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS device_keys (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `deviceId` VARCHAR(64) NOT NULL,
+  `identityKey` VARCHAR(1024) NOT NULL,
+  `signedPrekeyId` INT UNSIGNED NOT NULL,
+  `signedPrekey` VARCHAR(1024) NOT NULL,
+  `signedPrekeySignature` VARCHAR(1024) NOT NULL,
+  `updatedAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (user_id, deviceId),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
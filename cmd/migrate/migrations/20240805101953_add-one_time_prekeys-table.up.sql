@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS one_time_prekeys (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `deviceId` VARCHAR(64) NOT NULL,
+  `keyId` INT UNSIGNED NOT NULL,
+  `publicKey` VARCHAR(1024) NOT NULL,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (user_id, deviceId, keyId),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
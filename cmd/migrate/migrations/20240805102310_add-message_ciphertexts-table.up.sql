@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS message_ciphertexts (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `message_id` INT NOT NULL,
+  `recipient_id` INT UNSIGNED NOT NULL,
+  `recipientDeviceId` VARCHAR(64) NOT NULL,
+  `ciphertext` MEDIUMTEXT NOT NULL,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (message_id, recipient_id, recipientDeviceId),
+  FOREIGN KEY (message_id) REFERENCES messages(id),
+  FOREIGN KEY (recipient_id) REFERENCES users(id)
+)
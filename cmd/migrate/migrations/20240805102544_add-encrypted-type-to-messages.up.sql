@@ -0,0 +1,2 @@
+ALTER TABLE messages
+  MODIFY COLUMN `type` ENUM('text', 'poll', 'encrypted') NOT NULL DEFAULT 'text';
@@ -0,0 +1,2 @@
+ALTER TABLE messages
+  ADD COLUMN `heldAt` TIMESTAMP NULL DEFAULT NULL;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS moderation_decisions (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `message_id` INT DEFAULT NULL,
+  `conversation_id` INT UNSIGNED NOT NULL,
+  `user_id` INT UNSIGNED DEFAULT NULL,
+  `action` ENUM('allow', 'mask', 'hold', 'reject') NOT NULL,
+  `moderator` VARCHAR(64) NOT NULL,
+  `reason` VARCHAR(255) NOT NULL DEFAULT '',
+  `content` TEXT NOT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  INDEX (conversation_id, createdAt),
+  FOREIGN KEY (message_id) REFERENCES messages(id),
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
@@ -0,0 +1,2 @@
+ALTER TABLE users
+  ADD COLUMN `suspendedAt` TIMESTAMP NULL DEFAULT NULL;
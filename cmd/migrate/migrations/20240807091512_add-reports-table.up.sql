@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS reports (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `reporter_id` INT UNSIGNED NOT NULL,
+  `reported_user_id` INT UNSIGNED DEFAULT NULL,
+  `message_id` INT DEFAULT NULL,
+  `conversation_id` INT UNSIGNED DEFAULT NULL,
+  `reason` VARCHAR(500) NOT NULL,
+  `content` TEXT DEFAULT NULL,
+  `status` ENUM('open', 'resolved') NOT NULL DEFAULT 'open',
+  `action` ENUM('dismiss', 'delete_message', 'suspend_user') DEFAULT NULL,
+  `resolved_by` INT UNSIGNED DEFAULT NULL,
+  `resolvedAt` TIMESTAMP NULL DEFAULT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  INDEX (status, id),
+  FOREIGN KEY (reporter_id) REFERENCES users(id),
+  FOREIGN KEY (reported_user_id) REFERENCES users(id),
+  FOREIGN KEY (message_id) REFERENCES messages(id),
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+  FOREIGN KEY (resolved_by) REFERENCES users(id)
+)
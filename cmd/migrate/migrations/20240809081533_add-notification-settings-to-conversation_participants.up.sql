@@ -0,0 +1,3 @@
+ALTER TABLE conversation_participants
+  ADD COLUMN `notifications` ENUM('all', 'mentions', 'none') NOT NULL DEFAULT 'all',
+  ADD COLUMN `mutedUntil` TIMESTAMP NULL DEFAULT NULL;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `endpoint` VARCHAR(700) NOT NULL,
+  `p256dh` VARCHAR(128) NOT NULL,
+  `auth` VARCHAR(64) NOT NULL,
+  `expiresAt` TIMESTAMP NULL DEFAULT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (endpoint),
+  INDEX (user_id),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
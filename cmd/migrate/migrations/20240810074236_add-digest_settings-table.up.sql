@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS digest_settings (
+  `user_id` INT UNSIGNED NOT NULL,
+  `frequency` ENUM('off', 'hourly', 'daily', 'weekly') NOT NULL DEFAULT 'daily',
+  `lastSentAt` TIMESTAMP NULL DEFAULT NULL,
+
+  PRIMARY KEY (user_id),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
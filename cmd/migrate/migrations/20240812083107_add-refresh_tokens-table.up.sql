@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `familyId` VARCHAR(32) NOT NULL,
+  `tokenHash` CHAR(64) NOT NULL,
+  `expiresAt` TIMESTAMP NOT NULL,
+  `usedAt` TIMESTAMP NULL DEFAULT NULL,
+  `revokedAt` TIMESTAMP NULL DEFAULT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (tokenHash),
+  INDEX (familyId),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
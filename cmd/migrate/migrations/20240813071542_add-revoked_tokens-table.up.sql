@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+  `jti` VARCHAR(32) NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `expiresAt` TIMESTAMP NOT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`jti`),
+  INDEX (expiresAt),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+  `user_id` INT UNSIGNED NOT NULL,
+  `revokedBefore` TIMESTAMP NOT NULL,
+  `expiresAt` TIMESTAMP NOT NULL,
+
+  PRIMARY KEY (user_id),
+  INDEX (expiresAt),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS sessions (
+  `id` VARCHAR(32) NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `deviceName` VARCHAR(100) NOT NULL DEFAULT '',
+  `userAgent` VARCHAR(512) NOT NULL DEFAULT '',
+  `ip` VARCHAR(45) NOT NULL DEFAULT '',
+  `lastActiveAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `revokedAt` TIMESTAMP NULL DEFAULT NULL,
+
+  PRIMARY KEY (`id`),
+  INDEX (lastActiveAt),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
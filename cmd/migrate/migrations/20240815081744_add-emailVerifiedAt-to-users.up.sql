@@ -0,0 +1,2 @@
+ALTER TABLE users
+  ADD COLUMN `emailVerifiedAt` TIMESTAMP NULL DEFAULT NULL;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+  `id` INT UNSIGNED AUTO_INCREMENT NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `tokenHash` CHAR(64) NOT NULL,
+  `expiresAt` TIMESTAMP NOT NULL,
+  `usedAt` TIMESTAMP NULL DEFAULT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (tokenHash),
+  INDEX (expiresAt),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+)
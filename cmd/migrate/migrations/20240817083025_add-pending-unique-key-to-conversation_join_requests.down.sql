@@ -0,0 +1,2 @@
+ALTER TABLE conversation_join_requests
+  DROP COLUMN `pending`;
@@ -0,0 +1,3 @@
+ALTER TABLE conversation_join_requests
+  ADD COLUMN `pending` TINYINT AS (IF(status = 'pending', 1, NULL)) STORED,
+  ADD UNIQUE KEY `uq_pending_join_request` (conversation_id, user_id, pending);
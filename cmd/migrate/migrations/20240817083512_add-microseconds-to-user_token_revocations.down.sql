@@ -0,0 +1,2 @@
+ALTER TABLE user_token_revocations
+  MODIFY COLUMN `revokedBefore` TIMESTAMP NOT NULL;
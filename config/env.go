@@ -10,14 +10,49 @@ import (
 )
 
 type Config struct {
-	PublicHost             string
-	Port                   string
-	DBUser                 string
-	DBPassword             string
-	DBAddress              string
-	DBName                 string
-	JWTExpirationInSeconds int64
-	JWTSecret              string
+	PublicHost               string
+	Port                     string
+	DBUser                   string
+	DBPassword               string
+	DBAddress                string
+	DBName                   string
+	JWTExpirationInSeconds   int64
+	// refresh tokens outlive the access tokens, a client exchanges them for
+	// new ones until the user is away for longer than that
+	RefreshTokenExpInSeconds int64
+	JWTSecret                string
+	ExportsDir               string
+	// messages an incoming webhook may post per minute
+	IncomingWebhookRateLimit int64
+	// events go through Redis when set, so several instances can run side by side
+	RedisURL                 string
+	// how long the events of a user are kept for clients catching up
+	EventLogRetentionInHours int64
+	// JSON file listing the moderators messages go through, none when empty
+	ModerationConfigFile     string
+	// requests allowed per minute, by address for logins and registrations
+	// and by user for messages, 0 turns a limit off
+	LoginRateLimit           int64
+	RegisterRateLimit        int64
+	MessageRateLimit         int64
+	// VAPID key pair of the server as unpadded base64url, Web Push is off
+	// without them. The subject tells push services how to reach the operator
+	VAPIDPublicKey           string
+	VAPIDPrivateKey          string
+	VAPIDSubject             string
+	// emails such as the digests go through this relay, none are sent
+	// without a host
+	SMTPHost                 string
+	SMTPPort                 string
+	SMTPUsername             string
+	SMTPPassword             string
+	MailFrom                 string
+	// "login" keeps users from logging in until they verify their email
+	// address, "messaging" from sending messages, empty lets them do both
+	RequireVerifiedEmail     string
+	// lets webhooks point to loopback, private and link-local addresses,
+	// only meant for development and tests
+	AllowPrivateWebhooks     bool
 }
 
 var Envs = initConfig()
@@ -35,8 +70,27 @@ func initConfig() Config {
     DBPassword: getEnv("DB_PASSWORD", "root"),
     DBAddress: fmt.Sprintf("%s:%s", getEnv("DB_HOST", "127.0.0.1"), getEnv("DB_PORT", "3306")),
     DBName: getEnv("DB_name", "chat_app_api"),
-    JWTExpirationInSeconds: getEnvAsInt("JWT_EXP", 3600*24),
+    JWTExpirationInSeconds: getEnvAsInt("JWT_EXP", 60*15),
+    RefreshTokenExpInSeconds: getEnvAsInt("REFRESH_TOKEN_EXP", 3600*24*30),
     JWTSecret: getEnv("JWT_SECRET","secret-secret-code"),
+    ExportsDir: getEnv("EXPORTS_DIR", "./storage/exports"),
+    IncomingWebhookRateLimit: getEnvAsInt("INCOMING_WEBHOOK_RATE_LIMIT", 30),
+    RedisURL: getEnv("REDIS_URL", ""),
+    EventLogRetentionInHours: getEnvAsInt("EVENT_LOG_RETENTION_HOURS", 24*7),
+    ModerationConfigFile: getEnv("MODERATION_CONFIG", ""),
+    LoginRateLimit: getEnvAsInt("LOGIN_RATE_LIMIT", 10),
+    RegisterRateLimit: getEnvAsInt("REGISTER_RATE_LIMIT", 5),
+    MessageRateLimit: getEnvAsInt("MESSAGE_RATE_LIMIT", 60),
+    VAPIDPublicKey: getEnv("VAPID_PUBLIC_KEY", ""),
+    VAPIDPrivateKey: getEnv("VAPID_PRIVATE_KEY", ""),
+    VAPIDSubject: getEnv("VAPID_SUBJECT", "mailto:admin@localhost"),
+    SMTPHost: getEnv("SMTP_HOST", ""),
+    SMTPPort: getEnv("SMTP_PORT", "587"),
+    SMTPUsername: getEnv("SMTP_USERNAME", ""),
+    SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+    MailFrom: getEnv("MAIL_FROM", "Chat App <no-reply@localhost>"),
+    RequireVerifiedEmail: getEnv("REQUIRE_VERIFIED_EMAIL", ""),
+    AllowPrivateWebhooks: getEnvAsBool("ALLOW_PRIVATE_WEBHOOKS", false),
   }
 }
 
@@ -60,3 +114,15 @@ func getEnvAsInt(key string, fallback int64) int64 {
   return fallback
 }
 
+func getEnvAsBool(key string, fallback bool) bool {
+  if value, ok := os.LookupEnv(key); ok {
+    b, err := strconv.ParseBool(value)
+    if err != nil {
+      return fallback
+    }
+    return b
+  }
+
+  return fallback
+}
+
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Purposes of the tokens sent by email, a token is only accepted for the
+// purpose it was issued for.
+const (
+	PurposeVerifyEmail = "verify-email"
+)
+
+// CreateEmailToken signs a token proving the user received an email. The
+// binding is checked against the current state of the user when the token
+// comes back, e.g. the address a verification email was sent to, so that
+// the token stops working once that state changes.
+func CreateEmailToken(purpose string, userID int, binding string, ttl time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":     strconv.Itoa(userID),
+		"purpose": purpose,
+		"binding": binding,
+		"exp":     time.Now().Add(ttl).Unix(),
+	})
+
+	return token.SignedString([]byte(config.Envs.JWTSecret))
+}
+
+// ParseEmailToken returns the user and the binding of a token issued for
+// the purpose.
+func ParseEmailToken(purpose, tokenString string) (int, string, error) {
+	token, err := validateJWT(tokenString)
+	if err != nil {
+		return 0, "", err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if p, _ := claims["purpose"].(string); !token.Valid || p != purpose {
+		return 0, "", fmt.Errorf("invalid token")
+	}
+
+	sub, err := claims.GetSubject()
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid token")
+	}
+	userID, err := strconv.Atoi(sub)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid token")
+	}
+
+	binding, _ := claims["binding"].(string)
+	return userID, binding, nil
+}
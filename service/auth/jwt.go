@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
 	"strconv"
 	"time"
 
@@ -16,20 +17,56 @@ import (
 
 type contextKey string
 
-const UserKey contextKey = "userID"
+const (
+	UserKey   contextKey = "userID"
+	RoleKey   contextKey = "role"
+	ClaimsKey contextKey = "claims"
+	// EmailVerifiedKey tells whether the user verified their email address
+	EmailVerifiedKey contextKey = "emailVerified"
+)
+
+// Claims are what the server reads back from one of its tokens.
+type Claims struct {
+	UserID int
+	// ID is the jti of the token, tokens issued before it existed have none
+	ID string
+	// SessionID is the login the token was issued for, tokens issued before
+	// sessions existed have none
+	SessionID string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
 
-func CreateJWT(secret []byte, userID int) (string, int64, error) {
+// CreateJWT issues a token for the user, bound to one of their sessions. The
+// role claim lets clients know what the user may do, the server itself goes
+// by the role stored with the user so a demotion applies right away.
+func CreateJWT(secret []byte, userID int, role, sessionID string) (string, int64, error) {
 	expiration := time.Second * time.Duration(config.Envs.JWTExpirationInSeconds)
-	expireAt := time.Now().Add(expiration).Unix()
+	now := time.Now()
+	expireAt := now.Add(expiration).Unix()
+
+	// the id lets a single token be revoked
+	jti, err := utils.RandomString(16)
+	if err != nil {
+		return "", 0, err
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID":    strconv.Itoa(userID),
+		"role":      role,
 		"expiredAt": expireAt,
+		// the standard claim is the one checked when parsing
+		"exp": expireAt,
+		// to the microsecond, so that a token issued right after signing out
+		// everywhere is not taken for one of the revoked ones
+		"iat": float64(now.UnixMicro()) / 1e6,
+		"jti": jti,
+		"sid": sessionID,
 	})
 
 	tokenString, err := token.SignedString(secret)
 	if err != nil {
-		return "", 0, nil
+		return "", 0, err
 	}
 	return tokenString, expireAt, nil
 }
@@ -38,34 +75,104 @@ func WithJWTAuth(handlerFunc fiber.Handler, store types.UserStore) fiber.Handler
 	return func(c *fiber.Ctx) error {
 		tokenString := utils.GetTokenFromRequest(c)
 
-		token, err := validateJWT(tokenString)
+		claims, err := ParseClaims(tokenString)
 		if err != nil {
 			log.Printf("failed to validate token: %s", err.Error())
 			return permissionDenied(c)
 		}
 
-		if !token.Valid {
-			log.Println("invalid token")
-			return permissionDenied(c)
+		if revocations != nil {
+			revoked, err := revocations.IsRevoked(claims)
+			if err != nil {
+				log.Printf("failed to check token revocation: %v", err)
+				return permissionDenied(c)
+			}
+			if revoked {
+				return permissionDenied(c)
+			}
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		str := claims[string(UserKey)].(string)
+		if sessions != nil && claims.SessionID != "" {
+			active, err := sessions.IsActive(claims, c.IP())
+			if err != nil {
+				log.Printf("failed to check session: %v", err)
+				return permissionDenied(c)
+			}
+			if !active {
+				return permissionDenied(c)
+			}
+		}
 
-		userID, _ := strconv.Atoi(str)
-		u, err := store.GetUserByID(userID)
+		u, err := store.GetUserByID(claims.UserID)
 		if err != nil {
 			log.Printf("failed to get user by id: %v", err)
 			return permissionDenied(c)
 		}
 
+		if u.SuspendedAt.Valid {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "account suspended",
+			})
+		}
+
 		ctx := context.WithValue(c.UserContext(), UserKey, u.ID)
+		ctx = context.WithValue(ctx, RoleKey, u.Role)
+		ctx = context.WithValue(ctx, ClaimsKey, claims)
+		ctx = context.WithValue(ctx, EmailVerifiedKey, u.EmailVerifiedAt.Valid)
 		c.SetUserContext(ctx)
 
 		return handlerFunc(c)
 	}
 }
 
+// ParseUserID returns the id of the user the token was issued to, without
+// checking that the user still exists.
+func ParseUserID(tokenString string) (int, error) {
+	claims, err := ParseClaims(tokenString)
+	if err != nil {
+		return 0, err
+	}
+
+	return claims.UserID, nil
+}
+
+// ParseClaims checks the signature and the expiration of the token, without
+// checking whether it was revoked.
+func ParseClaims(tokenString string) (*Claims, error) {
+	token, err := validateJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	mapClaims := token.Claims.(jwt.MapClaims)
+	str, ok := mapClaims[string(UserKey)].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	userID, err := strconv.Atoi(str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	claims := &Claims{UserID: userID}
+	claims.ID, _ = mapClaims["jti"].(string)
+	claims.SessionID, _ = mapClaims["sid"].(string)
+	// the library would truncate the time to the second
+	if iat, ok := mapClaims["iat"].(float64); ok {
+		claims.IssuedAt = time.UnixMicro(int64(math.Round(iat * 1e6)))
+	}
+	if exp, err := mapClaims.GetExpirationTime(); err == nil && exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+
+	return claims, nil
+}
+
 func validateJWT(tokenString string) (*jwt.Token, error) {
 	return jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -90,3 +197,25 @@ func GetIDFromContext(c *fiber.Ctx) int {
 
 	return userID
 }
+
+// GetClaimsFromContext returns the claims of the token the request was
+// authenticated with.
+func GetClaimsFromContext(c *fiber.Ctx) *Claims {
+	claims, ok := c.UserContext().Value(ClaimsKey).(*Claims)
+	if !ok {
+		return &Claims{UserID: -1}
+	}
+
+	return claims
+}
+
+// GetRoleFromContext returns the system role of the current user, users
+// stored before roles existed count as plain users.
+func GetRoleFromContext(c *fiber.Ctx) string {
+	role, ok := c.UserContext().Value(RoleKey).(string)
+	if !ok || role == "" {
+		return types.SystemRoleUser
+	}
+
+	return role
+}
@@ -1,11 +1,15 @@
 package auth
 
-import "testing"
+import (
+  "testing"
+
+  "github.com/dclouisDan/chat-app-api/types"
+)
 
 func TestCreateJWT(t *testing.T) {
   secret := []byte("secret")
 
-  token, _, err := CreateJWT(secret, 1)
+  token, _, err := CreateJWT(secret, 1, types.SystemRoleUser, "")
   if err != nil {
     t.Errorf("error creating JWT: %v", err)
   }
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+// revocations is checked by WithJWTAuth, tokens are never considered
+// revoked until UseRevocations is called.
+var revocations *Revocations
+
+// UseRevocations makes WithJWTAuth refuse the tokens revoked through r.
+func UseRevocations(r *Revocations) {
+	revocations = r
+}
+
+// Revocations tells whether a token was revoked, keeping the answers of the
+// store in memory so that authenticating a request does not cost a query.
+//
+// Revoked tokens stay revoked, so only the tokens found valid are checked
+// again once the cache period is over. A token revoked on another instance
+// of the API keeps working here for at most that period.
+type Revocations struct {
+	store types.TokenRevocationStore
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+	users  map[int]cachedUser
+}
+
+type cachedToken struct {
+	revoked bool
+	until   time.Time
+}
+
+type cachedUser struct {
+	revokedBefore time.Time
+	until         time.Time
+}
+
+func NewRevocations(store types.TokenRevocationStore, ttl time.Duration) *Revocations {
+	return &Revocations{
+		store:  store,
+		ttl:    ttl,
+		now:    time.Now,
+		tokens: map[string]cachedToken{},
+		users:  map[int]cachedUser{},
+	}
+}
+
+// IsRevoked reports whether the token was revoked on its own, or along with
+// every token of its user.
+func (r *Revocations) IsRevoked(claims *Claims) (bool, error) {
+	revokedBefore, err := r.userTokensRevokedBefore(claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	if !revokedBefore.IsZero() && claims.IssuedAt.Before(revokedBefore) {
+		return true, nil
+	}
+
+	if claims.ID == "" {
+		return false, nil
+	}
+
+	return r.tokenRevoked(claims)
+}
+
+func (r *Revocations) RevokeToken(jti string, userID int, expiresAt time.Time) error {
+	if err := r.store.RevokeToken(jti, userID, expiresAt); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.tokens[jti] = cachedToken{revoked: true, until: expiresAt}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// RevokeUserTokens revokes every token issued to the user so far.
+func (r *Revocations) RevokeUserTokens(userID int) error {
+	// tokens and the store keep times to the microsecond
+	now := r.now().Truncate(time.Microsecond)
+	expiresAt := now.Add(time.Second * time.Duration(config.Envs.JWTExpirationInSeconds))
+
+	if err := r.store.RevokeUserTokens(userID, now, expiresAt); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.users[userID] = cachedUser{revokedBefore: now, until: r.now().Add(r.ttl)}
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *Revocations) tokenRevoked(claims *Claims) (bool, error) {
+	now := r.now()
+
+	r.mu.Lock()
+	cached, ok := r.tokens[claims.ID]
+	r.mu.Unlock()
+	if ok && now.Before(cached.until) {
+		return cached.revoked, nil
+	}
+
+	revoked, err := r.store.IsTokenRevoked(claims.ID)
+	if err != nil {
+		return false, err
+	}
+
+	until := now.Add(r.ttl)
+	if revoked {
+		until = claims.ExpiresAt
+	}
+
+	r.mu.Lock()
+	r.tokens[claims.ID] = cachedToken{revoked: revoked, until: until}
+	r.mu.Unlock()
+
+	return revoked, nil
+}
+
+func (r *Revocations) userTokensRevokedBefore(userID int) (time.Time, error) {
+	now := r.now()
+
+	r.mu.Lock()
+	cached, ok := r.users[userID]
+	r.mu.Unlock()
+	if ok && now.Before(cached.until) {
+		return cached.revokedBefore, nil
+	}
+
+	revokedBefore, err := r.store.GetUserTokensRevokedBefore(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	r.mu.Lock()
+	r.users[userID] = cachedUser{revokedBefore: revokedBefore, until: now.Add(r.ttl)}
+	r.mu.Unlock()
+
+	return revokedBefore, nil
+}
+
+// Prune drops the revocations of the tokens that expired since, from the
+// store and from memory, every interval until stop is closed.
+func (r *Revocations) Prune(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.sweep()
+
+			deleted, err := r.store.DeleteExpiredRevocations(r.now())
+			if err != nil {
+				log.Printf("auth: pruning revocations failed: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("auth: pruned %d expired revocations", deleted)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (r *Revocations) sweep() {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for jti, cached := range r.tokens {
+		if !now.Before(cached.until) {
+			delete(r.tokens, jti)
+		}
+	}
+	for userID, cached := range r.users {
+		if !now.Before(cached.until) {
+			delete(r.users, userID)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevocations(t *testing.T) {
+	now := time.Date(2024, 8, 13, 12, 0, 0, 0, time.UTC)
+
+	newRevocations := func() (*Revocations, *mockRevocationStore) {
+		store := newMockRevocationStore()
+		r := NewRevocations(store, time.Minute)
+		r.now = func() time.Time { return now }
+		return r, store
+	}
+
+	claims := &Claims{UserID: 1, ID: "abc", IssuedAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Hour)}
+
+	t.Run("should refuse a revoked token", func(t *testing.T) {
+		r, _ := newRevocations()
+
+		revoked, err := r.IsRevoked(claims)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+
+		assert.NoError(t, r.RevokeToken(claims.ID, claims.UserID, claims.ExpiresAt))
+
+		revoked, _ = r.IsRevoked(claims)
+		assert.True(t, revoked)
+
+		other := *claims
+		other.ID = "def"
+		revoked, _ = r.IsRevoked(&other)
+		assert.False(t, revoked)
+	})
+
+	t.Run("should refuse the tokens issued before revoking every token of the user", func(t *testing.T) {
+		r, _ := newRevocations()
+
+		assert.NoError(t, r.RevokeUserTokens(1))
+
+		revoked, _ := r.IsRevoked(claims)
+		assert.True(t, revoked)
+
+		justBefore := *claims
+		justBefore.IssuedAt = now.Add(-time.Millisecond)
+		revoked, _ = r.IsRevoked(&justBefore)
+		assert.True(t, revoked)
+
+		// a login during the same second is kept
+		sameSecond := *claims
+		sameSecond.IssuedAt = now.Add(time.Millisecond)
+		revoked, _ = r.IsRevoked(&sameSecond)
+		assert.False(t, revoked)
+
+		later := *claims
+		later.IssuedAt = now.Add(time.Second)
+		revoked, _ = r.IsRevoked(&later)
+		assert.False(t, revoked)
+
+		otherUser := *claims
+		otherUser.UserID = 2
+		revoked, _ = r.IsRevoked(&otherUser)
+		assert.False(t, revoked)
+	})
+
+	t.Run("should keep a token issued right after revoking every token of the user", func(t *testing.T) {
+		r := NewRevocations(newMockRevocationStore(), time.Minute)
+		assert.NoError(t, r.RevokeUserTokens(1))
+
+		token, _, err := CreateJWT([]byte(config.Envs.JWTSecret), 1, types.SystemRoleUser, "")
+		assert.NoError(t, err)
+		issued, err := ParseClaims(token)
+		assert.NoError(t, err)
+
+		revoked, _ := r.IsRevoked(issued)
+		assert.False(t, revoked)
+	})
+
+	t.Run("should cache valid tokens for the cache period only", func(t *testing.T) {
+		r, store := newRevocations()
+
+		r.IsRevoked(claims)
+		r.IsRevoked(claims)
+		assert.Equal(t, 1, store.lookups)
+
+		// revoked on another instance
+		store.tokens[claims.ID] = true
+		revoked, _ := r.IsRevoked(claims)
+		assert.False(t, revoked)
+
+		now = now.Add(2 * time.Minute)
+		defer func() { now = now.Add(-2 * time.Minute) }()
+
+		revoked, _ = r.IsRevoked(claims)
+		assert.True(t, revoked)
+		assert.Equal(t, 2, store.lookups)
+	})
+
+	t.Run("should prune expired revocations", func(t *testing.T) {
+		r, store := newRevocations()
+		r.RevokeToken(claims.ID, claims.UserID, claims.ExpiresAt)
+
+		r.now = func() time.Time { return claims.ExpiresAt }
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			r.Prune(10*time.Millisecond, stop)
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			return len(r.tokens) == 0
+		}, time.Second, 10*time.Millisecond)
+
+		close(stop)
+		<-done
+
+		assert.True(t, store.pruned)
+	})
+}
+
+type mockRevocationStore struct {
+	tokens  map[string]bool
+	users   map[int]time.Time
+	lookups int
+	pruned  bool
+}
+
+func newMockRevocationStore() *mockRevocationStore {
+	return &mockRevocationStore{tokens: map[string]bool{}, users: map[int]time.Time{}}
+}
+
+func (m *mockRevocationStore) RevokeToken(jti string, userID int, expiresAt time.Time) error {
+	m.tokens[jti] = true
+	return nil
+}
+
+func (m *mockRevocationStore) IsTokenRevoked(jti string) (bool, error) {
+	m.lookups++
+	return m.tokens[jti], nil
+}
+
+func (m *mockRevocationStore) RevokeUserTokens(userID int, issuedBefore, expiresAt time.Time) error {
+	m.users[userID] = issuedBefore
+	return nil
+}
+
+func (m *mockRevocationStore) GetUserTokensRevokedBefore(userID int) (time.Time, error) {
+	return m.users[userID], nil
+}
+
+func (m *mockRevocationStore) DeleteExpiredRevocations(now time.Time) (int64, error) {
+	m.pruned = true
+	return 0, nil
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+)
+
+var roleRanks = map[string]int{
+	types.SystemRoleUser:      0,
+	types.SystemRoleModerator: 1,
+	types.SystemRoleAdmin:     2,
+}
+
+// HasRole reports whether role grants at least what the required one does,
+// admins can do whatever moderators can.
+func HasRole(role, required string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[required]
+}
+
+// RequireRole only lets users with at least the role through. It goes inside
+// WithJWTAuth, which loads the role of the user:
+//
+//	auth.WithJWTAuth(auth.RequireRole(h.handleX, types.SystemRoleAdmin), h.userStore)
+func RequireRole(handlerFunc fiber.Handler, role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !HasRole(GetRoleFromContext(c), role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "insufficient role",
+			})
+		}
+
+		return handlerFunc(c)
+	}
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireRole(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(context.WithValue(c.UserContext(), RoleKey, c.Get("X-Role")))
+		return c.Next()
+	})
+	app.Get("/", RequireRole(func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	}, types.SystemRoleModerator))
+
+	for role, status := range map[string]int{
+		"":                        http.StatusForbidden,
+		types.SystemRoleUser:      http.StatusForbidden,
+		types.SystemRoleModerator: http.StatusNoContent,
+		types.SystemRoleAdmin:     http.StatusNoContent,
+		"superuser":               http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Role", role)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		resp.Body.Close()
+
+		assert.Equal(t, status, resp.StatusCode, role)
+	}
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+// sessions is checked by WithJWTAuth, the session of a token is not looked
+// at until UseSessions is called.
+var sessions *Sessions
+
+// UseSessions makes WithJWTAuth refuse the tokens of the sessions signed out
+// through s.
+func UseSessions(s *Sessions) {
+	sessions = s
+}
+
+// Sessions tells whether the session a token is bound to is still signed
+// in, and records the last activity of the sessions.
+//
+// Like Revocations, the answers of the store are kept in memory for the
+// cache period. The last activity of a session is only written when it is
+// looked up again, so it is accurate to that period.
+type Sessions struct {
+	store types.SessionStore
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu     sync.Mutex
+	active map[string]cachedSession
+}
+
+type cachedSession struct {
+	userID int
+	active bool
+	until  time.Time
+}
+
+func NewSessions(store types.SessionStore, ttl time.Duration) *Sessions {
+	return &Sessions{
+		store:  store,
+		ttl:    ttl,
+		now:    time.Now,
+		active: map[string]cachedSession{},
+	}
+}
+
+// IsActive reports whether the session of the token was not signed out,
+// recording the activity of the session from the given IP address.
+func (s *Sessions) IsActive(claims *Claims, ip string) (bool, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	cached, ok := s.active[claims.SessionID]
+	s.mu.Unlock()
+	if ok && now.Before(cached.until) {
+		return cached.active && cached.userID == claims.UserID, nil
+	}
+
+	// sessions signed out long ago are deleted and not found
+	session, err := s.store.GetSessionByID(claims.SessionID)
+	if err != nil {
+		return false, err
+	}
+
+	active := !session.RevokedAt.Valid
+	if active && now.Sub(session.LastActiveAt) >= s.ttl {
+		if err := s.store.TouchSession(session.ID, now, ip); err != nil {
+			log.Printf("auth: failed to record the activity of session %s: %v", session.ID, err)
+		}
+	}
+
+	s.mu.Lock()
+	s.active[claims.SessionID] = cachedSession{userID: session.UserID, active: active, until: now.Add(s.ttl)}
+	s.mu.Unlock()
+
+	return active && session.UserID == claims.UserID, nil
+}
+
+func (s *Sessions) RevokeSession(id string) error {
+	if err := s.store.RevokeSession(id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.active[id] = cachedSession{active: false, until: s.now().Add(s.ttl)}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// RevokeUserSessions signs every session of the user out.
+func (s *Sessions) RevokeUserSessions(userID int) error {
+	if err := s.store.RevokeUserSessions(userID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for id, cached := range s.active {
+		if cached.userID == userID {
+			delete(s.active, id)
+		}
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Prune deletes the sessions signed out or inactive for longer than
+// retention, and forgets the sessions not looked up for the cache period,
+// every interval until stop is closed.
+func (s *Sessions) Prune(interval, retention time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sweep()
+
+			deleted, err := s.store.DeleteStaleSessions(s.now().Add(-retention))
+			if err != nil {
+				log.Printf("auth: pruning sessions failed: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("auth: pruned %d stale sessions", deleted)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *Sessions) sweep() {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, cached := range s.active {
+		if !now.Before(cached.until) {
+			delete(s.active, id)
+		}
+	}
+}
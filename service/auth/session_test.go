@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions(t *testing.T) {
+	now := time.Date(2024, 8, 14, 12, 0, 0, 0, time.UTC)
+
+	newSessions := func() (*Sessions, *mockSessionStore) {
+		store := &mockSessionStore{sessions: map[string]*types.Session{
+			"laptop": {ID: "laptop", UserID: 1, LastActiveAt: now.Add(-time.Hour)},
+			"phone":  {ID: "phone", UserID: 1, LastActiveAt: now.Add(-time.Hour)},
+		}}
+		s := NewSessions(store, time.Minute)
+		s.now = func() time.Time { return now }
+		return s, store
+	}
+
+	t.Run("should refuse tokens of signed out sessions", func(t *testing.T) {
+		s, _ := newSessions()
+
+		active, err := s.IsActive(&Claims{UserID: 1, SessionID: "laptop"}, "127.0.0.1")
+		assert.NoError(t, err)
+		assert.True(t, active)
+
+		assert.NoError(t, s.RevokeSession("laptop"))
+
+		active, _ = s.IsActive(&Claims{UserID: 1, SessionID: "laptop"}, "127.0.0.1")
+		assert.False(t, active)
+
+		active, _ = s.IsActive(&Claims{UserID: 1, SessionID: "phone"}, "127.0.0.1")
+		assert.True(t, active)
+
+		assert.NoError(t, s.RevokeUserSessions(1))
+
+		active, _ = s.IsActive(&Claims{UserID: 1, SessionID: "phone"}, "127.0.0.1")
+		assert.False(t, active)
+	})
+
+	t.Run("should refuse a session of another user or that does not exist", func(t *testing.T) {
+		s, _ := newSessions()
+
+		active, _ := s.IsActive(&Claims{UserID: 2, SessionID: "laptop"}, "127.0.0.1")
+		assert.False(t, active)
+
+		active, err := s.IsActive(&Claims{UserID: 1, SessionID: "made-up"}, "127.0.0.1")
+		assert.Error(t, err)
+		assert.False(t, active)
+	})
+
+	t.Run("should record the activity once per cache period", func(t *testing.T) {
+		s, store := newSessions()
+		claims := &Claims{UserID: 1, SessionID: "laptop"}
+
+		s.IsActive(claims, "10.0.0.1")
+		s.IsActive(claims, "10.0.0.2")
+		assert.Equal(t, 1, store.lookups)
+		assert.Equal(t, now, store.sessions["laptop"].LastActiveAt)
+		assert.Equal(t, "10.0.0.1", store.sessions["laptop"].IP)
+
+		// signed out on another instance
+		store.sessions["laptop"].RevokedAt = sql.NullTime{Time: now, Valid: true}
+		active, _ := s.IsActive(claims, "10.0.0.1")
+		assert.True(t, active)
+
+		now = now.Add(2 * time.Minute)
+		defer func() { now = now.Add(-2 * time.Minute) }()
+
+		active, _ = s.IsActive(claims, "10.0.0.1")
+		assert.False(t, active)
+	})
+}
+
+type mockSessionStore struct {
+	sessions map[string]*types.Session
+	lookups  int
+}
+
+func (m *mockSessionStore) CreateSession(session types.Session) error {
+	m.sessions[session.ID] = &session
+	return nil
+}
+
+func (m *mockSessionStore) GetSessionByID(id string) (*types.Session, error) {
+	m.lookups++
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("session not found")
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (m *mockSessionStore) GetUserSessions(userID int, activeSince time.Time) ([]types.Session, error) {
+	return nil, nil
+}
+
+func (m *mockSessionStore) TouchSession(id string, lastActiveAt time.Time, ip string) error {
+	m.sessions[id].LastActiveAt, m.sessions[id].IP = lastActiveAt, ip
+	return nil
+}
+
+func (m *mockSessionStore) RevokeSession(id string) error {
+	m.sessions[id].RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (m *mockSessionStore) RevokeUserSessions(userID int) error {
+	for _, session := range m.sessions {
+		if session.UserID == userID {
+			session.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (m *mockSessionStore) DeleteStaleSessions(before time.Time) (int64, error) {
+	return 0, nil
+}
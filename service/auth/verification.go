@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+// What users may not do before verifying their email address, the values of
+// REQUIRE_VERIFIED_EMAIL. Users who can not log in can not send messages
+// either.
+const (
+	VerifyBeforeLogin     = "login"
+	VerifyBeforeMessaging = "messaging"
+)
+
+// VerificationRequired reports whether users have to verify their email
+// address before doing what is given, one of the VerifyBefore values.
+func VerificationRequired(before string) bool {
+	switch config.Envs.RequireVerifiedEmail {
+	case VerifyBeforeLogin:
+		return true
+	case VerifyBeforeMessaging:
+		return before == VerifyBeforeMessaging
+	}
+
+	return false
+}
+
+// RequireVerifiedEmail keeps users who did not verify their email address
+// from sending messages when the configuration asks for it. It goes inside
+// WithJWTAuth, which loads whether the user did.
+func RequireVerifiedEmail(handlerFunc fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if VerificationRequired(VerifyBeforeMessaging) && !IsEmailVerified(c) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "email not verified",
+			})
+		}
+
+		return handlerFunc(c)
+	}
+}
+
+func IsEmailVerified(c *fiber.Ctx) bool {
+	verified, _ := c.UserContext().Value(EmailVerifiedKey).(bool)
+	return verified
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	defer func() { config.Envs.RequireVerifiedEmail = "" }()
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(context.WithValue(c.UserContext(), EmailVerifiedKey, c.Get("X-Verified") == "true"))
+		return c.Next()
+	})
+	app.Post("/", RequireVerifiedEmail(func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	}))
+
+	for _, tc := range []struct {
+		setting  string
+		verified string
+		status   int
+	}{
+		{"", "false", http.StatusNoContent},
+		{VerifyBeforeMessaging, "false", http.StatusForbidden},
+		{VerifyBeforeMessaging, "true", http.StatusNoContent},
+		{VerifyBeforeLogin, "false", http.StatusForbidden},
+		{VerifyBeforeLogin, "true", http.StatusNoContent},
+	} {
+		config.Envs.RequireVerifiedEmail = tc.setting
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("X-Verified", tc.verified)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, tc.status, resp.StatusCode, "setting %q, verified %s", tc.setting, tc.verified)
+	}
+}
+
+func TestEmailToken(t *testing.T) {
+	token, err := CreateEmailToken(PurposeVerifyEmail, 7, "user@email.com", time.Hour)
+	assert.NoError(t, err)
+
+	userID, binding, err := ParseEmailToken(PurposeVerifyEmail, token)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, userID)
+	assert.Equal(t, "user@email.com", binding)
+
+	_, _, err = ParseEmailToken("reset-password", token)
+	assert.Error(t, err, "expected the token to only work for its purpose")
+
+	expired, _ := CreateEmailToken(PurposeVerifyEmail, 7, "user@email.com", -time.Minute)
+	_, _, err = ParseEmailToken(PurposeVerifyEmail, expired)
+	assert.Error(t, err)
+
+	// access tokens are not email tokens, and the other way round
+	accessToken, _, _ := CreateJWT([]byte(config.Envs.JWTSecret), 7, "user", "")
+	_, _, err = ParseEmailToken(PurposeVerifyEmail, accessToken)
+	assert.Error(t, err)
+
+	_, err = ParseClaims(token)
+	assert.Error(t, err)
+}
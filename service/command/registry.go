@@ -0,0 +1,205 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/webhook"
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+const requestTimeout = 5 * time.Second
+
+// Call is a command invocation as typed in the composer.
+type Call struct {
+	ConversationID int
+	UserID         int
+	Name           string
+	Args           string
+}
+
+// Builtin is a command served by a Go handler, it is available in every
+// conversation.
+type Builtin struct {
+	Description string
+	Run         func(call Call) (*types.CommandResult, error)
+}
+
+// Registry resolves slash commands, built-ins take precedence over the
+// custom commands of a conversation.
+type Registry struct {
+	store    types.SlashCommandStore
+	client   *http.Client
+	builtins map[string]Builtin
+}
+
+func NewRegistry(store types.SlashCommandStore) *Registry {
+	r := &Registry{
+		store:    store,
+		client:   &http.Client{Timeout: requestTimeout},
+		builtins: map[string]Builtin{},
+	}
+
+	r.Register("help", Builtin{Description: "List the commands available here", Run: r.help})
+	r.Register("shrug", Builtin{Description: "Append ¯\\_(ツ)_/¯ to your message", Run: shrug})
+	r.Register("me", Builtin{Description: "Send your message as an action", Run: me})
+
+	return r
+}
+
+// Register adds a built-in command, replacing any earlier one of that name.
+func (r *Registry) Register(name string, builtin Builtin) {
+	r.builtins[name] = builtin
+}
+
+// IsBuiltin reports whether custom commands may not use the name.
+func (r *Registry) IsBuiltin(name string) bool {
+	_, ok := r.builtins[name]
+	return ok
+}
+
+// Builtins lists the built-in commands with their description.
+func (r *Registry) Builtins() map[string]string {
+	builtins := map[string]string{}
+	for name, b := range r.builtins {
+		builtins[name] = b.Description
+	}
+	return builtins
+}
+
+func (r *Registry) Execute(conversationID, userID int, content string) (*types.CommandResult, error) {
+	name, args, ok := parse(content)
+	if !ok {
+		return nil, nil
+	}
+
+	call := Call{ConversationID: conversationID, UserID: userID, Name: name, Args: args}
+
+	var (
+		result *types.CommandResult
+		err    error
+	)
+	if builtin, ok := r.builtins[name]; ok {
+		result, err = builtin.Run(call)
+	} else if custom, lookupErr := r.store.GetSlashCommandByName(conversationID, name); lookupErr == nil {
+		result, err = r.runCustom(custom, call)
+	} else {
+		result = ephemeral(fmt.Sprintf("/%s is not a valid command, type /help to list the available ones", name))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Command = name
+	if result.ResponseType != types.CommandResponsePublic {
+		result.ResponseType = types.CommandResponseEphemeral
+	}
+
+	return result, nil
+}
+
+// parse splits "/name args" into its parts. A leading double slash is how a
+// message that starts with a slash is sent as is.
+func parse(content string) (string, string, bool) {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "/") || strings.HasPrefix(content, "//") {
+		return "", "", false
+	}
+
+	name, args, _ := strings.Cut(content[1:], " ")
+	if name == "" {
+		return "", "", false
+	}
+
+	return strings.ToLower(name), strings.TrimSpace(args), true
+}
+
+type customRequest struct {
+	Command        string `json:"command"`
+	Text           string `json:"text"`
+	ConversationID int    `json:"conversationId"`
+	UserID         int    `json:"userId"`
+}
+
+// runCustom posts the call to the endpoint of the command, signed the same
+// way outgoing webhooks are, and reads the reply from the response body.
+func (r *Registry) runCustom(command *types.SlashCommand, call Call) (*types.CommandResult, error) {
+	body, err := json.Marshal(customRequest{
+		Command:        call.Name,
+		Text:           call.Args,
+		ConversationID: call.ConversationID,
+		UserID:         call.UserID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, command.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Command-Signature", webhook.Sign(command.Secret, body))
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return ephemeral(fmt.Sprintf("/%s did not respond", call.Name)), nil
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return ephemeral(fmt.Sprintf("/%s failed with status %d", call.Name, res.StatusCode)), nil
+	}
+
+	var result types.CommandResult
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&result); err != nil || result.Text == "" {
+		return ephemeral(fmt.Sprintf("/%s returned an invalid response", call.Name)), nil
+	}
+
+	return &result, nil
+}
+
+func (r *Registry) help(call Call) (*types.CommandResult, error) {
+	lines := []string{}
+	for name, b := range r.builtins {
+		lines = append(lines, fmt.Sprintf("/%s - %s", name, b.Description))
+	}
+
+	custom, err := r.store.GetSlashCommandsByConversationID(call.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	for _, cmd := range custom {
+		lines = append(lines, fmt.Sprintf("/%s - %s", cmd.Name, cmd.Description))
+	}
+	sort.Strings(lines)
+
+	return ephemeral(strings.Join(lines, "\n")), nil
+}
+
+func shrug(call Call) (*types.CommandResult, error) {
+	text := `¯\_(ツ)_/¯`
+	if call.Args != "" {
+		text = call.Args + " " + text
+	}
+
+	return &types.CommandResult{ResponseType: types.CommandResponsePublic, Text: text}, nil
+}
+
+func me(call Call) (*types.CommandResult, error) {
+	if call.Args == "" {
+		return ephemeral("usage: /me <action>"), nil
+	}
+
+	return &types.CommandResult{ResponseType: types.CommandResponsePublic, Text: "_" + call.Args + "_"}, nil
+}
+
+func ephemeral(text string) *types.CommandResult {
+	return &types.CommandResult{ResponseType: types.CommandResponseEphemeral, Text: text}
+}
@@ -0,0 +1,93 @@
+package command
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dclouisDan/chat-app-api/service/webhook"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	store := &mockSlashCommandStore{commands: map[int]*types.SlashCommand{}}
+	registry := NewRegistry(store)
+
+	t.Run("should ignore regular messages", func(t *testing.T) {
+		for _, content := range []string{"hello", "//not a command", "/"} {
+			result, err := registry.Execute(1, 1, content)
+			assert.NoError(t, err)
+			assert.Nil(t, result, content)
+		}
+	})
+
+	t.Run("should run built-in commands", func(t *testing.T) {
+		result, err := registry.Execute(1, 1, "/shrug oh well")
+		assert.NoError(t, err)
+		assert.Equal(t, types.CommandResponsePublic, result.ResponseType)
+		assert.Equal(t, `oh well ¯\_(ツ)_/¯`, result.Text)
+
+		result, err = registry.Execute(1, 1, "/ME waves")
+		assert.NoError(t, err)
+		assert.Equal(t, "me", result.Command)
+		assert.Equal(t, "_waves_", result.Text)
+	})
+
+	t.Run("should answer unknown commands privately", func(t *testing.T) {
+		result, err := registry.Execute(1, 1, "/deploy prod")
+		assert.NoError(t, err)
+		assert.Equal(t, types.CommandResponseEphemeral, result.ResponseType)
+		assert.Contains(t, result.Text, "/deploy is not a valid command")
+	})
+
+	t.Run("should call the endpoint of a custom command", func(t *testing.T) {
+		var received customRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get("X-Command-Signature") != webhook.Sign("s3cret", body) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.Unmarshal(body, &received)
+			json.NewEncoder(w).Encode(types.CommandResult{ResponseType: types.CommandResponsePublic, Text: "deploying " + received.Text})
+		}))
+		defer server.Close()
+
+		store.CreateSlashCommand(types.SlashCommand{ConversationID: 1, Name: "deploy", URL: server.URL, Secret: "s3cret"})
+
+		result, err := registry.Execute(1, 7, "/deploy prod")
+		assert.NoError(t, err)
+		assert.Equal(t, 7, received.UserID)
+		assert.Equal(t, types.CommandResponsePublic, result.ResponseType)
+		assert.Equal(t, "deploying prod", result.Text)
+
+		result, err = registry.Execute(2, 7, "/deploy prod")
+		assert.NoError(t, err)
+		assert.Contains(t, result.Text, "not a valid command")
+	})
+
+	t.Run("should report a failing endpoint privately", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		store.CreateSlashCommand(types.SlashCommand{ConversationID: 1, Name: "ticket", URL: server.URL})
+
+		result, err := registry.Execute(1, 1, "/ticket open")
+		assert.NoError(t, err)
+		assert.Equal(t, types.CommandResponseEphemeral, result.ResponseType)
+		assert.Equal(t, "/ticket failed with status 502", result.Text)
+	})
+
+	t.Run("should list built-in and custom commands in help", func(t *testing.T) {
+		result, err := registry.Execute(1, 1, "/help")
+		assert.NoError(t, err)
+		assert.Equal(t, types.CommandResponseEphemeral, result.ResponseType)
+		assert.Contains(t, result.Text, "/shrug")
+		assert.Contains(t, result.Text, "/deploy")
+	})
+}
@@ -0,0 +1,175 @@
+package command
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	store             types.SlashCommandStore
+	registry          *Registry
+	conversationStore types.ConversationStore
+	userStore         types.UserStore
+}
+
+func NewHandler(store types.SlashCommandStore, registry *Registry, conversationStore types.ConversationStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, registry: registry, conversationStore: conversationStore, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Get("/conversations/:id/commands", auth.WithJWTAuth(h.handleListCommands, h.userStore))
+	router.Post("/conversations/:id/commands", auth.WithJWTAuth(h.handleCreateCommand, h.userStore))
+	router.Delete("/conversations/:id/commands/:commandID", auth.WithJWTAuth(h.handleDeleteCommand, h.userStore))
+}
+
+// List the commands usable in a conversation, for composer autocompletion
+func (h *Handler) handleListCommands(c *fiber.Ctx) error {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+	}
+
+	if _, err := h.conversationStore.GetParticipant(conversationID, auth.GetIDFromContext(c)); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "not a participant of this conversation",
+		})
+	}
+
+	custom, err := h.store.GetSlashCommandsByConversationID(conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"builtins": h.registry.Builtins(),
+		"custom":   custom,
+	})
+}
+
+// Register a custom command, its signing secret is only shown once
+func (h *Handler) handleCreateCommand(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	var payload types.CreateSlashCommandPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	if h.registry.IsBuiltin(payload.Name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("/%s is a built-in command", payload.Name),
+		})
+	}
+
+	if _, err := h.store.GetSlashCommandByName(conversationID, payload.Name); err == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("/%s already exists in this conversation", payload.Name),
+		})
+	}
+
+	secret, err := utils.RandomString(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	command, err := h.store.CreateSlashCommand(types.SlashCommand{
+		ConversationID: conversationID,
+		CreatedBy:      auth.GetIDFromContext(c),
+		Name:           payload.Name,
+		Description:    payload.Description,
+		URL:            payload.URL,
+		Secret:         secret,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"command": command,
+		"secret":  secret,
+	})
+}
+
+// Remove a custom command
+func (h *Handler) handleDeleteCommand(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	commandID, err := c.ParamsInt("commandID")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid command id",
+		})
+	}
+
+	command, err := h.store.GetSlashCommandByID(commandID)
+	if err != nil || command.ConversationID != conversationID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "command not found",
+		})
+	}
+
+	if err := h.store.DeleteSlashCommand(command.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "command deleted",
+	})
+}
+
+// requireAdmin parses the conversation id and makes sure the current user is
+// one of its admins. It writes the error response itself when the check fails.
+func (h *Handler) requireAdmin(c *fiber.Ctx) (int, bool) {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+		return 0, false
+	}
+
+	p, err := h.conversationStore.GetParticipant(conversationID, auth.GetIDFromContext(c))
+	if err != nil || p.Role != types.RoleAdmin {
+		c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only conversation admins can manage commands",
+		})
+		return 0, false
+	}
+
+	return conversationID, true
+}
@@ -0,0 +1,233 @@
+package command
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandServiceHandlers(t *testing.T) {
+	store := &mockSlashCommandStore{commands: map[int]*types.SlashCommand{}}
+	conversationStore := &mockConversationStore{
+		participants: map[int]string{1: types.RoleAdmin, 2: types.RoleMember},
+	}
+	handler := NewHandler(store, NewRegistry(store), conversationStore, &mockUserStore{})
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	t.Run("should only let admins register commands", func(t *testing.T) {
+		payload := types.CreateSlashCommandPayload{Name: "deploy", URL: "https://ci.example.com/deploy"}
+		req := newRequest(t, http.MethodPost, "/conversations/1/commands", payload, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should not shadow a built-in command", func(t *testing.T) {
+		payload := types.CreateSlashCommandPayload{Name: "shrug", URL: "https://ci.example.com/shrug"}
+		req := newRequest(t, http.MethodPost, "/conversations/1/commands", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should register a command", func(t *testing.T) {
+		payload := types.CreateSlashCommandPayload{Name: "deploy", Description: "Deploy a branch", URL: "https://ci.example.com/deploy"}
+		req := newRequest(t, http.MethodPost, "/conversations/1/commands", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.NotEmpty(t, store.commands[1].Secret)
+	})
+
+	t.Run("should list commands to participants", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/conversations/1/commands", nil, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var body struct {
+			Builtins map[string]string    `json:"builtins"`
+			Custom   []types.SlashCommand `json:"custom"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Contains(t, body.Builtins, "help")
+		assert.Len(t, body.Custom, 1)
+	})
+
+	t.Run("should delete a command", func(t *testing.T) {
+		req := newRequest(t, http.MethodDelete, "/conversations/1/commands/1", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, store.commands)
+	})
+}
+
+func newRequest(t *testing.T, method, target string, payload any, userID int) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+type mockSlashCommandStore struct {
+	commands map[int]*types.SlashCommand
+	nextID   int
+}
+
+func (m *mockSlashCommandStore) CreateSlashCommand(command types.SlashCommand) (*types.SlashCommand, error) {
+	m.nextID++
+	command.ID = m.nextID
+	m.commands[command.ID] = &command
+	return &command, nil
+}
+
+func (m *mockSlashCommandStore) GetSlashCommandByID(id int) (*types.SlashCommand, error) {
+	if cmd, ok := m.commands[id]; ok {
+		return cmd, nil
+	}
+	return nil, fmt.Errorf("slash command not found")
+}
+
+func (m *mockSlashCommandStore) GetSlashCommandByName(conversationID int, name string) (*types.SlashCommand, error) {
+	for _, cmd := range m.commands {
+		if cmd.ConversationID == conversationID && cmd.Name == name {
+			return cmd, nil
+		}
+	}
+	return nil, fmt.Errorf("slash command not found")
+}
+
+func (m *mockSlashCommandStore) GetSlashCommandsByConversationID(conversationID int) ([]types.SlashCommand, error) {
+	commands := []types.SlashCommand{}
+	for _, cmd := range m.commands {
+		if cmd.ConversationID == conversationID {
+			commands = append(commands, *cmd)
+		}
+	}
+	return commands, nil
+}
+
+func (m *mockSlashCommandStore) DeleteSlashCommand(id int) error {
+	delete(m.commands, id)
+	return nil
+}
+
+type mockConversationStore struct {
+	participants map[int]string
+}
+
+func (m *mockConversationStore) CreateConversation(name string, creatorID int, participantIDs []int) (*types.Conversation, error) {
+	return &types.Conversation{ID: 1}, nil
+}
+
+func (m *mockConversationStore) GetConversationByID(id int) (*types.Conversation, error) {
+	return &types.Conversation{ID: id}, nil
+}
+
+func (m *mockConversationStore) GetParticipant(conversationID, userID int) (*types.Participant, error) {
+	if role, ok := m.participants[userID]; ok {
+		return &types.Participant{ConversationID: conversationID, UserID: userID, Role: role}, nil
+	}
+	return nil, fmt.Errorf("participant not found")
+}
+
+func (m *mockConversationStore) GetParticipants(conversationID int) ([]types.Participant, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) RemoveParticipant(conversationID, userID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) MarkRead(conversationID, userID, messageID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) GetContactIDs(userID int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) ExportMessages(conversationID int, fn func(*types.ExportedMessage) error) error {
+	return nil
+}
+
+func (m *mockConversationStore) UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error {
+	return nil
+}
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
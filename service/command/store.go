@@ -0,0 +1,110 @@
+package command
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateSlashCommand(command types.SlashCommand) (*types.SlashCommand, error) {
+	res, err := s.db.Exec(
+		"INSERT INTO slash_commands (conversation_id, created_by, name, description, url, secret) VALUES (?, ?, ?, ?, ?, ?)",
+		command.ConversationID, command.CreatedBy, command.Name, command.Description, command.URL, command.Secret,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetSlashCommandByID(int(id))
+}
+
+func (s *Store) GetSlashCommandByID(id int) (*types.SlashCommand, error) {
+	return s.getSlashCommand("SELECT * FROM slash_commands WHERE id = ?", id)
+}
+
+func (s *Store) GetSlashCommandByName(conversationID int, name string) (*types.SlashCommand, error) {
+	return s.getSlashCommand("SELECT * FROM slash_commands WHERE conversation_id = ? AND name = ?", conversationID, name)
+}
+
+func (s *Store) GetSlashCommandsByConversationID(conversationID int) ([]types.SlashCommand, error) {
+	rows, err := s.db.Query("SELECT * FROM slash_commands WHERE conversation_id = ? ORDER BY name", conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commands := []types.SlashCommand{}
+	for rows.Next() {
+		cmd, err := scanRowIntoSlashCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, *cmd)
+	}
+
+	return commands, nil
+}
+
+func (s *Store) DeleteSlashCommand(id int) error {
+	_, err := s.db.Exec("DELETE FROM slash_commands WHERE id = ?;", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) getSlashCommand(query string, args ...any) (*types.SlashCommand, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cmd := new(types.SlashCommand)
+	for rows.Next() {
+		cmd, err = scanRowIntoSlashCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cmd.ID == 0 {
+		return nil, fmt.Errorf("Slash command not found.")
+	}
+
+	return cmd, nil
+}
+
+func scanRowIntoSlashCommand(rows *sql.Rows) (*types.SlashCommand, error) {
+	cmd := new(types.SlashCommand)
+
+	err := rows.Scan(
+		&cmd.ID,
+		&cmd.ConversationID,
+		&cmd.CreatedBy,
+		&cmd.Name,
+		&cmd.Description,
+		&cmd.URL,
+		&cmd.Secret,
+		&cmd.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
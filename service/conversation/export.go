@@ -0,0 +1,150 @@
+package conversation
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+// exporter writes a conversation export one message at a time.
+type exporter interface {
+	contentType() string
+	extension() string
+	begin(w io.Writer, conversation *types.Conversation) error
+	write(w io.Writer, m *types.ExportedMessage) error
+	end(w io.Writer) error
+}
+
+func newExporter(format string) (exporter, error) {
+	switch format {
+	case "", "json":
+		return &jsonExporter{}, nil
+	case "html":
+		return &htmlExporter{}, nil
+	case "txt":
+		return &textExporter{}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// attachmentURL turns a stored attachment path into a link served by the
+// static file handler.
+func attachmentURL(path string) string {
+	return fmt.Sprintf("%s:%s/chat-app-api/v1/%s", config.Envs.PublicHost, config.Envs.Port, strings.TrimPrefix(path, "/"))
+}
+
+func conversationTitle(conversation *types.Conversation) string {
+	if conversation.Name.Valid && conversation.Name.String != "" {
+		return conversation.Name.String
+	}
+	return fmt.Sprintf("Conversation %d", conversation.ID)
+}
+
+type jsonExporter struct {
+	count int
+}
+
+func (e *jsonExporter) contentType() string { return "application/json" }
+func (e *jsonExporter) extension() string   { return "json" }
+
+func (e *jsonExporter) begin(w io.Writer, conversation *types.Conversation) error {
+	header, err := json.Marshal(conversation)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, `{"conversation":%s,"exportedAt":"%s","messages":[`, header, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func (e *jsonExporter) write(w io.Writer, m *types.ExportedMessage) error {
+	if e.count > 0 {
+		if _, err := io.WriteString(w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+func (e *jsonExporter) end(w io.Writer) error {
+	_, err := io.WriteString(w, "]}")
+	return err
+}
+
+type htmlExporter struct{}
+
+func (e *htmlExporter) contentType() string { return "text/html; charset=utf-8" }
+func (e *htmlExporter) extension() string   { return "html" }
+
+func (e *htmlExporter) begin(w io.Writer, conversation *types.Conversation) error {
+	title := html.EscapeString(conversationTitle(conversation))
+	_, err := fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>%s</title></head>\n<body>\n<h1>%s</h1>\n<ol>\n", title, title)
+	return err
+}
+
+func (e *htmlExporter) write(w io.Writer, m *types.ExportedMessage) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<li id=\"message-%d\"><strong>%s</strong> <time>%s</time>", m.ID, html.EscapeString(m.SenderName), m.SentAt.UTC().Format(time.RFC3339))
+	if m.EditedAt != nil {
+		fmt.Fprintf(&b, " <em>(edited %s)</em>", m.EditedAt.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "<p>%s</p>", html.EscapeString(m.Content))
+	for _, a := range m.Attachments {
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a> ", html.EscapeString(a.URL), html.EscapeString(a.FileName))
+	}
+	b.WriteString("</li>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (e *htmlExporter) end(w io.Writer) error {
+	_, err := io.WriteString(w, "</ol>\n</body>\n</html>\n")
+	return err
+}
+
+type textExporter struct{}
+
+func (e *textExporter) contentType() string { return "text/plain; charset=utf-8" }
+func (e *textExporter) extension() string   { return "txt" }
+
+func (e *textExporter) begin(w io.Writer, conversation *types.Conversation) error {
+	_, err := fmt.Fprintf(w, "%s\nExported at %s\n\n", conversationTitle(conversation), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func (e *textExporter) write(w io.Writer, m *types.ExportedMessage) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "[%s] %s: %s", m.SentAt.UTC().Format(time.RFC3339), m.SenderName, m.Content)
+	if m.EditedAt != nil {
+		fmt.Fprintf(&b, " (edited %s)", m.EditedAt.UTC().Format(time.RFC3339))
+	}
+	b.WriteString("\n")
+	for _, a := range m.Attachments {
+		fmt.Fprintf(&b, "    attachment: %s <%s>\n", a.FileName, a.URL)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (e *textExporter) end(w io.Writer) error {
+	return nil
+}
@@ -0,0 +1,302 @@
+package conversation
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	store      types.ConversationStore
+	userStore  types.UserStore
+	publisher  types.EventPublisher
+	dispatcher types.WebhookDispatcher
+}
+
+func NewHandler(store types.ConversationStore, userStore types.UserStore, publisher types.EventPublisher, dispatcher types.WebhookDispatcher) *Handler {
+	return &Handler{store: store, userStore: userStore, publisher: publisher, dispatcher: dispatcher}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Post("/conversations", auth.WithJWTAuth(h.handleCreateConversation, h.userStore))
+	router.Get("/conversations/:id", auth.WithJWTAuth(h.handleGetConversation, h.userStore))
+	router.Get("/conversations/:id/export", auth.WithJWTAuth(h.handleExportConversation, h.userStore))
+	router.Post("/conversations/:id/leave", auth.WithJWTAuth(h.handleLeaveConversation, h.userStore))
+	router.Put("/conversations/:id/notifications", auth.WithJWTAuth(h.handleUpdateNotificationSettings, h.userStore))
+}
+
+// Create a conversation, the creator becomes its admin
+func (h *Handler) handleCreateConversation(c *fiber.Ctx) error {
+	var payload types.CreateConversationPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	for _, id := range payload.ParticipantIDs {
+		if _, err := h.userStore.GetUserByID(id); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("user %d not found", id),
+			})
+		}
+	}
+
+	userID := auth.GetIDFromContext(c)
+
+	conversation, err := h.store.CreateConversation(payload.Name, userID, payload.ParticipantIDs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(conversation)
+}
+
+// Conversation details, restricted to participants
+func (h *Handler) handleGetConversation(c *fiber.Ctx) error {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	if _, err := h.store.GetParticipant(conversationID, userID); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "not a participant of this conversation",
+		})
+	}
+
+	conversation, err := h.store.GetConversationByID(conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	participants, err := h.store.GetParticipants(conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"conversation": conversation,
+		"participants": participants,
+	})
+}
+
+// Choose which messages of a conversation to be notified of, or mute it
+// for a while
+func (h *Handler) handleUpdateNotificationSettings(c *fiber.Ctx) error {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+	}
+
+	var payload types.UpdateNotificationSettingsPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	if _, err := h.store.GetParticipant(conversationID, userID); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "not a participant of this conversation",
+		})
+	}
+
+	var mutedUntil sql.NullTime
+	if payload.MutedUntil != nil {
+		mutedUntil = sql.NullTime{Time: *payload.MutedUntil, Valid: true}
+	}
+
+	if err := h.store.UpdateNotificationSettings(conversationID, userID, payload.Notifications, mutedUntil); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	participant, err := h.store.GetParticipant(conversationID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(participant)
+}
+
+// Leave a conversation, the last admin has to hand over the role first
+func (h *Handler) handleLeaveConversation(c *fiber.Ctx) error {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	participant, err := h.store.GetParticipant(conversationID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "not a participant of this conversation",
+		})
+	}
+
+	if participant.Role == types.RoleAdmin {
+		participants, err := h.store.GetParticipants(conversationID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		admins := 0
+		for _, p := range participants {
+			if p.Role == types.RoleAdmin {
+				admins++
+			}
+		}
+		if admins == 1 && len(participants) > 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "the last admin cannot leave the conversation",
+			})
+		}
+	}
+
+	if err := h.store.RemoveParticipant(conversationID, userID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// the user who left hears about it too, to drop the conversation on
+	// their other devices
+	h.publish(conversationID, types.Event{
+		Type:    types.EventMemberLeft,
+		Payload: fiber.Map{"conversationId": conversationID, "userId": userID},
+	}, userID)
+	h.dispatcher.Dispatch(conversationID, types.WebhookEventMemberLeft, fiber.Map{"userId": userID})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "left the conversation",
+	})
+}
+
+// Export every message of a conversation as json, html or txt
+func (h *Handler) handleExportConversation(c *fiber.Ctx) error {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+	}
+
+	exp, err := newExporter(c.Query("format"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	if _, err := h.store.GetParticipant(conversationID, userID); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "not a participant of this conversation",
+		})
+	}
+
+	conversation, err := h.store.GetConversationByID(conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, exp.contentType())
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"conversation-%d.%s\"", conversationID, exp.extension()))
+
+	// the body is produced after the handler returns, messages go straight
+	// from the database rows into the buffered connection writer
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := exp.begin(w, conversation); err != nil {
+			log.Printf("export conversation %d: %v", conversationID, err)
+			return
+		}
+
+		err := h.store.ExportMessages(conversationID, func(m *types.ExportedMessage) error {
+			for i := range m.Attachments {
+				m.Attachments[i].URL = attachmentURL(m.Attachments[i].URL)
+			}
+
+			return exp.write(w, m)
+		})
+		if err != nil {
+			log.Printf("export conversation %d: %v", conversationID, err)
+			return
+		}
+
+		if err := exp.end(w); err != nil {
+			log.Printf("export conversation %d: %v", conversationID, err)
+			return
+		}
+		w.Flush()
+	})
+
+	return nil
+}
+
+// publish sends the event to every participant of the conversation, and to
+// the extra users given.
+func (h *Handler) publish(conversationID int, event types.Event, extra ...int) {
+	participants, err := h.store.GetParticipants(conversationID)
+	if err != nil {
+		log.Printf("failed to get participants of conversation %d: %v", conversationID, err)
+		return
+	}
+
+	userIDs := append([]int{}, extra...)
+	for _, p := range participants {
+		userIDs = append(userIDs, p.UserID)
+	}
+
+	h.publisher.SendToUsers(userIDs, event)
+}
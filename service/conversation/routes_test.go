@@ -0,0 +1,324 @@
+package conversation
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConversationServiceHandlers(t *testing.T) {
+	editedAt := time.Date(2024, 7, 15, 10, 5, 0, 0, time.UTC)
+	conversationStore := &mockConversationStore{
+		participants: map[int]string{1: types.RoleAdmin},
+		messages: []types.ExportedMessage{
+			{
+				ID: 1, SenderID: 1, SenderName: "Jane Doe", Content: "hello <team>",
+				SentAt:      time.Date(2024, 7, 15, 10, 0, 0, 0, time.UTC),
+				Attachments: []types.ExportedAttachment{{FileName: "plan.pdf", URL: "attachments/plan.pdf"}},
+			},
+			{
+				ID: 2, SenderID: 2, SenderName: "John Roe", Content: "hi",
+				SentAt: time.Date(2024, 7, 15, 10, 1, 0, 0, time.UTC), EditedAt: &editedAt,
+				Attachments: []types.ExportedAttachment{},
+			},
+		},
+	}
+	publisher := &mockPublisher{}
+	dispatcher := &mockDispatcher{}
+	handler := NewHandler(conversationStore, &mockUserStore{}, publisher, dispatcher)
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	t.Run("should create a conversation", func(t *testing.T) {
+		payload := types.CreateConversationPayload{Name: "team", ParticipantIDs: []int{2, 3}}
+		req := newRequest(t, http.MethodPost, "/conversations", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, 1, conversationStore.creatorID)
+	})
+
+	t.Run("should export messages as json", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/conversations/1/export?format=json", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var export struct {
+			Messages []types.ExportedMessage `json:"messages"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&export))
+		assert.Len(t, export.Messages, 2)
+		assert.Equal(t, "Jane Doe", export.Messages[0].SenderName)
+		assert.Contains(t, export.Messages[0].Attachments[0].URL, "/chat-app-api/v1/attachments/plan.pdf")
+		assert.NotNil(t, export.Messages[1].EditedAt)
+	})
+
+	t.Run("should export messages as escaped html", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/conversations/1/export?format=html", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, string(body), "hello &lt;team&gt;")
+		assert.Contains(t, string(body), "plan.pdf</a>")
+	})
+
+	t.Run("should export messages as plain text", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/conversations/1/export?format=txt", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, string(body), "[2024-07-15T10:01:00Z] John Roe: hi (edited 2024-07-15T10:05:00Z)")
+	})
+
+	t.Run("should fail for an unknown format", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/conversations/1/export?format=pdf", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should restrict exports to participants", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/conversations/1/export", nil, 9)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should update the notification settings of a participant", func(t *testing.T) {
+		mutedUntil := time.Date(2024, 8, 10, 8, 0, 0, 0, time.UTC)
+		payload := types.UpdateNotificationSettingsPayload{Notifications: types.NotifyMentions, MutedUntil: &mutedUntil}
+		req := newRequest(t, http.MethodPut, "/conversations/1/notifications", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, types.NotifyMentions, conversationStore.notifications)
+		assert.Equal(t, sql.NullTime{Time: mutedUntil, Valid: true}, conversationStore.mutedUntil)
+	})
+
+	t.Run("should fail for an unknown notification level", func(t *testing.T) {
+		payload := types.UpdateNotificationSettingsPayload{Notifications: "sometimes"}
+		req := newRequest(t, http.MethodPut, "/conversations/1/notifications", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should restrict notification settings to participants", func(t *testing.T) {
+		payload := types.UpdateNotificationSettingsPayload{Notifications: types.NotifyNone}
+		req := newRequest(t, http.MethodPut, "/conversations/1/notifications", payload, 7)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, types.NotifyMentions, conversationStore.notifications)
+	})
+
+	t.Run("should not let the last admin leave", func(t *testing.T) {
+		conversationStore.participants[2] = types.RoleMember
+		req := newRequest(t, http.MethodPost, "/conversations/1/leave", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Contains(t, conversationStore.participants, 1)
+	})
+
+	t.Run("should leave a conversation and notify webhooks", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/conversations/1/leave", nil, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotContains(t, conversationStore.participants, 2)
+		assert.Equal(t, []string{types.WebhookEventMemberLeft}, dispatcher.events)
+		assert.Equal(t, types.EventMemberLeft, publisher.events[0].Type)
+		assert.Contains(t, publisher.userIDs[0], 2, "expected the user who left to be notified")
+	})
+}
+
+func newRequest(t *testing.T, method, target string, payload any, userID int) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+type mockConversationStore struct {
+	participants map[int]string
+	messages     []types.ExportedMessage
+	creatorID    int
+	// last notification settings saved
+	notifications string
+	mutedUntil    sql.NullTime
+}
+
+func (m *mockConversationStore) CreateConversation(name string, creatorID int, participantIDs []int) (*types.Conversation, error) {
+	m.creatorID = creatorID
+	return &types.Conversation{ID: 1}, nil
+}
+
+func (m *mockConversationStore) GetConversationByID(id int) (*types.Conversation, error) {
+	return &types.Conversation{ID: id}, nil
+}
+
+func (m *mockConversationStore) GetParticipant(conversationID, userID int) (*types.Participant, error) {
+	if role, ok := m.participants[userID]; ok {
+		return &types.Participant{ConversationID: conversationID, UserID: userID, Role: role}, nil
+	}
+	return nil, fmt.Errorf("participant not found")
+}
+
+func (m *mockConversationStore) GetParticipants(conversationID int) ([]types.Participant, error) {
+	participants := []types.Participant{}
+	for userID, role := range m.participants {
+		participants = append(participants, types.Participant{ConversationID: conversationID, UserID: userID, Role: role})
+	}
+	return participants, nil
+}
+
+func (m *mockConversationStore) RemoveParticipant(conversationID, userID int) error {
+	delete(m.participants, userID)
+	return nil
+}
+
+func (m *mockConversationStore) MarkRead(conversationID, userID, messageID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) GetContactIDs(userID int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) ExportMessages(conversationID int, fn func(*types.ExportedMessage) error) error {
+	for i := range m.messages {
+		msg := m.messages[i]
+		msg.Attachments = append([]types.ExportedAttachment{}, msg.Attachments...)
+		if err := fn(&msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockConversationStore) UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error {
+	m.notifications = notifications
+	m.mutedUntil = mutedUntil
+	return nil
+}
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
+
+type mockDispatcher struct {
+	events []string
+}
+
+func (m *mockDispatcher) Dispatch(conversationID int, event string, data any) {
+	m.events = append(m.events, event)
+}
+
+type mockPublisher struct {
+	events  []types.Event
+	userIDs [][]int
+}
+
+func (m *mockPublisher) SendToUser(userID int, event types.Event, exceptDevice string) {
+	m.SendToUsers([]int{userID}, event)
+}
+
+func (m *mockPublisher) SendToUsers(userIDs []int, event types.Event) {
+	m.events = append(m.events, event)
+	m.userIDs = append(m.userIDs, userIDs)
+}
@@ -0,0 +1,277 @@
+package conversation
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateConversation(name string, creatorID int, participantIDs []int) (*types.Conversation, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO conversations (name) VALUES (?)", sql.NullString{String: name, Valid: name != ""})
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("INSERT INTO conversation_participants (conversation_id, user_id, role) VALUES (?, ?, ?)", id, creatorID, types.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, userID := range participantIDs {
+		if userID == creatorID {
+			continue
+		}
+
+		_, err = tx.Exec("INSERT INTO conversation_participants (conversation_id, user_id, role) VALUES (?, ?, ?)", id, userID, types.RoleMember)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetConversationByID(int(id))
+}
+
+func (s *Store) GetConversationByID(id int) (*types.Conversation, error) {
+	rows, err := s.db.Query("SELECT * FROM conversations WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c := new(types.Conversation)
+	for rows.Next() {
+		c, err = scanRowIntoConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.ID == 0 {
+		return nil, fmt.Errorf("Conversation not found.")
+	}
+
+	return c, nil
+}
+
+func (s *Store) GetParticipant(conversationID, userID int) (*types.Participant, error) {
+	rows, err := s.db.Query("SELECT * FROM conversation_participants WHERE conversation_id = ? AND user_id = ?", conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	p := new(types.Participant)
+	for rows.Next() {
+		p, err = scanRowIntoParticipant(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.UserID == 0 {
+		return nil, fmt.Errorf("Participant not found.")
+	}
+
+	return p, nil
+}
+
+func (s *Store) GetParticipants(conversationID int) ([]types.Participant, error) {
+	rows, err := s.db.Query("SELECT * FROM conversation_participants WHERE conversation_id = ?", conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	participants := []types.Participant{}
+	for rows.Next() {
+		p, err := scanRowIntoParticipant(rows)
+		if err != nil {
+			return nil, err
+		}
+		participants = append(participants, *p)
+	}
+
+	return participants, nil
+}
+
+func (s *Store) RemoveParticipant(conversationID, userID int) error {
+	_, err := s.db.Exec("DELETE FROM conversation_participants WHERE conversation_id = ? AND user_id = ?;", conversationID, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarkRead moves the read marker of the user forward, it never goes back to
+// an older message.
+func (s *Store) MarkRead(conversationID, userID, messageID int) error {
+	_, err := s.db.Exec(
+		"UPDATE conversation_participants SET lastReadMessageId = ? WHERE conversation_id = ? AND user_id = ? AND (lastReadMessageId IS NULL OR lastReadMessageId < ?);",
+		messageID, conversationID, userID, messageID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error {
+	_, err := s.db.Exec(
+		"UPDATE conversation_participants SET notifications = ?, mutedUntil = ? WHERE conversation_id = ? AND user_id = ?;",
+		notifications, mutedUntil, conversationID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) GetContactIDs(userID int) ([]int, error) {
+	rows, err := s.db.Query(
+		`SELECT DISTINCT other.user_id FROM conversation_participants mine
+		JOIN conversation_participants other ON other.conversation_id = mine.conversation_id
+		WHERE mine.user_id = ? AND other.user_id <> ?`,
+		userID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// ExportMessages walks every message of a conversation in order, calling fn
+// once per message. Rows are read one at a time so large conversations are
+// never held in memory as a whole.
+func (s *Store) ExportMessages(conversationID int, fn func(*types.ExportedMessage) error) error {
+	rows, err := s.db.Query(
+		`SELECT m.id, m.conversation_id, COALESCE(m.sender_id, 0), COALESCE(CONCAT(u.firstName, ' ', u.lastName), m.senderName, ''),
+		m.content, m.sentAt, m.editedAt, a.fileName, a.path
+		FROM messages m
+		LEFT JOIN users u ON u.id = m.sender_id
+		LEFT JOIN message_attachments a ON a.message_id = m.id
+		WHERE m.conversation_id = ? AND m.deletedAt IS NULL AND m.heldAt IS NULL
+		ORDER BY m.id, a.id`,
+		conversationID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// attachments come back as one row each, so a message is only complete
+	// once a row with a different message id shows up
+	var current *types.ExportedMessage
+	for rows.Next() {
+		var (
+			m        types.ExportedMessage
+			editedAt sql.NullTime
+			fileName sql.NullString
+			path     sql.NullString
+		)
+
+		err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.SenderName, &m.Content, &m.SentAt, &editedAt, &fileName, &path)
+		if err != nil {
+			return err
+		}
+
+		if current == nil || current.ID != m.ID {
+			if current != nil {
+				if err := fn(current); err != nil {
+					return err
+				}
+			}
+
+			if editedAt.Valid {
+				m.EditedAt = &editedAt.Time
+			}
+			m.Attachments = []types.ExportedAttachment{}
+			current = &m
+		}
+
+		if path.Valid {
+			current.Attachments = append(current.Attachments, types.ExportedAttachment{
+				FileName: fileName.String,
+				URL:      path.String,
+			})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if current != nil {
+		return fn(current)
+	}
+
+	return nil
+}
+
+func scanRowIntoConversation(rows *sql.Rows) (*types.Conversation, error) {
+	c := new(types.Conversation)
+
+	err := rows.Scan(
+		&c.ID,
+		&c.Name,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func scanRowIntoParticipant(rows *sql.Rows) (*types.Participant, error) {
+	p := new(types.Participant)
+
+	err := rows.Scan(
+		&p.ConversationID,
+		&p.UserID,
+		&p.Role,
+		&p.JoinedAt,
+		&p.LastReadMessageID,
+		&p.Notifications,
+		&p.MutedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
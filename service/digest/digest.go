@@ -0,0 +1,230 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/mail"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+const (
+	// unread messages looked at for a single digest
+	maxMessages = 200
+	// messages quoted per conversation, the others are only counted
+	maxMessagesPerConversation = 3
+	maxContentLength           = 200
+)
+
+// periods are the digest frequencies a scheduler goes through.
+var periods = map[string]time.Duration{
+	types.DigestHourly: time.Hour,
+	types.DigestDaily:  24 * time.Hour,
+	types.DigestWeekly: 7 * 24 * time.Hour,
+}
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/digest.html"))
+	textTemplate = texttemplate.Must(texttemplate.ParseFS(templates, "templates/digest.txt"))
+)
+
+// Scheduler emails users who were away a summary of the messages they did
+// not read since their last digest, at the frequency they chose.
+type Scheduler struct {
+	store    types.DigestStore
+	mailer   types.Mailer
+	presence types.PresenceChecker
+	appURL   string
+	now      func() time.Time
+}
+
+// NewScheduler takes the URL digests link to for catching up.
+func NewScheduler(store types.DigestStore, mailer types.Mailer, presence types.PresenceChecker, appURL string) *Scheduler {
+	return &Scheduler{store: store, mailer: mailer, presence: presence, appURL: appURL, now: time.Now}
+}
+
+// Run sends the digests that are due every interval, until stop is closed.
+func (s *Scheduler) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sent, err := s.SendDue()
+			if err != nil {
+				log.Printf("digest: %v", err)
+			}
+			if sent > 0 {
+				log.Printf("digest: sent %d digests", sent)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// SendDue sends their digest to the users due for one and returns how many
+// were sent. A failed email is retried on the next run.
+func (s *Scheduler) SendDue() (int, error) {
+	now := s.now()
+
+	sent := 0
+	for frequency, period := range periods {
+		recipients, err := s.store.GetDueDigestRecipients(frequency, now.Add(-period))
+		if err != nil {
+			return sent, err
+		}
+
+		for _, r := range recipients {
+			// connected users see their messages as they come
+			if s.presence.IsOnline(r.UserID) {
+				continue
+			}
+
+			since := now.Add(-period)
+			if r.LastSentAt.Valid {
+				since = r.LastSentAt.Time
+			}
+
+			ok, err := s.send(r, since)
+			if err != nil {
+				log.Printf("digest: failed to send the digest of user %d: %v", r.UserID, err)
+				continue
+			}
+			if ok {
+				sent++
+			}
+
+			// with nothing to report the next digest covers a new period
+			if err := s.store.MarkDigestSent(r.UserID, now); err != nil {
+				log.Printf("digest: failed to record the digest of user %d: %v", r.UserID, err)
+			}
+		}
+	}
+
+	return sent, nil
+}
+
+// send reports whether there was anything to send.
+func (s *Scheduler) send(r types.DigestRecipient, since time.Time) (bool, error) {
+	messages, err := s.store.GetUnreadMessagesSince(r.UserID, since, maxMessages)
+	if err != nil {
+		return false, err
+	}
+	if len(messages) == 0 {
+		return false, nil
+	}
+
+	data := summarize(r.FirstName, messages)
+	data.AppURL = s.appURL
+
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, data); err != nil {
+		return false, err
+	}
+	if err := htmlTemplate.Execute(&html, data); err != nil {
+		return false, err
+	}
+
+	to := (&mail.Address{Name: r.FirstName, Address: r.Email}).String()
+	err = s.mailer.Send(types.Email{
+		To:      to,
+		Subject: subject(data),
+		Text:    text.String(),
+		HTML:    html.String(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+type digestData struct {
+	FirstName     string
+	Total         int
+	Conversations []digestConversation
+	AppURL        string
+}
+
+type digestConversation struct {
+	Name     string
+	Unread   int
+	Messages []digestMessage
+	// unread messages left out of the digest
+	More int
+}
+
+type digestMessage struct {
+	SenderName string
+	Content    string
+}
+
+// summarize groups the messages, newest first, by conversation. The
+// conversation with the latest message comes first and its most recent
+// messages are quoted in the order they were sent.
+func summarize(firstName string, messages []types.DigestMessage) digestData {
+	data := digestData{FirstName: firstName, Total: len(messages)}
+
+	index := map[int]int{}
+	for _, m := range messages {
+		i, ok := index[m.ConversationID]
+		if !ok {
+			name := m.ConversationName.String
+			if !m.ConversationName.Valid || name == "" {
+				name = fmt.Sprintf("Conversation with %s", m.SenderName)
+			}
+
+			i = len(data.Conversations)
+			index[m.ConversationID] = i
+			data.Conversations = append(data.Conversations, digestConversation{Name: name})
+		}
+
+		c := &data.Conversations[i]
+		c.Unread++
+		if len(c.Messages) == maxMessagesPerConversation {
+			c.More++
+			continue
+		}
+
+		content := truncate(m.Content, maxContentLength)
+		if m.Type == types.MessageTypeEncrypted {
+			content = "Encrypted message"
+		}
+		// newest first so far, prepending restores the sending order
+		c.Messages = append([]digestMessage{{SenderName: m.SenderName, Content: content}}, c.Messages...)
+	}
+
+	return data
+}
+
+func subject(data digestData) string {
+	if len(data.Conversations) == 1 {
+		return fmt.Sprintf("%d unread %s in %s", data.Total, plural(data.Total, "message"), data.Conversations[0].Name)
+	}
+	return fmt.Sprintf("%d unread messages in %d conversations", data.Total, len(data.Conversations))
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
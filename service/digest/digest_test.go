@@ -0,0 +1,109 @@
+package digest
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler(t *testing.T) {
+	now := time.Date(2024, 8, 10, 9, 0, 0, 0, time.UTC)
+	team := sql.NullString{String: "team <core>", Valid: true}
+
+	newScheduler := func() (*Scheduler, *mockDigestStore, *mockMailer) {
+		store := newMockDigestStore()
+		store.recipients[types.DigestDaily] = []types.DigestRecipient{
+			{UserID: 1, Email: "jane@example.com", FirstName: "Jane"},
+			{UserID: 2, Email: "john@example.com", FirstName: "John"},
+		}
+		store.recipients[types.DigestHourly] = []types.DigestRecipient{
+			{UserID: 3, Email: "ann@example.com", FirstName: "Ann", LastSentAt: sql.NullTime{Time: now.Add(-30 * time.Minute), Valid: true}},
+		}
+		store.messages[1] = []types.DigestMessage{
+			{ID: 9, ConversationID: 2, SenderName: "Ann Lee", Content: "ping", Type: types.MessageTypeText, SentAt: now.Add(-time.Hour)},
+			{ID: 8, ConversationID: 1, ConversationName: team, SenderName: "John Roe", Content: "<b>4</b>", Type: types.MessageTypeText, SentAt: now.Add(-2 * time.Hour)},
+			{ID: 7, ConversationID: 1, ConversationName: team, SenderName: "John Roe", Type: types.MessageTypeEncrypted, SentAt: now.Add(-3 * time.Hour)},
+			{ID: 6, ConversationID: 1, ConversationName: team, SenderName: "Ann Lee", Content: "2", Type: types.MessageTypeText, SentAt: now.Add(-4 * time.Hour)},
+			{ID: 5, ConversationID: 1, ConversationName: team, SenderName: "Ann Lee", Content: "1", Type: types.MessageTypeText, SentAt: now.Add(-5 * time.Hour)},
+			// before the period of the first digest
+			{ID: 1, ConversationID: 1, ConversationName: team, SenderName: "Ann Lee", Content: "old", Type: types.MessageTypeText, SentAt: now.Add(-48 * time.Hour)},
+		}
+		store.messages[3] = store.messages[1]
+
+		mailer := &mockMailer{}
+		s := NewScheduler(store, mailer, &mockPresence{online: map[int]bool{}}, "https://chat.example.com")
+		s.now = func() time.Time { return now }
+		return s, store, mailer
+	}
+
+	t.Run("should email the unread messages grouped by conversation", func(t *testing.T) {
+		s, store, mailer := newScheduler()
+
+		sent, err := s.SendDue()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, sent)
+
+		assert.Len(t, mailer.sent, 1)
+		email := mailer.sent[0]
+		assert.Equal(t, `"Jane" <jane@example.com>`, email.To)
+		assert.Equal(t, "5 unread messages in 2 conversations", email.Subject)
+
+		assert.Contains(t, email.Text, "Conversation with Ann Lee (1 unread)")
+		assert.Contains(t, email.Text, "team <core> (4 unread)\n  Ann Lee: 2\n  John Roe: Encrypted message\n  John Roe: <b>4</b>\n  and 1 more")
+		assert.NotContains(t, email.Text, "old")
+		assert.Less(t, strings.Index(email.Text, "Conversation with Ann Lee"), strings.Index(email.Text, "team <core>"))
+
+		assert.Contains(t, email.HTML, "team &lt;core&gt;")
+		assert.Contains(t, email.HTML, "&lt;b&gt;4&lt;/b&gt;")
+		assert.Contains(t, email.HTML, `href="https://chat.example.com"`)
+
+		// nothing to say to John, his next digest covers the next day
+		assert.True(t, store.settings[1].LastSentAt.Time.Equal(now))
+		assert.True(t, store.settings[2].LastSentAt.Time.Equal(now))
+		_, hourlyMarked := store.settings[3]
+		assert.False(t, hourlyMarked, "expected the hourly digest to wait for its period")
+	})
+
+	t.Run("should only cover the messages since the last digest", func(t *testing.T) {
+		s, store, mailer := newScheduler()
+		store.recipients[types.DigestHourly][0].LastSentAt.Time = now.Add(-90 * time.Minute)
+
+		_, err := s.SendDue()
+		assert.NoError(t, err)
+
+		for _, email := range mailer.sent {
+			if strings.Contains(email.To, "ann@example.com") {
+				assert.Equal(t, "1 unread message in Conversation with Ann Lee", email.Subject)
+				return
+			}
+		}
+		t.Fatal("expected an hourly digest")
+	})
+
+	t.Run("should skip connected users", func(t *testing.T) {
+		s, store, mailer := newScheduler()
+		s.presence = &mockPresence{online: map[int]bool{1: true}}
+
+		_, err := s.SendDue()
+		assert.NoError(t, err)
+
+		assert.Empty(t, mailer.sent)
+		assert.NotContains(t, store.settings, 1)
+	})
+
+	t.Run("should retry digests that failed to send", func(t *testing.T) {
+		s, store, mailer := newScheduler()
+		mailer.err = fmt.Errorf("connection refused")
+
+		sent, err := s.SendDue()
+		assert.NoError(t, err)
+
+		assert.Zero(t, sent)
+		assert.NotContains(t, store.settings, 1)
+	})
+}
@@ -0,0 +1,76 @@
+package digest
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	store     types.DigestStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.DigestStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Get("/profile/digest", auth.WithJWTAuth(h.handleGetDigestSettings, h.userStore))
+	router.Put("/profile/digest", auth.WithJWTAuth(h.handleUpdateDigestSettings, h.userStore))
+}
+
+// Get how often the user is emailed the messages they missed
+func (h *Handler) handleGetDigestSettings(c *fiber.Ctx) error {
+	settings, err := h.store.GetDigestSettings(auth.GetIDFromContext(c))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(settings)
+}
+
+// Change how often the user is emailed the messages they missed, or stop
+// the emails
+func (h *Handler) handleUpdateDigestSettings(c *fiber.Ctx) error {
+	var payload types.UpdateDigestSettingsPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	if err := h.store.UpdateDigestFrequency(userID, payload.Frequency); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	settings, err := h.store.GetDigestSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(settings)
+}
@@ -0,0 +1,202 @@
+package digest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDigestServiceHandlers(t *testing.T) {
+	store := newMockDigestStore()
+	handler := NewHandler(store, &mockUserStore{})
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	t.Run("should default to daily digests", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/profile/digest", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var settings types.DigestSettings
+		json.NewDecoder(resp.Body).Decode(&settings)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, types.DigestDaily, settings.Frequency)
+	})
+
+	t.Run("should change the frequency", func(t *testing.T) {
+		payload := types.UpdateDigestSettingsPayload{Frequency: types.DigestOff}
+		req := newRequest(t, http.MethodPut, "/profile/digest", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, types.DigestOff, store.settings[1].Frequency)
+	})
+
+	t.Run("should fail for an unknown frequency", func(t *testing.T) {
+		payload := types.UpdateDigestSettingsPayload{Frequency: "monthly"}
+		req := newRequest(t, http.MethodPut, "/profile/digest", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, types.DigestOff, store.settings[1].Frequency)
+	})
+}
+
+func newRequest(t *testing.T, method, target string, payload any, userID int) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+type mockDigestStore struct {
+	settings   map[int]*types.DigestSettings
+	recipients map[string][]types.DigestRecipient
+	messages   map[int][]types.DigestMessage
+}
+
+func newMockDigestStore() *mockDigestStore {
+	return &mockDigestStore{
+		settings:   map[int]*types.DigestSettings{},
+		recipients: map[string][]types.DigestRecipient{},
+		messages:   map[int][]types.DigestMessage{},
+	}
+}
+
+func (m *mockDigestStore) GetDigestSettings(userID int) (*types.DigestSettings, error) {
+	if s, ok := m.settings[userID]; ok {
+		return s, nil
+	}
+	return &types.DigestSettings{UserID: userID, Frequency: types.DigestDaily}, nil
+}
+
+func (m *mockDigestStore) UpdateDigestFrequency(userID int, frequency string) error {
+	s, _ := m.GetDigestSettings(userID)
+	s.Frequency = frequency
+	m.settings[userID] = s
+	return nil
+}
+
+func (m *mockDigestStore) GetDueDigestRecipients(frequency string, sentBefore time.Time) ([]types.DigestRecipient, error) {
+	due := []types.DigestRecipient{}
+	for _, r := range m.recipients[frequency] {
+		if s, ok := m.settings[r.UserID]; ok && s.LastSentAt.Valid {
+			r.LastSentAt = s.LastSentAt
+		}
+		if !r.LastSentAt.Valid || !r.LastSentAt.Time.After(sentBefore) {
+			due = append(due, r)
+		}
+	}
+	return due, nil
+}
+
+func (m *mockDigestStore) GetUnreadMessagesSince(userID int, since time.Time, limit int) ([]types.DigestMessage, error) {
+	messages := []types.DigestMessage{}
+	for _, msg := range m.messages[userID] {
+		if msg.SentAt.After(since) && len(messages) < limit {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func (m *mockDigestStore) MarkDigestSent(userID int, sentAt time.Time) error {
+	s, _ := m.GetDigestSettings(userID)
+	s.LastSentAt.Time, s.LastSentAt.Valid = sentAt, true
+	m.settings[userID] = s
+	return nil
+}
+
+type mockMailer struct {
+	mu   sync.Mutex
+	sent []types.Email
+	err  error
+}
+
+func (m *mockMailer) Send(email types.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, email)
+	return nil
+}
+
+type mockPresence struct {
+	online map[int]bool
+}
+
+func (m *mockPresence) IsOnline(userID int) bool {
+	return m.online[userID]
+}
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package digest
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetDigestSettings(userID int) (*types.DigestSettings, error) {
+	rows, err := s.db.Query("SELECT user_id, frequency, lastSentAt FROM digest_settings WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := &types.DigestSettings{UserID: userID, Frequency: types.DigestDaily}
+	for rows.Next() {
+		if err := rows.Scan(&settings.UserID, &settings.Frequency, &settings.LastSentAt); err != nil {
+			return nil, err
+		}
+	}
+
+	return settings, nil
+}
+
+func (s *Store) UpdateDigestFrequency(userID int, frequency string) error {
+	_, err := s.db.Exec(
+		"INSERT INTO digest_settings (user_id, frequency) VALUES (?, ?) ON DUPLICATE KEY UPDATE frequency = VALUES(frequency)",
+		userID, frequency,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) GetDueDigestRecipients(frequency string, sentBefore time.Time) ([]types.DigestRecipient, error) {
+	// users who never changed their settings get the default frequency
+	rows, err := s.db.Query(
+		`SELECT u.id, u.email, u.firstName, d.lastSentAt FROM users u
+		LEFT JOIN digest_settings d ON d.user_id = u.id
+		WHERE COALESCE(d.frequency, ?) = ? AND (d.lastSentAt IS NULL OR d.lastSentAt <= ?)
+		AND u.deletedAt IS NULL AND u.suspendedAt IS NULL`,
+		types.DigestDaily, frequency, sentBefore,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []types.DigestRecipient{}
+	for rows.Next() {
+		var r types.DigestRecipient
+		if err := rows.Scan(&r.UserID, &r.Email, &r.FirstName, &r.LastSentAt); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+
+	return recipients, nil
+}
+
+func (s *Store) GetUnreadMessagesSince(userID int, since time.Time, limit int) ([]types.DigestMessage, error) {
+	rows, err := s.db.Query(
+		`SELECT m.id, m.conversation_id, c.name, COALESCE(CONCAT(u.firstName, ' ', u.lastName), m.senderName, ''),
+		m.content, m.type, m.sentAt
+		FROM conversation_participants p
+		JOIN conversations c ON c.id = p.conversation_id
+		JOIN messages m ON m.conversation_id = p.conversation_id
+		LEFT JOIN users u ON u.id = m.sender_id
+		WHERE p.user_id = ? AND m.sentAt > ?
+		AND (p.lastReadMessageId IS NULL OR m.id > p.lastReadMessageId)
+		AND (m.sender_id IS NULL OR m.sender_id <> ?)
+		AND m.deletedAt IS NULL AND m.heldAt IS NULL
+		AND p.notifications <> ? AND (p.mutedUntil IS NULL OR p.mutedUntil <= ?)
+		ORDER BY m.id DESC LIMIT ?`,
+		userID, since, userID, types.NotifyNone, time.Now(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []types.DigestMessage{}
+	for rows.Next() {
+		var m types.DigestMessage
+		err := rows.Scan(&m.ID, &m.ConversationID, &m.ConversationName, &m.SenderName, &m.Content, &m.Type, &m.SentAt)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, nil
+}
+
+func (s *Store) MarkDigestSent(userID int, sentAt time.Time) error {
+	_, err := s.db.Exec(
+		"INSERT INTO digest_settings (user_id, lastSentAt) VALUES (?, ?) ON DUPLICATE KEY UPDATE lastSentAt = VALUES(lastSentAt)",
+		userID, sentAt,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package draft
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	store             types.DraftStore
+	conversationStore types.ConversationStore
+	userStore         types.UserStore
+	publisher         types.EventPublisher
+}
+
+func NewHandler(store types.DraftStore, conversationStore types.ConversationStore, userStore types.UserStore, publisher types.EventPublisher) *Handler {
+	return &Handler{
+		store:             store,
+		conversationStore: conversationStore,
+		userStore:         userStore,
+		publisher:         publisher,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Get("/conversations/:id/draft", auth.WithJWTAuth(h.handleGetDraft, h.userStore))
+	router.Put("/conversations/:id/draft", auth.WithJWTAuth(h.handleSaveDraft, h.userStore))
+	router.Delete("/conversations/:id/draft", auth.WithJWTAuth(h.handleDeleteDraft, h.userStore))
+}
+
+// Draft of the current user in a conversation
+func (h *Handler) handleGetDraft(c *fiber.Ctx) error {
+	conversationID, ok := h.requireParticipant(c)
+	if !ok {
+		return nil
+	}
+
+	draft, err := h.store.GetDraft(auth.GetIDFromContext(c), conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "draft not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(draft)
+}
+
+// Save the draft and push it to the user's other devices
+func (h *Handler) handleSaveDraft(c *fiber.Ctx) error {
+	conversationID, ok := h.requireParticipant(c)
+	if !ok {
+		return nil
+	}
+
+	var payload types.SaveDraftPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	// an emptied composer is the same as discarding the draft
+	if payload.Content == "" {
+		return h.handleDeleteDraft(c)
+	}
+
+	userID := auth.GetIDFromContext(c)
+	draft := types.Draft{
+		UserID:         userID,
+		ConversationID: conversationID,
+		Content:        payload.Content,
+		UpdatedAt:      time.Now(),
+	}
+
+	if err := h.store.SaveDraft(draft); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	h.publisher.SendToUser(userID, types.Event{
+		Type:    types.EventDraftUpdated,
+		Payload: draft,
+	}, utils.GetDeviceIDFromRequest(c))
+
+	return c.Status(fiber.StatusOK).JSON(draft)
+}
+
+// Discard the draft on every device
+func (h *Handler) handleDeleteDraft(c *fiber.Ctx) error {
+	conversationID, ok := h.requireParticipant(c)
+	if !ok {
+		return nil
+	}
+
+	userID := auth.GetIDFromContext(c)
+	if err := h.store.DeleteDraft(userID, conversationID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	h.publisher.SendToUser(userID, types.Event{
+		Type:    types.EventDraftDeleted,
+		Payload: fiber.Map{"conversationId": conversationID},
+	}, utils.GetDeviceIDFromRequest(c))
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "draft deleted",
+	})
+}
+
+// requireParticipant parses the conversation id and makes sure the current
+// user takes part in it. It writes the error response itself on failure.
+func (h *Handler) requireParticipant(c *fiber.Ctx) (int, bool) {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+		return 0, false
+	}
+
+	if _, err := h.conversationStore.GetParticipant(conversationID, auth.GetIDFromContext(c)); err != nil {
+		c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "not a participant of this conversation",
+		})
+		return 0, false
+	}
+
+	return conversationID, true
+}
@@ -0,0 +1,210 @@
+package draft
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDraftServiceHandlers(t *testing.T) {
+	draftStore := &mockDraftStore{drafts: map[int]types.Draft{}}
+	publisher := &mockPublisher{}
+	conversationStore := &mockConversationStore{participants: map[int]bool{1: true}}
+	handler := NewHandler(draftStore, conversationStore, &mockUserStore{}, publisher)
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	t.Run("should save the draft and push it to other devices", func(t *testing.T) {
+		req := newRequest(t, http.MethodPut, "/conversations/7/draft", types.SaveDraftPayload{Content: "half a thou"}, 1)
+		req.Header.Set("X-Device-ID", "phone")
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "half a thou", draftStore.drafts[7].Content)
+		assert.Equal(t, types.EventDraftUpdated, publisher.event.Type)
+		assert.Equal(t, "phone", publisher.exceptDevice)
+	})
+
+	t.Run("should return the saved draft", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/conversations/7/draft", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var draft types.Draft
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&draft))
+		assert.Equal(t, "half a thou", draft.Content)
+	})
+
+	t.Run("should delete the draft when saved empty", func(t *testing.T) {
+		req := newRequest(t, http.MethodPut, "/conversations/7/draft", types.SaveDraftPayload{}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotContains(t, draftStore.drafts, 7)
+		assert.Equal(t, types.EventDraftDeleted, publisher.event.Type)
+	})
+
+	t.Run("should restrict drafts to participants", func(t *testing.T) {
+		req := newRequest(t, http.MethodPut, "/conversations/7/draft", types.SaveDraftPayload{Content: "hi"}, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func newRequest(t *testing.T, method, target string, payload any, userID int) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+type mockDraftStore struct {
+	drafts map[int]types.Draft
+}
+
+func (m *mockDraftStore) GetDraft(userID, conversationID int) (*types.Draft, error) {
+	if d, ok := m.drafts[conversationID]; ok {
+		return &d, nil
+	}
+	return nil, fmt.Errorf("draft not found")
+}
+
+func (m *mockDraftStore) SaveDraft(draft types.Draft) error {
+	m.drafts[draft.ConversationID] = draft
+	return nil
+}
+
+func (m *mockDraftStore) DeleteDraft(userID, conversationID int) error {
+	delete(m.drafts, conversationID)
+	return nil
+}
+
+type mockPublisher struct {
+	event        types.Event
+	exceptDevice string
+}
+
+func (m *mockPublisher) SendToUser(userID int, event types.Event, exceptDevice string) {
+	m.event = event
+	m.exceptDevice = exceptDevice
+}
+
+func (m *mockPublisher) SendToUsers(userIDs []int, event types.Event) {
+	m.event = event
+}
+
+type mockConversationStore struct {
+	participants map[int]bool
+}
+
+func (m *mockConversationStore) CreateConversation(name string, creatorID int, participantIDs []int) (*types.Conversation, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) GetConversationByID(id int) (*types.Conversation, error) {
+	return &types.Conversation{ID: id}, nil
+}
+
+func (m *mockConversationStore) GetParticipant(conversationID, userID int) (*types.Participant, error) {
+	if m.participants[userID] {
+		return &types.Participant{ConversationID: conversationID, UserID: userID, Role: types.RoleMember}, nil
+	}
+	return nil, fmt.Errorf("participant not found")
+}
+
+func (m *mockConversationStore) GetParticipants(conversationID int) ([]types.Participant, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) RemoveParticipant(conversationID, userID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) MarkRead(conversationID, userID, messageID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) GetContactIDs(userID int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) ExportMessages(conversationID int, fn func(*types.ExportedMessage) error) error {
+	return nil
+}
+
+func (m *mockConversationStore) UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error {
+	return nil
+}
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
@@ -0,0 +1,73 @@
+package draft
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetDraft(userID, conversationID int) (*types.Draft, error) {
+	rows, err := s.db.Query("SELECT * FROM message_drafts WHERE user_id = ? AND conversation_id = ?", userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	d := new(types.Draft)
+	for rows.Next() {
+		d, err = scanRowIntoDraft(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if d.UserID == 0 {
+		return nil, fmt.Errorf("Draft not found.")
+	}
+
+	return d, nil
+}
+
+func (s *Store) SaveDraft(draft types.Draft) error {
+	_, err := s.db.Exec(
+		"INSERT INTO message_drafts (user_id, conversation_id, content) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE content = VALUES(content)",
+		draft.UserID, draft.ConversationID, draft.Content,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) DeleteDraft(userID, conversationID int) error {
+	_, err := s.db.Exec("DELETE FROM message_drafts WHERE user_id = ? AND conversation_id = ?;", userID, conversationID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func scanRowIntoDraft(rows *sql.Rows) (*types.Draft, error) {
+	d := new(types.Draft)
+
+	err := rows.Scan(
+		&d.UserID,
+		&d.ConversationID,
+		&d.Content,
+		&d.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
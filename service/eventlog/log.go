@@ -0,0 +1,102 @@
+package eventlog
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+// loggedEvents are the changes a client needs to rebuild its state, typing,
+// presence and drafts are only worth anything live.
+var loggedEvents = map[string]bool{
+	types.EventMessageCreated: true,
+	types.EventMessageUpdated: true,
+	types.EventMessageDeleted: true,
+	types.EventPollUpdated:    true,
+	types.EventReceiptRead:    true,
+	types.EventMemberJoined:   true,
+	types.EventMemberLeft:     true,
+	// reporters may well be offline when their report is handled
+	types.EventReportResolved: true,
+}
+
+// Log records the events going through it in the log of each recipient
+// before handing them to the next publisher, with their sequence number set.
+// Events that are not logged pass through untouched.
+type Log struct {
+	store types.EventLogStore
+	next  types.EventPublisher
+}
+
+func NewLog(store types.EventLogStore, next types.EventPublisher) *Log {
+	return &Log{store: store, next: next}
+}
+
+func (l *Log) SendToUser(userID int, event types.Event, exceptDevice string) {
+	if seqs := l.append([]int{userID}, event); seqs != nil {
+		event.Seq = seqs[userID]
+	}
+	l.next.SendToUser(userID, event, exceptDevice)
+}
+
+func (l *Log) SendToUsers(userIDs []int, event types.Event) {
+	seqs := l.append(userIDs, event)
+	if seqs == nil {
+		l.next.SendToUsers(userIDs, event)
+		return
+	}
+
+	// every user got its own sequence number
+	for _, userID := range userIDs {
+		e := event
+		e.Seq = seqs[userID]
+		l.next.SendToUser(userID, e, "")
+	}
+}
+
+// append returns nil when the event was not logged, it is still delivered
+// then, clients only miss it if they have to catch up later.
+func (l *Log) append(userIDs []int, event types.Event) map[int]uint64 {
+	if !loggedEvents[event.Type] || len(userIDs) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		log.Printf("eventlog: failed to encode %s event: %v", event.Type, err)
+		return nil
+	}
+
+	seqs, err := l.store.AppendUserEvents(userIDs, event.Type, payload)
+	if err != nil {
+		log.Printf("eventlog: failed to record %s event: %v", event.Type, err)
+		return nil
+	}
+
+	return seqs
+}
+
+// Compact drops the events older than retention every interval, until stop
+// is closed.
+func Compact(store types.EventLogStore, retention, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			deleted, err := store.DeleteUserEventsBefore(time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("eventlog: compaction failed: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("eventlog: compacted %d events", deleted)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package eventlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	store := newMockEventLogStore()
+	next := &mockPublisher{}
+	l := NewLog(store, next)
+
+	t.Run("should number logged events per user", func(t *testing.T) {
+		l.SendToUsers([]int{1, 2}, types.Event{Type: types.EventMessageCreated, Payload: map[string]int{"id": 1}})
+		l.SendToUsers([]int{1}, types.Event{Type: types.EventMessageUpdated, Payload: map[string]int{"id": 1}})
+
+		assert.Len(t, next.sent, 3)
+		assert.Equal(t, uint64(1), next.sent[0].event.Seq)
+		assert.Equal(t, uint64(1), next.sent[1].event.Seq)
+		assert.Equal(t, uint64(2), next.sent[2].event.Seq)
+		assert.Len(t, store.events[1], 2)
+		assert.JSONEq(t, `{"id":1}`, string(store.events[1][0].Payload))
+	})
+
+	t.Run("should pass other events through untouched", func(t *testing.T) {
+		l.SendToUser(1, types.Event{Type: types.EventDraftUpdated}, "laptop")
+
+		last := next.sent[len(next.sent)-1]
+		assert.Zero(t, last.event.Seq)
+		assert.Equal(t, "laptop", last.exceptDevice)
+		assert.Len(t, store.events[1], 2)
+	})
+
+	t.Run("should drop events older than the retention", func(t *testing.T) {
+		store.events[1][0].CreatedAt = time.Now().Add(-2 * time.Hour)
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			Compact(store, time.Hour, 10*time.Millisecond, stop)
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool {
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			return len(store.events[1]) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		close(stop)
+		<-done
+	})
+}
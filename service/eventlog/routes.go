@@ -0,0 +1,88 @@
+package eventlog
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPageSize = 200
+	maxPageSize     = 1000
+)
+
+type Handler struct {
+	store     types.EventLogStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.EventLogStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Get("/sync", auth.WithJWTAuth(h.handleSync, h.userStore))
+}
+
+// Return the events of the user since a sequence number, oldest first. A
+// client whose position is no longer in the log gets 410 and has to reload
+// everything, then carry on from the lastSeq of the response.
+func (h *Handler) handleSync(c *fiber.Ctx) error {
+	since, err := strconv.ParseUint(c.Query("since", "0"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid since",
+		})
+	}
+
+	limit := c.QueryInt("limit", defaultPageSize)
+	if limit <= 0 || limit > maxPageSize {
+		limit = defaultPageSize
+	}
+
+	userID := auth.GetIDFromContext(c)
+	lastSeq, err := h.store.GetLastUserEventSeq(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if since > lastSeq {
+		return resyncRequired(c, since, lastSeq)
+	}
+
+	// one more than asked tells whether there is another page
+	events, err := h.store.GetUserEventsSince(userID, since, limit+1)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// the events right after since were compacted away
+	if since < lastSeq && (len(events) == 0 || events[0].Seq != since+1) {
+		return resyncRequired(c, since, lastSeq)
+	}
+
+	hasMore := len(events) > limit
+	if hasMore {
+		events = events[:limit]
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"events":  events,
+		"lastSeq": lastSeq,
+		"hasMore": hasMore,
+	})
+}
+
+func resyncRequired(c *fiber.Ctx, since, lastSeq uint64) error {
+	return c.Status(fiber.StatusGone).JSON(fiber.Map{
+		"error":   fmt.Sprintf("events since %d are no longer available, a full resync is required", since),
+		"lastSeq": lastSeq,
+	})
+}
@@ -0,0 +1,225 @@
+package eventlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncHandler(t *testing.T) {
+	store := newMockEventLogStore()
+	for i := 0; i < 5; i++ {
+		store.AppendUserEvents([]int{1}, types.EventMessageCreated, []byte(fmt.Sprintf(`{"id":%d}`, i+1)))
+	}
+	handler := NewHandler(store, &mockUserStore{})
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	get := func(t *testing.T, query string) (*http.Response, map[string]any) {
+		t.Helper()
+
+		resp, err := app.Test(newRequest(t, http.MethodGet, "/sync"+query, 1))
+		assert.NoError(t, err, "error testing request")
+
+		var body map[string]any
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+
+		return resp, body
+	}
+
+	t.Run("should return the events since a sequence number", func(t *testing.T) {
+		resp, body := get(t, "?since=2")
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, body["events"], 3)
+		assert.Equal(t, float64(5), body["lastSeq"])
+		assert.Equal(t, false, body["hasMore"])
+	})
+
+	t.Run("should page through the events", func(t *testing.T) {
+		resp, body := get(t, "?since=0&limit=2")
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, body["events"], 2)
+		assert.Equal(t, true, body["hasMore"])
+	})
+
+	t.Run("should return nothing when up to date", func(t *testing.T) {
+		resp, body := get(t, "?since=5")
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, body["events"], 0)
+	})
+
+	t.Run("should require a resync once the events are compacted", func(t *testing.T) {
+		store.events[1] = store.events[1][3:]
+
+		resp, body := get(t, "?since=2")
+
+		assert.Equal(t, http.StatusGone, resp.StatusCode)
+		assert.Equal(t, float64(5), body["lastSeq"])
+
+		resp, _ = get(t, "?since=3")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should require a resync when ahead of the log", func(t *testing.T) {
+		resp, _ := get(t, "?since=9")
+
+		assert.Equal(t, http.StatusGone, resp.StatusCode)
+	})
+
+	t.Run("should fail on an invalid position", func(t *testing.T) {
+		resp, _ := get(t, "?since=-1")
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func newRequest(t *testing.T, method, target string, userID int) *http.Request {
+	t.Helper()
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+type mockEventLogStore struct {
+	mu      sync.Mutex
+	lastSeq map[int]uint64
+	events  map[int][]types.UserEvent
+}
+
+func newMockEventLogStore() *mockEventLogStore {
+	return &mockEventLogStore{lastSeq: map[int]uint64{}, events: map[int][]types.UserEvent{}}
+}
+
+func (m *mockEventLogStore) AppendUserEvents(userIDs []int, eventType string, payload []byte) (map[int]uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seqs := map[int]uint64{}
+	for _, userID := range userIDs {
+		m.lastSeq[userID]++
+		seqs[userID] = m.lastSeq[userID]
+		m.events[userID] = append(m.events[userID], types.UserEvent{
+			UserID:    userID,
+			Seq:       m.lastSeq[userID],
+			Type:      eventType,
+			Payload:   payload,
+			CreatedAt: time.Now(),
+		})
+	}
+	return seqs, nil
+}
+
+func (m *mockEventLogStore) GetUserEventsSince(userID int, since uint64, limit int) ([]types.UserEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []types.UserEvent{}
+	for _, e := range m.events[userID] {
+		if e.Seq > since && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *mockEventLogStore) GetLastUserEventSeq(userID int) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.lastSeq[userID], nil
+}
+
+func (m *mockEventLogStore) DeleteUserEventsBefore(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for userID, events := range m.events {
+		kept := []types.UserEvent{}
+		for _, e := range events {
+			if e.CreatedAt.Before(before) {
+				deleted++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		m.events[userID] = kept
+	}
+	return deleted, nil
+}
+
+type sentEvent struct {
+	userID       int
+	event        types.Event
+	exceptDevice string
+}
+
+type mockPublisher struct {
+	sent []sentEvent
+}
+
+func (m *mockPublisher) SendToUser(userID int, event types.Event, exceptDevice string) {
+	m.sent = append(m.sent, sentEvent{userID: userID, event: event, exceptDevice: exceptDevice})
+}
+
+func (m *mockPublisher) SendToUsers(userIDs []int, event types.Event) {
+	for _, userID := range userIDs {
+		m.SendToUser(userID, event, "")
+	}
+}
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
@@ -0,0 +1,131 @@
+package eventlog
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) AppendUserEvents(userIDs []int, eventType string, payload []byte) (map[int]uint64, error) {
+	// the sequence rows stay locked until commit, always taking them in the
+	// same order keeps concurrent appends from deadlocking
+	sorted := append([]int(nil), userIDs...)
+	sort.Ints(sorted)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	seqs := map[int]uint64{}
+	for _, userID := range sorted {
+		if _, ok := seqs[userID]; ok {
+			continue
+		}
+
+		// LAST_INSERT_ID(expr) hands the new value back through the result
+		res, err := tx.Exec(
+			"INSERT INTO user_event_sequences (user_id, lastSeq) VALUES (?, LAST_INSERT_ID(1)) ON DUPLICATE KEY UPDATE lastSeq = LAST_INSERT_ID(lastSeq + 1)",
+			userID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		seq, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO user_events (user_id, seq, type, payload) VALUES (?, ?, ?, ?)",
+			userID, seq, eventType, payload,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		seqs[userID] = uint64(seq)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return seqs, nil
+}
+
+// GetUserEventsSince returns the events of the user after since, oldest
+// first.
+func (s *Store) GetUserEventsSince(userID int, since uint64, limit int) ([]types.UserEvent, error) {
+	rows, err := s.db.Query(
+		"SELECT * FROM user_events WHERE user_id = ? AND seq > ? ORDER BY seq LIMIT ?",
+		userID, since, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []types.UserEvent{}
+	for rows.Next() {
+		e, err := scanRowIntoUserEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *e)
+	}
+
+	return events, nil
+}
+
+func (s *Store) GetLastUserEventSeq(userID int) (uint64, error) {
+	var seq uint64
+	err := s.db.QueryRow("SELECT lastSeq FROM user_event_sequences WHERE user_id = ?", userID).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+func (s *Store) DeleteUserEventsBefore(before time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM user_events WHERE createdAt < ?;", before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func scanRowIntoUserEvent(rows *sql.Rows) (*types.UserEvent, error) {
+	e := new(types.UserEvent)
+
+	err := rows.Scan(
+		&e.ID,
+		&e.UserID,
+		&e.Seq,
+		&e.Type,
+		&e.Payload,
+		&e.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
@@ -0,0 +1,113 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	// how long a key is remembered, retries are expected well within it
+	keyTTL = 24 * time.Hour
+)
+
+// New replays the response of a POST request when it is sent again with the
+// same Idempotency-Key header. Keys are scoped to the user, it goes inside
+// WithJWTAuth so that a revoked token gets no replay either.
+//
+// Responses are stored as they are, it is only meant for the routes sending
+// messages and never for those issuing tokens. Only responses below 500 are
+// remembered, a request that failed on the server can be retried with the
+// same key.
+func New(store types.IdempotencyStore, handlerFunc fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(HeaderKey)
+		if c.Method() != fiber.MethodPost || key == "" {
+			return handlerFunc(c)
+		}
+
+		if len(key) > maxKeyLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Idempotency-Key is too long",
+			})
+		}
+
+		userID := auth.GetIDFromContext(c)
+		fp := fingerprint(c)
+		record, created, err := store.ReserveIdempotencyKey(userID, key, fp)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		if !created {
+			return replay(c, record, fp)
+		}
+
+		if err := handlerFunc(c); err != nil {
+			release(store, userID, key)
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if status >= fiber.StatusInternalServerError {
+			release(store, userID, key)
+			return nil
+		}
+
+		if err := store.CompleteIdempotencyKey(userID, key, status, c.Response().Body()); err != nil {
+			log.Printf("failed to store response for idempotency key of user %d: %v", userID, err)
+		}
+
+		return nil
+	}
+}
+
+func replay(c *fiber.Ctx, record *types.IdempotencyRecord, fp string) error {
+	if record.Fingerprint != fp {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "Idempotency-Key was already used for a different request",
+		})
+	}
+
+	if !record.StatusCode.Valid {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "a request with this Idempotency-Key is still in progress",
+		})
+	}
+
+	c.Set(HeaderReplayed, "true")
+	if len(record.Body) > 0 {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+
+	return c.Status(int(record.StatusCode.Int64)).Send(record.Body)
+}
+
+func release(store types.IdempotencyStore, userID int, key string) {
+	if err := store.ReleaseIdempotencyKey(userID, key); err != nil {
+		log.Printf("failed to release idempotency key of user %d: %v", userID, err)
+	}
+}
+
+// fingerprint tells apart a retry from another request reusing the key.
+func fingerprint(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method()))
+	h.Write([]byte{0})
+	h.Write([]byte(c.OriginalURL()))
+	h.Write([]byte{0})
+	h.Write(c.Body())
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,165 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	store := &mockIdempotencyStore{records: map[string]*types.IdempotencyRecord{}}
+
+	calls := 0
+	app := fiber.New()
+	// stands in for WithJWTAuth
+	app.Use(func(c *fiber.Ctx) error {
+		userID, err := auth.ParseUserID(utils.GetTokenFromRequest(c))
+		if err != nil {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+		c.SetUserContext(context.WithValue(c.UserContext(), auth.UserKey, userID))
+		return c.Next()
+	})
+	app.Post("/things", New(store, func(c *fiber.Ctx) error {
+		calls++
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": calls})
+	}))
+	app.Post("/broken", New(store, func(c *fiber.Ctx) error {
+		calls++
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "boom"})
+	}))
+
+	t.Run("should run the handler the first time", func(t *testing.T) {
+		resp, err := app.Test(newRequest(t, "/things", `{"name":"a"}`, "key-1", 1))
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("should replay the response of a retry", func(t *testing.T) {
+		resp, err := app.Test(newRequest(t, "/things", `{"name":"a"}`, "key-1", 1))
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "true", resp.Header.Get(HeaderReplayed))
+		assert.JSONEq(t, `{"id":1}`, string(body))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("should reject a key reused for another request", func(t *testing.T) {
+		resp, err := app.Test(newRequest(t, "/things", `{"name":"b"}`, "key-1", 1))
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("should scope keys to the user", func(t *testing.T) {
+		resp, err := app.Test(newRequest(t, "/things", `{"name":"a"}`, "key-1", 2))
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("should reject a retry while the request is in progress", func(t *testing.T) {
+		store.records[recordKey(1, "key-2")] = &types.IdempotencyRecord{Fingerprint: fingerprintOf(`{"name":"a"}`)}
+
+		resp, err := app.Test(newRequest(t, "/things", `{"name":"a"}`, "key-2", 1))
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("should let a server error be retried", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			resp, err := app.Test(newRequest(t, "/broken", `{}`, "key-3", 1))
+			assert.NoError(t, err, "error testing request")
+			resp.Body.Close()
+		}
+
+		assert.Equal(t, 4, calls)
+		assert.NotContains(t, store.records, recordKey(1, "key-3"))
+	})
+}
+
+func newRequest(t *testing.T, target, body, key string, userID int) *http.Request {
+	t.Helper()
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(HeaderKey, key)
+
+	return req
+}
+
+// fingerprintOf computes the fingerprint of a request to /things.
+func fingerprintOf(body string) string {
+	app := fiber.New()
+
+	var fp string
+	app.Post("/things", func(c *fiber.Ctx) error {
+		fp = fingerprint(c)
+		return nil
+	})
+	app.Test(httptest.NewRequest(http.MethodPost, "/things", bytes.NewBufferString(body)))
+
+	return fp
+}
+
+func recordKey(userID int, key string) string {
+	return fmt.Sprintf("%d:%s", userID, key)
+}
+
+type mockIdempotencyStore struct {
+	records map[string]*types.IdempotencyRecord
+}
+
+func (m *mockIdempotencyStore) ReserveIdempotencyKey(userID int, key, fingerprint string) (*types.IdempotencyRecord, bool, error) {
+	if record, ok := m.records[recordKey(userID, key)]; ok {
+		return record, false, nil
+	}
+
+	record := &types.IdempotencyRecord{UserID: userID, Key: key, Fingerprint: fingerprint}
+	m.records[recordKey(userID, key)] = record
+	return record, true, nil
+}
+
+func (m *mockIdempotencyStore) CompleteIdempotencyKey(userID int, key string, statusCode int, body []byte) error {
+	record := m.records[recordKey(userID, key)]
+	record.StatusCode = sql.NullInt64{Int64: int64(statusCode), Valid: true}
+	record.Body = append([]byte(nil), body...)
+	return nil
+}
+
+func (m *mockIdempotencyStore) ReleaseIdempotencyKey(userID int, key string) error {
+	delete(m.records, recordKey(userID, key))
+	return nil
+}
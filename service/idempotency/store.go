@@ -0,0 +1,107 @@
+package idempotency
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) ReserveIdempotencyKey(userID int, key, fingerprint string) (*types.IdempotencyRecord, bool, error) {
+	// expired keys of the user are dropped so they can be used again
+	_, err := s.db.Exec(
+		"DELETE FROM idempotency_keys WHERE user_id = ? AND createdAt < NOW() - INTERVAL ? SECOND;",
+		userID, int(keyTTL.Seconds()),
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	res, err := s.db.Exec(
+		"INSERT IGNORE INTO idempotency_keys (user_id, idempotencyKey, fingerprint) VALUES (?, ?, ?)",
+		userID, key, fingerprint,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+
+	record, err := s.getIdempotencyKey(userID, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return record, affected == 1, nil
+}
+
+func (s *Store) CompleteIdempotencyKey(userID int, key string, statusCode int, body []byte) error {
+	_, err := s.db.Exec(
+		"UPDATE idempotency_keys SET statusCode = ?, body = ? WHERE user_id = ? AND idempotencyKey = ?;",
+		statusCode, body, userID, key,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) ReleaseIdempotencyKey(userID int, key string) error {
+	_, err := s.db.Exec("DELETE FROM idempotency_keys WHERE user_id = ? AND idempotencyKey = ?;", userID, key)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) getIdempotencyKey(userID int, key string) (*types.IdempotencyRecord, error) {
+	rows, err := s.db.Query("SELECT * FROM idempotency_keys WHERE user_id = ? AND idempotencyKey = ?", userID, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record := new(types.IdempotencyRecord)
+	for rows.Next() {
+		record, err = scanRowIntoIdempotencyRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if record.ID == 0 {
+		return nil, fmt.Errorf("Idempotency key not found.")
+	}
+
+	return record, nil
+}
+
+func scanRowIntoIdempotencyRecord(rows *sql.Rows) (*types.IdempotencyRecord, error) {
+	record := new(types.IdempotencyRecord)
+
+	err := rows.Scan(
+		&record.ID,
+		&record.UserID,
+		&record.Key,
+		&record.Fingerprint,
+		&record.StatusCode,
+		&record.Body,
+		&record.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
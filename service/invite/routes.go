@@ -0,0 +1,320 @@
+package invite
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	store             types.InviteStore
+	conversationStore types.ConversationStore
+	userStore         types.UserStore
+	publisher         types.EventPublisher
+	dispatcher        types.WebhookDispatcher
+}
+
+func NewHandler(store types.InviteStore, conversationStore types.ConversationStore, userStore types.UserStore, publisher types.EventPublisher, dispatcher types.WebhookDispatcher) *Handler {
+	return &Handler{store: store, conversationStore: conversationStore, userStore: userStore, publisher: publisher, dispatcher: dispatcher}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Post("/conversations/:id/invites", auth.WithJWTAuth(h.handleCreateInvite, h.userStore))
+	router.Get("/conversations/:id/invites", auth.WithJWTAuth(h.handleListInvites, h.userStore))
+	router.Delete("/conversations/:id/invites/:code", auth.WithJWTAuth(h.handleRevokeInvite, h.userStore))
+	router.Get("/conversations/:id/join-requests", auth.WithJWTAuth(h.handleListJoinRequests, h.userStore))
+	router.Post("/conversations/:id/join-requests/:requestID/approve", auth.WithJWTAuth(h.handleApproveJoinRequest, h.userStore))
+	router.Post("/conversations/:id/join-requests/:requestID/reject", auth.WithJWTAuth(h.handleRejectJoinRequest, h.userStore))
+	router.Post("/invites/:code/accept", auth.WithJWTAuth(h.handleAcceptInvite, h.userStore))
+}
+
+// Generate an invite link for a conversation
+func (h *Handler) handleCreateInvite(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	var payload types.CreateInvitePayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	code, err := utils.RandomString(16)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	invite := types.Invite{
+		ConversationID:   conversationID,
+		CreatedBy:        auth.GetIDFromContext(c),
+		Code:             code,
+		MaxUses:          sql.NullInt64{Int64: payload.MaxUses, Valid: payload.MaxUses > 0},
+		RequiresApproval: payload.RequiresApproval,
+	}
+	if payload.ExpiresInSeconds > 0 {
+		invite.ExpiresAt = sql.NullTime{
+			Time:  time.Now().Add(time.Second * time.Duration(payload.ExpiresInSeconds)),
+			Valid: true,
+		}
+	}
+
+	created, err := h.store.CreateInvite(invite)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// List the invites of a conversation
+func (h *Handler) handleListInvites(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	invites, err := h.store.GetInvitesByConversationID(conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(invites)
+}
+
+// Revoke an invite link
+func (h *Handler) handleRevokeInvite(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	invite, err := h.store.GetInviteByCode(c.Params("code"))
+	if err != nil || invite.ConversationID != conversationID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "invite not found",
+		})
+	}
+
+	if err := h.store.RevokeInvite(invite.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "invite revoked",
+	})
+}
+
+// Join a conversation through an invite link
+func (h *Handler) handleAcceptInvite(c *fiber.Ctx) error {
+	invite, err := h.store.GetInviteByCode(c.Params("code"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "invite not found",
+		})
+	}
+
+	if err := checkInvite(invite); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	if _, err := h.conversationStore.GetParticipant(invite.ConversationID, userID); err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "already a participant of this conversation",
+		})
+	}
+
+	if invite.RequiresApproval {
+		pending, err := h.store.HasPendingJoinRequest(invite.ConversationID, userID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if pending {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "a join request is already pending",
+			})
+		}
+
+		request, err := h.store.CreateJoinRequest(invite.ID, userID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(request)
+	}
+
+	if err := h.store.AcceptInvite(invite.ID, userID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	h.memberJoined(invite.ConversationID, userID)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":        "joined conversation",
+		"conversationId": invite.ConversationID,
+	})
+}
+
+// List the pending join requests of a conversation
+func (h *Handler) handleListJoinRequests(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	requests, err := h.store.GetPendingJoinRequests(conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(requests)
+}
+
+// Approve a pending join request
+func (h *Handler) handleApproveJoinRequest(c *fiber.Ctx) error {
+	return h.resolveJoinRequest(c, func(request *types.JoinRequest, adminID int) error {
+		if err := h.store.ApproveJoinRequest(request.ID, adminID); err != nil {
+			return err
+		}
+
+		h.memberJoined(request.ConversationID, request.UserID)
+		return nil
+	}, "join request approved")
+}
+
+// Reject a pending join request
+func (h *Handler) handleRejectJoinRequest(c *fiber.Ctx) error {
+	return h.resolveJoinRequest(c, func(request *types.JoinRequest, adminID int) error {
+		return h.store.RejectJoinRequest(request.ID, adminID)
+	}, "join request rejected")
+}
+
+func (h *Handler) resolveJoinRequest(c *fiber.Ctx, resolve func(request *types.JoinRequest, adminID int) error, message string) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	requestID, err := c.ParamsInt("requestID")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid join request id",
+		})
+	}
+
+	request, err := h.store.GetJoinRequestByID(requestID)
+	if err != nil || request.ConversationID != conversationID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "join request not found",
+		})
+	}
+
+	if err := resolve(request, auth.GetIDFromContext(c)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": message,
+	})
+}
+
+// requireAdmin parses the conversation id and makes sure the current user is
+// one of its admins. It writes the error response itself when the check fails.
+func (h *Handler) requireAdmin(c *fiber.Ctx) (int, bool) {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+		return 0, false
+	}
+
+	p, err := h.conversationStore.GetParticipant(conversationID, auth.GetIDFromContext(c))
+	if err != nil || p.Role != types.RoleAdmin {
+		c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only conversation admins can manage invites",
+		})
+		return 0, false
+	}
+
+	return conversationID, true
+}
+
+func checkInvite(invite *types.Invite) error {
+	if invite.RevokedAt.Valid {
+		return fmt.Errorf("invite has been revoked")
+	}
+
+	if invite.ExpiresAt.Valid && time.Now().After(invite.ExpiresAt.Time) {
+		return fmt.Errorf("invite has expired")
+	}
+
+	if invite.MaxUses.Valid && int64(invite.Uses) >= invite.MaxUses.Int64 {
+		return fmt.Errorf("invite has reached its maximum uses")
+	}
+
+	return nil
+}
+
+// memberJoined tells the participants, the new one included, and the
+// webhooks of the conversation that a user joined it.
+func (h *Handler) memberJoined(conversationID, userID int) {
+	h.dispatcher.Dispatch(conversationID, types.WebhookEventMemberJoined, fiber.Map{"userId": userID})
+
+	participants, err := h.conversationStore.GetParticipants(conversationID)
+	if err != nil {
+		log.Printf("failed to get participants of conversation %d: %v", conversationID, err)
+		return
+	}
+
+	userIDs := make([]int, 0, len(participants))
+	for _, p := range participants {
+		userIDs = append(userIDs, p.UserID)
+	}
+
+	h.publisher.SendToUsers(userIDs, types.Event{
+		Type:    types.EventMemberJoined,
+		Payload: fiber.Map{"conversationId": conversationID, "userId": userID},
+	})
+}
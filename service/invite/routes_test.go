@@ -0,0 +1,308 @@
+package invite
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInviteServiceHandlers(t *testing.T) {
+	inviteStore := &mockInviteStore{
+		invites: map[string]*types.Invite{
+			"open":     {ID: 1, ConversationID: 1, Code: "open"},
+			"approval": {ID: 2, ConversationID: 1, Code: "approval", RequiresApproval: true},
+			"expired":  {ID: 3, ConversationID: 1, Code: "expired", ExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}},
+			"used":     {ID: 4, ConversationID: 1, Code: "used", Uses: 2, MaxUses: sql.NullInt64{Int64: 2, Valid: true}},
+		},
+	}
+	conversationStore := &mockConversationStore{
+		participants: map[int]string{1: types.RoleAdmin, 2: types.RoleMember},
+	}
+	publisher := &mockPublisher{}
+	dispatcher := &mockDispatcher{}
+	handler := NewHandler(inviteStore, conversationStore, &mockUserStore{}, publisher, dispatcher)
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	t.Run("should only let admins create invites", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/conversations/1/invites", types.CreateInvitePayload{}, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should create an invite with expiry and max uses", func(t *testing.T) {
+		payload := types.CreateInvitePayload{ExpiresInSeconds: 3600, MaxUses: 5}
+		req := newRequest(t, http.MethodPost, "/conversations/1/invites", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.NotNil(t, inviteStore.created)
+		assert.NotEmpty(t, inviteStore.created.Code)
+		assert.Equal(t, int64(5), inviteStore.created.MaxUses.Int64)
+		assert.True(t, inviteStore.created.ExpiresAt.Valid)
+	})
+
+	t.Run("should add the user when accepting an invite", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/invites/open/accept", nil, 3)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, []int{3}, inviteStore.accepted)
+		assert.Equal(t, []string{types.WebhookEventMemberJoined}, dispatcher.events)
+		assert.Equal(t, types.EventMemberJoined, publisher.events[0].Type)
+		assert.ElementsMatch(t, []int{1, 2}, publisher.userIDs[0])
+	})
+
+	t.Run("should queue a join request when approval is required", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/invites/approval/accept", nil, 4)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, []int{4}, inviteStore.requested)
+	})
+
+	t.Run("should fail if a join request is already pending", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/invites/approval/accept", nil, 4)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, []int{4}, inviteStore.requested)
+	})
+
+	t.Run("should reject expired or exhausted invites", func(t *testing.T) {
+		for _, code := range []string{"expired", "used"} {
+			req := newRequest(t, http.MethodPost, fmt.Sprintf("/invites/%s/accept", code), nil, 5)
+
+			resp, err := app.Test(req)
+			assert.NoError(t, err, "error testing request")
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "invite %s", code)
+		}
+	})
+
+	t.Run("should fail if the user is already a participant", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/invites/open/accept", nil, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+}
+
+func newRequest(t *testing.T, method, target string, payload any, userID int) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+type mockInviteStore struct {
+	invites   map[string]*types.Invite
+	created   *types.Invite
+	accepted  []int
+	requested []int
+}
+
+func (m *mockInviteStore) CreateInvite(invite types.Invite) (*types.Invite, error) {
+	m.created = &invite
+	return &invite, nil
+}
+
+func (m *mockInviteStore) GetInviteByCode(code string) (*types.Invite, error) {
+	if i, ok := m.invites[code]; ok {
+		return i, nil
+	}
+	return nil, fmt.Errorf("invite not found")
+}
+
+func (m *mockInviteStore) GetInvitesByConversationID(conversationID int) ([]types.Invite, error) {
+	return nil, nil
+}
+
+func (m *mockInviteStore) RevokeInvite(inviteID int) error {
+	return nil
+}
+
+func (m *mockInviteStore) AcceptInvite(inviteID, userID int) error {
+	m.accepted = append(m.accepted, userID)
+	return nil
+}
+
+func (m *mockInviteStore) CreateJoinRequest(inviteID, userID int) (*types.JoinRequest, error) {
+	m.requested = append(m.requested, userID)
+	return &types.JoinRequest{ID: 1, InviteID: inviteID, UserID: userID, Status: types.JoinRequestPending}, nil
+}
+
+func (m *mockInviteStore) GetJoinRequestByID(id int) (*types.JoinRequest, error) {
+	return nil, fmt.Errorf("join request not found")
+}
+
+func (m *mockInviteStore) GetPendingJoinRequests(conversationID int) ([]types.JoinRequest, error) {
+	return nil, nil
+}
+
+func (m *mockInviteStore) HasPendingJoinRequest(conversationID, userID int) (bool, error) {
+	for _, id := range m.requested {
+		if id == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockInviteStore) ApproveJoinRequest(id, adminID int) error {
+	return nil
+}
+
+func (m *mockInviteStore) RejectJoinRequest(id, adminID int) error {
+	return nil
+}
+
+type mockConversationStore struct {
+	participants map[int]string
+}
+
+func (m *mockConversationStore) CreateConversation(name string, creatorID int, participantIDs []int) (*types.Conversation, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) GetConversationByID(id int) (*types.Conversation, error) {
+	return &types.Conversation{ID: id}, nil
+}
+
+func (m *mockConversationStore) GetParticipant(conversationID, userID int) (*types.Participant, error) {
+	if role, ok := m.participants[userID]; ok {
+		return &types.Participant{ConversationID: conversationID, UserID: userID, Role: role}, nil
+	}
+	return nil, fmt.Errorf("participant not found")
+}
+
+func (m *mockConversationStore) GetParticipants(conversationID int) ([]types.Participant, error) {
+	participants := []types.Participant{}
+	for userID, role := range m.participants {
+		participants = append(participants, types.Participant{ConversationID: conversationID, UserID: userID, Role: role})
+	}
+	return participants, nil
+}
+
+func (m *mockConversationStore) RemoveParticipant(conversationID, userID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) MarkRead(conversationID, userID, messageID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) GetContactIDs(userID int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) ExportMessages(conversationID int, fn func(*types.ExportedMessage) error) error {
+	return nil
+}
+
+func (m *mockConversationStore) UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error {
+	return nil
+}
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
+
+type mockDispatcher struct {
+	events []string
+}
+
+func (m *mockDispatcher) Dispatch(conversationID int, event string, data any) {
+	m.events = append(m.events, event)
+}
+
+type mockPublisher struct {
+	events  []types.Event
+	userIDs [][]int
+}
+
+func (m *mockPublisher) SendToUser(userID int, event types.Event, exceptDevice string) {
+	m.SendToUsers([]int{userID}, event)
+}
+
+func (m *mockPublisher) SendToUsers(userIDs []int, event types.Event) {
+	m.events = append(m.events, event)
+	m.userIDs = append(m.userIDs, userIDs)
+}
@@ -0,0 +1,329 @@
+package invite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/go-sql-driver/mysql"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateInvite(invite types.Invite) (*types.Invite, error) {
+	_, err := s.db.Exec(
+		"INSERT INTO conversation_invites (conversation_id, created_by, code, maxUses, requiresApproval, expiresAt) VALUES (?, ?, ?, ?, ?, ?)",
+		invite.ConversationID, invite.CreatedBy, invite.Code, invite.MaxUses, invite.RequiresApproval, invite.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetInviteByCode(invite.Code)
+}
+
+func (s *Store) GetInviteByCode(code string) (*types.Invite, error) {
+	rows, err := s.db.Query("SELECT * FROM conversation_invites WHERE code = ?", code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	i := new(types.Invite)
+	for rows.Next() {
+		i, err = scanRowIntoInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if i.ID == 0 {
+		return nil, fmt.Errorf("Invite not found.")
+	}
+
+	return i, nil
+}
+
+func (s *Store) GetInvitesByConversationID(conversationID int) ([]types.Invite, error) {
+	rows, err := s.db.Query("SELECT * FROM conversation_invites WHERE conversation_id = ? ORDER BY createdAt DESC", conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []types.Invite{}
+	for rows.Next() {
+		i, err := scanRowIntoInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, *i)
+	}
+
+	return invites, nil
+}
+
+func (s *Store) RevokeInvite(inviteID int) error {
+	_, err := s.db.Exec("UPDATE conversation_invites SET revokedAt = CURRENT_TIMESTAMP WHERE id = ? AND revokedAt IS NULL;", inviteID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AcceptInvite consumes one use of the invite and adds the user to its
+// conversation in a single transaction.
+func (s *Store) AcceptInvite(inviteID, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	conversationID, err := useInvite(tx, inviteID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO conversation_participants (conversation_id, user_id, role) VALUES (?, ?, ?)", conversationID, userID, types.RoleMember)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateJoinRequest consumes one use of the invite and queues the user for
+// admin approval. A second pending request of the user breaks the unique key
+// and rolls the use back.
+func (s *Store) CreateJoinRequest(inviteID, userID int) (*types.JoinRequest, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	conversationID, err := useInvite(tx, inviteID)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec("INSERT INTO conversation_join_requests (conversation_id, user_id, invite_id) VALUES (?, ?, ?)", conversationID, userID, inviteID)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return nil, fmt.Errorf("Join request already pending.")
+		}
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetJoinRequestByID(int(id))
+}
+
+// joinRequestColumns leaves out the generated pending column, which only
+// backs the unique key on pending requests.
+const joinRequestColumns = "id, conversation_id, user_id, invite_id, status, resolved_by, resolvedAt, createdAt"
+
+func (s *Store) GetJoinRequestByID(id int) (*types.JoinRequest, error) {
+	rows, err := s.db.Query("SELECT "+joinRequestColumns+" FROM conversation_join_requests WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := new(types.JoinRequest)
+	for rows.Next() {
+		r, err = scanRowIntoJoinRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.ID == 0 {
+		return nil, fmt.Errorf("Join request not found.")
+	}
+
+	return r, nil
+}
+
+func (s *Store) GetPendingJoinRequests(conversationID int) ([]types.JoinRequest, error) {
+	rows, err := s.db.Query("SELECT "+joinRequestColumns+" FROM conversation_join_requests WHERE conversation_id = ? AND status = ? ORDER BY createdAt", conversationID, types.JoinRequestPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []types.JoinRequest{}
+	for rows.Next() {
+		r, err := scanRowIntoJoinRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *r)
+	}
+
+	return requests, nil
+}
+
+func (s *Store) HasPendingJoinRequest(conversationID, userID int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM conversation_join_requests WHERE conversation_id = ? AND user_id = ? AND status = ?)",
+		conversationID, userID, types.JoinRequestPending,
+	).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (s *Store) ApproveJoinRequest(id, adminID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := resolveJoinRequest(tx, id, adminID, types.JoinRequestApproved); err != nil {
+		return err
+	}
+
+	// the user may have joined through another invite meanwhile
+	_, err = tx.Exec(
+		"INSERT INTO conversation_participants (conversation_id, user_id, role) SELECT conversation_id, user_id, ? FROM conversation_join_requests WHERE id = ? ON DUPLICATE KEY UPDATE role = role",
+		types.RoleMember, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) RejectJoinRequest(id, adminID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := resolveJoinRequest(tx, id, adminID, types.JoinRequestRejected); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// useInvite increments the use counter of a live invite and returns its
+// conversation. The guarded UPDATE makes the max-use check race free.
+func useInvite(tx *sql.Tx, inviteID int) (int, error) {
+	res, err := tx.Exec(
+		`UPDATE conversation_invites SET uses = uses + 1
+		WHERE id = ? AND revokedAt IS NULL
+		AND (expiresAt IS NULL OR expiresAt > CURRENT_TIMESTAMP)
+		AND (maxUses IS NULL OR uses < maxUses);`,
+		inviteID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, fmt.Errorf("Invite is no longer valid.")
+	}
+
+	var conversationID int
+	err = tx.QueryRow("SELECT conversation_id FROM conversation_invites WHERE id = ?", inviteID).Scan(&conversationID)
+	if err != nil {
+		return 0, err
+	}
+
+	return conversationID, nil
+}
+
+func resolveJoinRequest(tx *sql.Tx, id, adminID int, status string) error {
+	res, err := tx.Exec(
+		"UPDATE conversation_join_requests SET status = ?, resolved_by = ?, resolvedAt = CURRENT_TIMESTAMP WHERE id = ? AND status = ?;",
+		status, adminID, id, types.JoinRequestPending,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("Join request already resolved.")
+	}
+
+	return nil
+}
+
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+func scanRowIntoInvite(rows *sql.Rows) (*types.Invite, error) {
+	i := new(types.Invite)
+
+	err := rows.Scan(
+		&i.ID,
+		&i.ConversationID,
+		&i.CreatedBy,
+		&i.Code,
+		&i.MaxUses,
+		&i.Uses,
+		&i.RequiresApproval,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func scanRowIntoJoinRequest(rows *sql.Rows) (*types.JoinRequest, error) {
+	r := new(types.JoinRequest)
+
+	err := rows.Scan(
+		&r.ID,
+		&r.ConversationID,
+		&r.UserID,
+		&r.InviteID,
+		&r.Status,
+		&r.ResolvedBy,
+		&r.ResolvedAt,
+		&r.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
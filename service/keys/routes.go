@@ -0,0 +1,254 @@
+package keys
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxDeviceIDLength = 64
+
+type Handler struct {
+	store             types.KeyStore
+	conversationStore types.ConversationStore
+	userStore         types.UserStore
+}
+
+func NewHandler(store types.KeyStore, conversationStore types.ConversationStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, conversationStore: conversationStore, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Put("/keys", auth.WithJWTAuth(h.handlePublishKeys, h.userStore))
+	router.Delete("/keys", auth.WithJWTAuth(h.handleDeleteKeys, h.userStore))
+	router.Post("/keys/one-time-prekeys", auth.WithJWTAuth(h.handleAddOneTimePrekeys, h.userStore))
+	router.Get("/keys/one-time-prekeys/count", auth.WithJWTAuth(h.handleCountOneTimePrekeys, h.userStore))
+	router.Get("/users/:id/keys", auth.WithJWTAuth(h.handleGetPrekeyBundles, h.userStore))
+}
+
+// Publish the identity key and signed prekey of the current device, with an
+// optional first batch of one-time prekeys
+func (h *Handler) handlePublishKeys(c *fiber.Ctx) error {
+	deviceID, ok := requireDevice(c)
+	if !ok {
+		return nil
+	}
+
+	var payload types.PublishDeviceKeysPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	err := h.store.SetDeviceKeys(types.DeviceKeys{
+		UserID:       userID,
+		DeviceID:     deviceID,
+		IdentityKey:  payload.IdentityKey,
+		SignedPrekey: payload.SignedPrekey,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if len(payload.OneTimePrekeys) > 0 {
+		if err := h.store.AddOneTimePrekeys(userID, deviceID, payload.OneTimePrekeys); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	return h.respondWithCount(c, userID, deviceID)
+}
+
+// Remove the keys of the current device, before signing it out for good
+func (h *Handler) handleDeleteKeys(c *fiber.Ctx) error {
+	deviceID, ok := requireDevice(c)
+	if !ok {
+		return nil
+	}
+
+	if err := h.store.DeleteDeviceKeys(auth.GetIDFromContext(c), deviceID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Upload another batch of one-time prekeys for the current device
+func (h *Handler) handleAddOneTimePrekeys(c *fiber.Ctx) error {
+	deviceID, ok := requireDevice(c)
+	if !ok {
+		return nil
+	}
+
+	var payload types.AddOneTimePrekeysPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	if _, err := h.findDevice(userID, deviceID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "publish the keys of the device first",
+		})
+	}
+
+	if err := h.store.AddOneTimePrekeys(userID, deviceID, payload.OneTimePrekeys); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return h.respondWithCount(c, userID, deviceID)
+}
+
+// Tell how many one-time prekeys of the current device are left, so the
+// client knows when to upload more
+func (h *Handler) handleCountOneTimePrekeys(c *fiber.Ctx) error {
+	deviceID, ok := requireDevice(c)
+	if !ok {
+		return nil
+	}
+
+	return h.respondWithCount(c, auth.GetIDFromContext(c), deviceID)
+}
+
+// Fetch a prekey bundle for every device of a user, each one consuming a
+// one-time prekey of its device
+func (h *Handler) handleGetPrekeyBundles(c *fiber.Ctx) error {
+	targetID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid user id",
+		})
+	}
+
+	// keys are handed out to the people the user talks to, not to anyone
+	// enumerating ids
+	userID := auth.GetIDFromContext(c)
+	if targetID != userID {
+		contacts, err := h.conversationStore.GetContactIDs(userID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if !slices.Contains(contacts, targetID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "you do not share a conversation with this user",
+			})
+		}
+	}
+
+	devices, err := h.store.GetDeviceKeys(targetID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	bundles := []types.PrekeyBundle{}
+	for _, device := range devices {
+		// the own device of the caller does not need a session with itself
+		if targetID == userID && device.DeviceID == utils.GetDeviceIDFromRequest(c) {
+			continue
+		}
+
+		prekey, err := h.store.ClaimOneTimePrekey(targetID, device.DeviceID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		bundles = append(bundles, types.PrekeyBundle{DeviceKeys: device, OneTimePrekey: prekey})
+	}
+
+	if len(bundles) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "the user has not published any keys",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(bundles)
+}
+
+func (h *Handler) findDevice(userID int, deviceID string) (*types.DeviceKeys, error) {
+	devices, err := h.store.GetDeviceKeys(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range devices {
+		if d.DeviceID == deviceID {
+			return &d, nil
+		}
+	}
+
+	return nil, fmt.Errorf("device not found")
+}
+
+func (h *Handler) respondWithCount(c *fiber.Ctx, userID int, deviceID string) error {
+	count, err := h.store.CountOneTimePrekeys(userID, deviceID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"deviceId":           deviceID,
+		"oneTimePrekeysLeft": count,
+	})
+}
+
+// requireDevice returns the id of the device making the request, keys belong
+// to a device rather than to the user. It writes the error response itself
+// when the id is missing.
+func requireDevice(c *fiber.Ctx) (string, bool) {
+	deviceID := utils.GetDeviceIDFromRequest(c)
+	if deviceID == "" || len(deviceID) > maxDeviceIDLength {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "a device id of at most 64 characters is required",
+		})
+		return "", false
+	}
+
+	return deviceID, true
+}
@@ -0,0 +1,308 @@
+package keys
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyHandlers(t *testing.T) {
+	store := &mockKeyStore{devices: map[string]types.DeviceKeys{}, prekeys: map[string][]types.OneTimePrekey{}}
+	conversationStore := &mockConversationStore{contacts: map[int][]int{1: {2}, 2: {1}}}
+	handler := NewHandler(store, conversationStore, &mockUserStore{})
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	publish := types.PublishDeviceKeysPayload{
+		IdentityKey:  "aWRlbnRpdHk=",
+		SignedPrekey: types.SignedPrekey{KeyID: 1, PublicKey: "cHJla2V5", Signature: "c2lnbmF0dXJl"},
+		OneTimePrekeys: []types.OneTimePrekey{
+			{KeyID: 1, PublicKey: "b25l"},
+			{KeyID: 2, PublicKey: "dHdv"},
+		},
+	}
+
+	t.Run("should require a device id", func(t *testing.T) {
+		req := newRequest(t, http.MethodPut, "/keys", publish, 2, "")
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should fail if the keys are not base64", func(t *testing.T) {
+		payload := publish
+		payload.IdentityKey = "not base64!"
+		req := newRequest(t, http.MethodPut, "/keys", payload, 2, "phone")
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should publish the keys of a device", func(t *testing.T) {
+		req := newRequest(t, http.MethodPut, "/keys", publish, 2, "phone")
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var body map[string]any
+		json.NewDecoder(resp.Body).Decode(&body)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, float64(2), body["oneTimePrekeysLeft"])
+		assert.Equal(t, "aWRlbnRpdHk=", store.devices["2:phone"].IdentityKey)
+	})
+
+	t.Run("should add one-time prekeys", func(t *testing.T) {
+		payload := types.AddOneTimePrekeysPayload{OneTimePrekeys: []types.OneTimePrekey{{KeyID: 3, PublicKey: "dGhyZWU="}}}
+		req := newRequest(t, http.MethodPost, "/keys/one-time-prekeys", payload, 2, "phone")
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, store.prekeys["2:phone"], 3)
+	})
+
+	t.Run("should not add one-time prekeys to an unknown device", func(t *testing.T) {
+		payload := types.AddOneTimePrekeysPayload{OneTimePrekeys: []types.OneTimePrekey{{KeyID: 1, PublicKey: "b25l"}}}
+		req := newRequest(t, http.MethodPost, "/keys/one-time-prekeys", payload, 2, "tablet")
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should hand out a bundle consuming a one-time prekey", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/users/2/keys", nil, 1, "laptop")
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var bundles []types.PrekeyBundle
+		json.NewDecoder(resp.Body).Decode(&bundles)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, bundles, 1)
+		assert.Equal(t, "phone", bundles[0].DeviceID)
+		assert.Equal(t, uint32(1), bundles[0].OneTimePrekey.KeyID)
+		assert.Len(t, store.prekeys["2:phone"], 2)
+	})
+
+	t.Run("should hand out bundles without one-time prekey once they ran out", func(t *testing.T) {
+		store.prekeys["2:phone"] = nil
+		req := newRequest(t, http.MethodGet, "/users/2/keys", nil, 1, "laptop")
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var bundles []types.PrekeyBundle
+		json.NewDecoder(resp.Body).Decode(&bundles)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Nil(t, bundles[0].OneTimePrekey)
+	})
+
+	t.Run("should only hand out keys to contacts", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/users/2/keys", nil, 3, "laptop")
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should fail if the user has no keys", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/users/1/keys", nil, 2, "phone")
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("should delete the keys of a device", func(t *testing.T) {
+		req := newRequest(t, http.MethodDelete, "/keys", nil, 2, "phone")
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.NotContains(t, store.devices, "2:phone")
+	})
+}
+
+func newRequest(t *testing.T, method, target string, payload any, userID int, deviceID string) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if deviceID != "" {
+		req.Header.Set("X-Device-ID", deviceID)
+	}
+
+	return req
+}
+
+func deviceKey(userID int, deviceID string) string {
+	return fmt.Sprintf("%d:%s", userID, deviceID)
+}
+
+type mockKeyStore struct {
+	devices map[string]types.DeviceKeys
+	prekeys map[string][]types.OneTimePrekey
+}
+
+func (m *mockKeyStore) SetDeviceKeys(keys types.DeviceKeys) error {
+	m.devices[deviceKey(keys.UserID, keys.DeviceID)] = keys
+	return nil
+}
+
+func (m *mockKeyStore) GetDeviceKeys(userID int) ([]types.DeviceKeys, error) {
+	devices := []types.DeviceKeys{}
+	for _, d := range m.devices {
+		if d.UserID == userID {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+func (m *mockKeyStore) DeleteDeviceKeys(userID int, deviceID string) error {
+	delete(m.devices, deviceKey(userID, deviceID))
+	delete(m.prekeys, deviceKey(userID, deviceID))
+	return nil
+}
+
+func (m *mockKeyStore) AddOneTimePrekeys(userID int, deviceID string, prekeys []types.OneTimePrekey) error {
+	key := deviceKey(userID, deviceID)
+	m.prekeys[key] = append(m.prekeys[key], prekeys...)
+	return nil
+}
+
+func (m *mockKeyStore) CountOneTimePrekeys(userID int, deviceID string) (int, error) {
+	return len(m.prekeys[deviceKey(userID, deviceID)]), nil
+}
+
+func (m *mockKeyStore) ClaimOneTimePrekey(userID int, deviceID string) (*types.OneTimePrekey, error) {
+	key := deviceKey(userID, deviceID)
+	if len(m.prekeys[key]) == 0 {
+		return nil, nil
+	}
+
+	prekey := m.prekeys[key][0]
+	m.prekeys[key] = m.prekeys[key][1:]
+	return &prekey, nil
+}
+
+type mockConversationStore struct {
+	contacts map[int][]int
+}
+
+func (m *mockConversationStore) CreateConversation(name string, creatorID int, participantIDs []int) (*types.Conversation, error) {
+	return &types.Conversation{ID: 1}, nil
+}
+
+func (m *mockConversationStore) GetConversationByID(id int) (*types.Conversation, error) {
+	return &types.Conversation{ID: id}, nil
+}
+
+func (m *mockConversationStore) GetParticipant(conversationID, userID int) (*types.Participant, error) {
+	return &types.Participant{ConversationID: conversationID, UserID: userID}, nil
+}
+
+func (m *mockConversationStore) GetParticipants(conversationID int) ([]types.Participant, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) RemoveParticipant(conversationID, userID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) MarkRead(conversationID, userID, messageID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) GetContactIDs(userID int) ([]int, error) {
+	return m.contacts[userID], nil
+}
+
+func (m *mockConversationStore) ExportMessages(conversationID int, fn func(*types.ExportedMessage) error) error {
+	return nil
+}
+
+func (m *mockConversationStore) UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error {
+	return nil
+}
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
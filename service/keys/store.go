@@ -0,0 +1,177 @@
+package keys
+
+import (
+	"database/sql"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) SetDeviceKeys(keys types.DeviceKeys) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var identityKey string
+	err = tx.QueryRow(
+		"SELECT identityKey FROM device_keys WHERE user_id = ? AND deviceId = ? FOR UPDATE",
+		keys.UserID, keys.DeviceID,
+	).Scan(&identityKey)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	// one-time prekeys were generated along the previous identity key
+	if err == nil && identityKey != keys.IdentityKey {
+		_, err := tx.Exec("DELETE FROM one_time_prekeys WHERE user_id = ? AND deviceId = ?;", keys.UserID, keys.DeviceID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO device_keys (user_id, deviceId, identityKey, signedPrekeyId, signedPrekey, signedPrekeySignature) VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE identityKey = VALUES(identityKey), signedPrekeyId = VALUES(signedPrekeyId), signedPrekey = VALUES(signedPrekey), signedPrekeySignature = VALUES(signedPrekeySignature)`,
+		keys.UserID, keys.DeviceID, keys.IdentityKey, keys.SignedPrekey.KeyID, keys.SignedPrekey.PublicKey, keys.SignedPrekey.Signature,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) GetDeviceKeys(userID int) ([]types.DeviceKeys, error) {
+	rows, err := s.db.Query("SELECT * FROM device_keys WHERE user_id = ? ORDER BY deviceId", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []types.DeviceKeys{}
+	for rows.Next() {
+		keys, err := scanRowIntoDeviceKeys(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *keys)
+	}
+
+	return devices, nil
+}
+
+func (s *Store) DeleteDeviceKeys(userID int, deviceID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM one_time_prekeys WHERE user_id = ? AND deviceId = ?;", userID, deviceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM device_keys WHERE user_id = ? AND deviceId = ?;", userID, deviceID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) AddOneTimePrekeys(userID int, deviceID string, prekeys []types.OneTimePrekey) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// a key id uploaded twice keeps its first public key
+	for _, p := range prekeys {
+		_, err := tx.Exec(
+			"INSERT IGNORE INTO one_time_prekeys (user_id, deviceId, keyId, publicKey) VALUES (?, ?, ?, ?)",
+			userID, deviceID, p.KeyID, p.PublicKey,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) CountOneTimePrekeys(userID int, deviceID string) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM one_time_prekeys WHERE user_id = ? AND deviceId = ?", userID, deviceID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *Store) ClaimOneTimePrekey(userID int, deviceID string) (*types.OneTimePrekey, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED lets concurrent claims each take a different key instead
+	// of queueing behind the same row
+	var (
+		id     int
+		prekey types.OneTimePrekey
+	)
+	err = tx.QueryRow(
+		"SELECT id, keyId, publicKey FROM one_time_prekeys WHERE user_id = ? AND deviceId = ? ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED",
+		userID, deviceID,
+	).Scan(&id, &prekey.KeyID, &prekey.PublicKey)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM one_time_prekeys WHERE id = ?;", id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &prekey, nil
+}
+
+func scanRowIntoDeviceKeys(rows *sql.Rows) (*types.DeviceKeys, error) {
+	keys := new(types.DeviceKeys)
+
+	var id int
+	err := rows.Scan(
+		&id,
+		&keys.UserID,
+		&keys.DeviceID,
+		&keys.IdentityKey,
+		&keys.SignedPrekey.KeyID,
+		&keys.SignedPrekey.PublicKey,
+		&keys.SignedPrekey.Signature,
+		&keys.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,20 @@
+package mailer
+
+import (
+	"log"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+// Log writes emails to the log instead of sending them, for development
+// without an SMTP relay.
+type Log struct{}
+
+func NewLog() *Log {
+	return &Log{}
+}
+
+func (m *Log) Send(email types.Email) error {
+	log.Printf("mailer: email to %s, %q\n%s", email.To, email.Subject, email.Text)
+	return nil
+}
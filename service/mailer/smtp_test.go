@@ -0,0 +1,148 @@
+package mailer
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMTP(t *testing.T) {
+	server := newSMTPServer(t)
+	defer server.Close()
+
+	host, port, _ := net.SplitHostPort(server.Addr().String())
+
+	t.Run("should send a message with text and html parts", func(t *testing.T) {
+		m, err := NewSMTP(host, port, "", "", "Chat App <no-reply@example.com>")
+		assert.NoError(t, err)
+
+		err = m.Send(types.Email{
+			To:      "Jane Doe <jane@example.com>",
+			Subject: "3 unread messages — team",
+			Text:    "Hi Jane,\nyou missed 3 messages.",
+			HTML:    "<p>Hi Jane,</p><p>you missed 3 messages.</p>",
+		})
+		assert.NoError(t, err)
+
+		received := <-server.received
+		assert.Equal(t, "no-reply@example.com", received.from)
+		assert.Equal(t, []string{"jane@example.com"}, received.to)
+
+		msg, err := mail.ReadMessage(strings.NewReader(received.data))
+		assert.NoError(t, err)
+
+		subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		assert.Equal(t, "3 unread messages — team", subject)
+
+		mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		assert.NoError(t, err)
+		assert.Equal(t, "multipart/alternative", mediaType)
+
+		parts := map[string]string{}
+		r := multipart.NewReader(msg.Body, params["boundary"])
+		for {
+			part, err := r.NextRawPart()
+			if err != nil {
+				break
+			}
+			content, _ := io.ReadAll(quotedprintable.NewReader(part))
+			parts[strings.Split(part.Header.Get("Content-Type"), ";")[0]] = string(content)
+		}
+		assert.Equal(t, "Hi Jane,\nyou missed 3 messages.", parts["text/plain"])
+		assert.Equal(t, "<p>Hi Jane,</p><p>you missed 3 messages.</p>", parts["text/html"])
+	})
+
+	t.Run("should reject invalid addresses", func(t *testing.T) {
+		_, err := NewSMTP(host, port, "", "", "not an address")
+		assert.Error(t, err)
+
+		m, _ := NewSMTP(host, port, "", "", "no-reply@example.com")
+		assert.Error(t, m.Send(types.Email{To: "jane", Subject: "hi", Text: "hi"}))
+	})
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is a bare SMTP stand-in accepting every message it is given.
+type smtpServer struct {
+	net.Listener
+	received chan smtpMessage
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &smtpServer{Listener: l, received: make(chan smtpMessage, 10)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	c := textproto.NewConn(conn)
+	defer c.Close()
+
+	var msg smtpMessage
+	c.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			c.PrintfLine("250-localhost")
+			c.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			// parameters such as BODY=8BITMIME follow the address
+			from, _, _ := strings.Cut(strings.TrimPrefix(arg, "FROM:"), " ")
+			msg = smtpMessage{from: strings.Trim(from, "<>")}
+			c.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			c.PrintfLine("250 OK")
+		case "DATA":
+			c.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(c.DotReader())
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			s.received <- msg
+			c.PrintfLine("250 OK")
+		case "QUIT":
+			c.PrintfLine("221 bye")
+			return
+		default:
+			c.PrintfLine("502 not implemented")
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package message
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Post a poll to a conversation
+func (h *Handler) handleCreatePoll(c *fiber.Ctx) error {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+	}
+
+	var payload types.CreatePollPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	if _, err := h.conversationStore.GetParticipant(conversationID, userID); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "not a participant of this conversation",
+		})
+	}
+
+	poll := types.Poll{
+		Question:       payload.Question,
+		MultipleChoice: payload.MultipleChoice,
+		Anonymous:      payload.Anonymous,
+	}
+	if payload.ClosesInSeconds > 0 {
+		poll.ClosesAt = sql.NullTime{
+			Time:  time.Now().Add(time.Second * time.Duration(payload.ClosesInSeconds)),
+			Valid: true,
+		}
+	}
+	for _, text := range payload.Options {
+		poll.Options = append(poll.Options, types.PollOption{Text: text})
+	}
+
+	message := types.Message{
+		ConversationID: conversationID,
+		SenderID:       userID,
+	}
+	moderated, err := h.moderatePoll(&message, &poll)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	created, err := h.pollStore.CreatePoll(message, poll)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	for _, m := range moderated {
+		h.recordModeration(message, m.content, m.verdict, created.ID)
+	}
+
+	// the others only see a held poll once a conversation admin releases it
+	if !created.HeldAt.Valid {
+		h.publish(conversationID, types.Event{Type: types.EventMessageCreated, Payload: created})
+		h.dispatcher.Dispatch(conversationID, types.WebhookEventMessageCreated, created)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// moderatedText is a text of a poll the moderators did not simply allow.
+type moderatedText struct {
+	content string
+	verdict *types.ModerationVerdict
+}
+
+// moderatePoll runs the question and every option through the moderators,
+// the way SendMessage does with the content of a message. Masked texts are
+// replaced in the poll, a single held text holds the whole poll and a single
+// rejected one rejects it.
+func (h *Handler) moderatePoll(message *types.Message, poll *types.Poll) ([]moderatedText, error) {
+	texts := []*string{&poll.Question}
+	for i := range poll.Options {
+		texts = append(texts, &poll.Options[i].Text)
+	}
+
+	var moderated []moderatedText
+	for _, text := range texts {
+		verdict, err := h.moderator.Moderate(*text)
+		if err != nil {
+			return nil, err
+		}
+
+		switch verdict.Action {
+		case types.ModerationReject:
+			h.recordModeration(*message, *text, verdict, 0)
+			return nil, fmt.Errorf("poll rejected: %s", verdict.Reason)
+		case types.ModerationHold:
+			message.HeldAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+		if verdict.Action != types.ModerationAllow {
+			moderated = append(moderated, moderatedText{content: *text, verdict: verdict})
+		}
+		*text = verdict.Text
+	}
+
+	return moderated, nil
+}
+
+// Vote on a poll, replacing any earlier vote of the user
+func (h *Handler) handleVotePoll(c *fiber.Ctx) error {
+	var payload types.VotePollPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	poll, conversationID, err := h.getOpenPoll(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := checkVote(poll, payload.OptionIDs); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.pollStore.SetPollVotes(poll.ID, auth.GetIDFromContext(c), payload.OptionIDs); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return h.publishPollResults(c, poll.ID, conversationID)
+}
+
+// Take back the vote of the user
+func (h *Handler) handleRetractPollVote(c *fiber.Ctx) error {
+	poll, conversationID, err := h.getOpenPoll(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.pollStore.RetractPollVotes(poll.ID, auth.GetIDFromContext(c)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return h.publishPollResults(c, poll.ID, conversationID)
+}
+
+// getOpenPoll loads the poll of the request and makes sure the user can
+// still vote on it. It also returns the conversation the poll was posted in.
+func (h *Handler) getOpenPoll(c *fiber.Ctx) (*types.Poll, int, error) {
+	pollID, err := c.ParamsInt("id")
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid poll id")
+	}
+
+	poll, err := h.pollStore.GetPollByID(pollID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("poll not found")
+	}
+
+	message, err := h.store.GetMessageByID(poll.MessageID)
+	if err != nil || message.DeletedAt.Valid {
+		return nil, 0, fmt.Errorf("poll not found")
+	}
+
+	if _, err := h.conversationStore.GetParticipant(message.ConversationID, auth.GetIDFromContext(c)); err != nil {
+		return nil, 0, fmt.Errorf("poll not found")
+	}
+
+	if poll.ClosesAt.Valid && time.Now().After(poll.ClosesAt.Time) {
+		return nil, 0, fmt.Errorf("poll is closed")
+	}
+
+	return poll, message.ConversationID, nil
+}
+
+func (h *Handler) publishPollResults(c *fiber.Ctx, pollID, conversationID int) error {
+	poll, err := h.pollStore.GetPollByID(pollID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	h.publish(conversationID, types.Event{Type: types.EventPollUpdated, Payload: poll})
+
+	return c.Status(fiber.StatusOK).JSON(poll)
+}
+
+func checkVote(poll *types.Poll, optionIDs []int) error {
+	if !poll.MultipleChoice && len(optionIDs) > 1 {
+		return fmt.Errorf("poll only allows a single choice")
+	}
+
+	valid := map[int]bool{}
+	for _, o := range poll.Options {
+		valid[o.ID] = true
+	}
+
+	seen := map[int]bool{}
+	for _, id := range optionIDs {
+		if !valid[id] {
+			return fmt.Errorf("option %d is not part of this poll", id)
+		}
+		if seen[id] {
+			return fmt.Errorf("option %d was chosen twice", id)
+		}
+		seen[id] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,704 @@
+package message
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/service/idempotency"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type Handler struct {
+	store             types.MessageStore
+	pollStore         types.PollStore
+	conversationStore types.ConversationStore
+	draftStore        types.DraftStore
+	userStore         types.UserStore
+	publisher         types.EventPublisher
+	dispatcher        types.WebhookDispatcher
+	commands          types.CommandExecutor
+	moderator         types.MessageModerator
+	idempotencyStore  types.IdempotencyStore
+}
+
+func NewHandler(store types.MessageStore, pollStore types.PollStore, conversationStore types.ConversationStore, draftStore types.DraftStore, userStore types.UserStore, publisher types.EventPublisher, dispatcher types.WebhookDispatcher, commands types.CommandExecutor, moderator types.MessageModerator, idempotencyStore types.IdempotencyStore) *Handler {
+	return &Handler{
+		store:             store,
+		pollStore:         pollStore,
+		conversationStore: conversationStore,
+		draftStore:        draftStore,
+		userStore:         userStore,
+		publisher:         publisher,
+		dispatcher:        dispatcher,
+		commands:          commands,
+		moderator:         moderator,
+		idempotencyStore:  idempotencyStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Get("/conversations/:id/messages", auth.WithJWTAuth(h.handleGetMessages, h.userStore))
+	router.Post("/conversations/:id/messages", auth.WithJWTAuth(auth.RequireVerifiedEmail(idempotency.New(h.idempotencyStore, h.handleSendMessage)), h.userStore))
+	router.Patch("/messages/:id", auth.WithJWTAuth(h.handleUpdateMessage, h.userStore))
+	router.Delete("/messages/:id", auth.WithJWTAuth(h.handleDeleteMessage, h.userStore))
+	router.Post("/conversations/:id/read", auth.WithJWTAuth(h.handleMarkRead, h.userStore))
+	router.Get("/conversations/:id/held-messages", auth.WithJWTAuth(h.handleGetHeldMessages, h.userStore))
+	router.Post("/messages/:id/release", auth.WithJWTAuth(h.handleReleaseMessage, h.userStore))
+	router.Post("/conversations/:id/polls", auth.WithJWTAuth(auth.RequireVerifiedEmail(idempotency.New(h.idempotencyStore, h.handleCreatePoll)), h.userStore))
+	router.Post("/polls/:id/votes", auth.WithJWTAuth(h.handleVotePoll, h.userStore))
+	router.Delete("/polls/:id/votes", auth.WithJWTAuth(h.handleRetractPollVote, h.userStore))
+}
+
+// List the messages of a conversation, newest first
+func (h *Handler) handleGetMessages(c *fiber.Ctx) error {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	if _, err := h.conversationStore.GetParticipant(conversationID, userID); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "not a participant of this conversation",
+		})
+	}
+
+	limit := c.QueryInt("limit", defaultPageSize)
+	if limit <= 0 || limit > maxPageSize {
+		limit = defaultPageSize
+	}
+
+	messages, err := h.store.GetMessagesByConversationID(conversationID, c.QueryInt("before"), limit)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.attachCiphertexts(messages, userID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(messages)
+}
+
+// Send a message to a conversation
+func (h *Handler) handleSendMessage(c *fiber.Ctx) error {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+	}
+
+	var payload types.SendMessagePayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	if _, err := h.conversationStore.GetParticipant(conversationID, userID); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "not a participant of this conversation",
+		})
+	}
+
+	// a retried send returns the message stored the first time, before
+	// commands get a chance to run twice
+	clientMessageID := sql.NullString{String: payload.ClientMessageID, Valid: payload.ClientMessageID != ""}
+	if clientMessageID.Valid {
+		if existing, err := h.store.GetMessageByClientID(userID, clientMessageID.String); err == nil {
+			message, err := h.forSender(existing)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			return c.Status(fiber.StatusOK).JSON(message)
+		}
+	}
+
+	if len(payload.Ciphertexts) > 0 {
+		return h.sendEncryptedMessage(c, conversationID, payload.Ciphertexts, clientMessageID)
+	}
+
+	message, result, err := h.SendMessage(types.Message{
+		ConversationID:  conversationID,
+		SenderID:        userID,
+		Content:         payload.Content,
+		ClientMessageID: clientMessageID,
+	}, utils.GetDeviceIDFromRequest(c))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if result != nil {
+		return c.Status(fiber.StatusOK).JSON(result)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(message)
+}
+
+// sendEncryptedMessage sends a message of an end-to-end encrypted
+// conversation. Commands are not run, the server cannot read them.
+func (h *Handler) sendEncryptedMessage(c *fiber.Ctx, conversationID int, payload []types.DeviceCiphertextPayload, clientMessageID sql.NullString) error {
+	participants, err := h.conversationStore.GetParticipants(conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	isParticipant := map[int]bool{}
+	for _, p := range participants {
+		isParticipant[p.UserID] = true
+	}
+
+	ciphertexts := make([]types.DeviceCiphertext, 0, len(payload))
+	for _, p := range payload {
+		if !isParticipant[p.UserID] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("user %d is not a participant of this conversation", p.UserID),
+			})
+		}
+		ciphertexts = append(ciphertexts, types.DeviceCiphertext{UserID: p.UserID, DeviceID: p.DeviceID, Ciphertext: p.Ciphertext})
+	}
+
+	message, _, err := h.SendMessage(types.Message{
+		ConversationID:  conversationID,
+		SenderID:        auth.GetIDFromContext(c),
+		Type:            types.MessageTypeEncrypted,
+		ClientMessageID: clientMessageID,
+		Ciphertexts:     ciphertexts,
+	}, utils.GetDeviceIDFromRequest(c))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(message)
+}
+
+// Edit a message, only its sender can
+func (h *Handler) handleUpdateMessage(c *fiber.Ctx) error {
+	var payload types.UpdateMessagePayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	message, err := h.getMessage(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if message.SenderID != auth.GetIDFromContext(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only the sender can edit a message",
+		})
+	}
+
+	if message.Type != types.MessageTypeText {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("%s messages cannot be edited", message.Type),
+		})
+	}
+
+	// the members have not seen it yet, an edit would be published before it
+	if message.HeldAt.Valid {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "message is held for review",
+		})
+	}
+
+	// an edit cannot wait for a review, what would be held is refused
+	verdict, err := h.moderator.Moderate(payload.Content)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if verdict.Action != types.ModerationAllow {
+		h.recordModeration(*message, payload.Content, verdict, message.ID)
+	}
+	if verdict.Action == types.ModerationReject || verdict.Action == types.ModerationHold {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("edit rejected: %s", verdict.Reason),
+		})
+	}
+
+	if err := h.store.UpdateMessageContent(message.ID, verdict.Text); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	updated, err := h.store.GetMessageByID(message.ID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	h.publish(updated.ConversationID, types.Event{Type: types.EventMessageUpdated, Payload: updated})
+	h.dispatcher.Dispatch(updated.ConversationID, types.WebhookEventMessageEdited, updated)
+
+	return c.Status(fiber.StatusOK).JSON(updated)
+}
+
+// Delete a message, allowed for its sender and conversation admins
+func (h *Handler) handleDeleteMessage(c *fiber.Ctx) error {
+	message, err := h.getMessage(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	if message.SenderID != userID {
+		p, err := h.conversationStore.GetParticipant(message.ConversationID, userID)
+		if err != nil || p.Role != types.RoleAdmin {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "only the sender or an admin can delete a message",
+			})
+		}
+	}
+
+	if err := h.DeleteMessage(message.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "message deleted",
+	})
+}
+
+// DeleteMessage deletes a message and lets the participants and the outgoing
+// webhooks know, whoever asked for it.
+func (h *Handler) DeleteMessage(id int) error {
+	message, err := h.store.GetMessageByID(id)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.DeleteMessage(message.ID); err != nil {
+		return err
+	}
+
+	deleted := fiber.Map{
+		"id":             message.ID,
+		"conversationId": message.ConversationID,
+	}
+	h.publish(message.ConversationID, types.Event{Type: types.EventMessageDeleted, Payload: deleted})
+	h.dispatcher.Dispatch(message.ConversationID, types.WebhookEventMessageDeleted, deleted)
+
+	return nil
+}
+
+// List the messages of a conversation held for review
+func (h *Handler) handleGetHeldMessages(c *fiber.Ctx) error {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+	}
+
+	if !h.isAdmin(conversationID, auth.GetIDFromContext(c)) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only conversation admins can review held messages",
+		})
+	}
+
+	messages, err := h.store.GetHeldMessages(conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(messages)
+}
+
+// Release a message held for review to the conversation, deleting it is how
+// it gets turned down
+func (h *Handler) handleReleaseMessage(c *fiber.Ctx) error {
+	message, err := h.getMessage(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if !h.isAdmin(message.ConversationID, auth.GetIDFromContext(c)) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only conversation admins can review held messages",
+		})
+	}
+
+	if !message.HeldAt.Valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "message is not held for review",
+		})
+	}
+
+	if err := h.store.ReleaseMessage(message.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	released, err := h.store.GetMessageByID(message.ID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	h.publish(released.ConversationID, types.Event{Type: types.EventMessageCreated, Payload: released})
+	h.dispatcher.Dispatch(released.ConversationID, types.WebhookEventMessageCreated, released)
+
+	return c.Status(fiber.StatusOK).JSON(released)
+}
+
+// Mark the conversation as read up to a message and let the others know
+func (h *Handler) handleMarkRead(c *fiber.Ctx) error {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+	}
+
+	var payload types.MarkReadPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	if _, err := h.conversationStore.GetParticipant(conversationID, userID); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "not a participant of this conversation",
+		})
+	}
+
+	message, err := h.store.GetMessageByID(payload.MessageID)
+	if err != nil || message.ConversationID != conversationID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "message not found",
+		})
+	}
+
+	if err := h.conversationStore.MarkRead(conversationID, userID, message.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	h.publish(conversationID, types.Event{
+		Type: types.EventReceiptRead,
+		Payload: fiber.Map{
+			"conversationId": conversationID,
+			"userId":         userID,
+			"messageId":      message.ID,
+		},
+	})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// SendMessage is the send path shared by every transport. The caller is
+// expected to have checked that the sender takes part in the conversation.
+// A message carrying the client id of one already sent is not sent again,
+// the original is returned instead.
+//
+// Slash commands of users either answer the sender alone, the result is then
+// returned without a message, or turn into the content of the message.
+//
+// Encrypted messages reach every participant with the ciphertexts of their
+// own devices only, the one returned carries those of the sender.
+func (h *Handler) SendMessage(message types.Message, deviceID string) (*types.Message, *types.CommandResult, error) {
+	if message.ClientMessageID.Valid {
+		if existing, err := h.store.GetMessageByClientID(message.SenderID, message.ClientMessageID.String); err == nil {
+			sent, err := h.forSender(existing)
+			return sent, nil, err
+		}
+	}
+
+	// bots do not run commands, nor can the server read encrypted messages
+	if message.SenderID != 0 && message.Type != types.MessageTypeEncrypted {
+		result, err := h.commands.Execute(message.ConversationID, message.SenderID, message.Content)
+		if err != nil {
+			return nil, nil, err
+		}
+		if result != nil {
+			if result.ResponseType == types.CommandResponseEphemeral {
+				return nil, result, nil
+			}
+			message.Content = result.Text
+		}
+	}
+
+	created, err := h.sendMessage(message, deviceID)
+	return created, nil, err
+}
+
+func (h *Handler) sendMessage(message types.Message, deviceID string) (*types.Message, error) {
+	// the server cannot read encrypted messages, let alone moderate them
+	content := message.Content
+	verdict := &types.ModerationVerdict{Action: types.ModerationAllow}
+	if message.Type != types.MessageTypeEncrypted {
+		var err error
+		verdict, err = h.moderator.Moderate(content)
+		if err != nil {
+			return nil, err
+		}
+
+		switch verdict.Action {
+		case types.ModerationReject:
+			h.recordModeration(message, content, verdict, 0)
+			return nil, fmt.Errorf("message rejected: %s", verdict.Reason)
+		case types.ModerationHold:
+			message.HeldAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+		message.Content = verdict.Text
+	}
+
+	var (
+		created *types.Message
+		err     error
+	)
+	if message.Type == types.MessageTypeEncrypted {
+		created, err = h.store.CreateEncryptedMessage(message, message.Ciphertexts)
+	} else {
+		created, err = h.store.CreateMessage(message)
+	}
+	if err != nil {
+		// a concurrent retry may have won the unique key
+		if message.ClientMessageID.Valid {
+			if existing, lookupErr := h.store.GetMessageByClientID(message.SenderID, message.ClientMessageID.String); lookupErr == nil {
+				return h.forSender(existing)
+			}
+		}
+		return nil, err
+	}
+
+	if verdict.Action != types.ModerationAllow {
+		h.recordModeration(message, content, verdict, created.ID)
+	}
+
+	conversationID := created.ConversationID
+	switch {
+	case created.HeldAt.Valid:
+		// the others only see it once a conversation admin releases it
+	case created.Type == types.MessageTypeEncrypted:
+		for i := range message.Ciphertexts {
+			message.Ciphertexts[i].MessageID = created.ID
+		}
+		h.publishEncrypted(created, message.Ciphertexts)
+		h.dispatcher.Dispatch(conversationID, types.WebhookEventMessageCreated, created)
+		created = forUser(created, message.Ciphertexts, message.SenderID)
+	default:
+		h.publish(conversationID, types.Event{Type: types.EventMessageCreated, Payload: created})
+		h.dispatcher.Dispatch(conversationID, types.WebhookEventMessageCreated, created)
+	}
+
+	// bots have no drafts to clear
+	userID := message.SenderID
+	if userID == 0 {
+		return created, nil
+	}
+
+	// a sent message replaces whatever was being drafted on any device
+	if err := h.draftStore.DeleteDraft(userID, conversationID); err != nil {
+		log.Printf("failed to clear draft of user %d in conversation %d: %v", userID, conversationID, err)
+	} else {
+		h.publisher.SendToUser(userID, types.Event{
+			Type:    types.EventDraftDeleted,
+			Payload: fiber.Map{"conversationId": conversationID},
+		}, deviceID)
+	}
+
+	return created, nil
+}
+
+// recordModeration keeps the audit record of a verdict taken on a message,
+// messageID is 0 for rejected ones.
+func (h *Handler) recordModeration(message types.Message, content string, verdict *types.ModerationVerdict, messageID int) {
+	err := h.moderator.Record(types.ModerationDecision{
+		MessageID:      sql.NullInt64{Int64: int64(messageID), Valid: messageID != 0},
+		ConversationID: message.ConversationID,
+		UserID:         sql.NullInt64{Int64: int64(message.SenderID), Valid: message.SenderID != 0},
+		Action:         verdict.Action,
+		Moderator:      verdict.Moderator,
+		Reason:         verdict.Reason,
+		Content:        content,
+	})
+	if err != nil {
+		log.Printf("failed to record moderation decision in conversation %d: %v", message.ConversationID, err)
+	}
+}
+
+func (h *Handler) getMessage(c *fiber.Ctx) (*types.Message, error) {
+	messageID, err := c.ParamsInt("id")
+	if err != nil {
+		return nil, fmt.Errorf("invalid message id")
+	}
+
+	message, err := h.store.GetMessageByID(messageID)
+	if err != nil || message.DeletedAt.Valid {
+		return nil, fmt.Errorf("message not found")
+	}
+
+	if _, err := h.conversationStore.GetParticipant(message.ConversationID, auth.GetIDFromContext(c)); err != nil {
+		return nil, fmt.Errorf("message not found")
+	}
+
+	return message, nil
+}
+
+// publishEncrypted sends a new encrypted message to every participant of
+// its conversation, each with their own ciphertexts.
+func (h *Handler) publishEncrypted(message *types.Message, ciphertexts []types.DeviceCiphertext) {
+	participants, err := h.conversationStore.GetParticipants(message.ConversationID)
+	if err != nil {
+		log.Printf("failed to get participants of conversation %d: %v", message.ConversationID, err)
+		return
+	}
+
+	for _, p := range participants {
+		h.publisher.SendToUser(p.UserID, types.Event{
+			Type:    types.EventMessageCreated,
+			Payload: forUser(message, ciphertexts, p.UserID),
+		}, "")
+	}
+}
+
+// attachCiphertexts sets on the encrypted messages the ciphertexts addressed
+// to the devices of the user.
+func (h *Handler) attachCiphertexts(messages []types.Message, userID int) error {
+	messageIDs := []int{}
+	for _, m := range messages {
+		if m.Type == types.MessageTypeEncrypted {
+			messageIDs = append(messageIDs, m.ID)
+		}
+	}
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	ciphertexts, err := h.store.GetCiphertexts(messageIDs, userID)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		messages[i].Ciphertexts = ciphertexts[messages[i].ID]
+	}
+
+	return nil
+}
+
+func (h *Handler) forSender(message *types.Message) (*types.Message, error) {
+	messages := []types.Message{*message}
+	if err := h.attachCiphertexts(messages, message.SenderID); err != nil {
+		return nil, err
+	}
+
+	return &messages[0], nil
+}
+
+// forUser returns a copy of the message carrying only the ciphertexts of the
+// devices of the user.
+func forUser(message *types.Message, ciphertexts []types.DeviceCiphertext, userID int) *types.Message {
+	m := *message
+	m.Ciphertexts = nil
+	for _, c := range ciphertexts {
+		if c.UserID == userID {
+			m.Ciphertexts = append(m.Ciphertexts, c)
+		}
+	}
+
+	return &m
+}
+
+func (h *Handler) isAdmin(conversationID, userID int) bool {
+	p, err := h.conversationStore.GetParticipant(conversationID, userID)
+	return err == nil && p.Role == types.RoleAdmin
+}
+
+// publish sends the event to every participant of the conversation.
+func (h *Handler) publish(conversationID int, event types.Event) {
+	participants, err := h.conversationStore.GetParticipants(conversationID)
+	if err != nil {
+		log.Printf("failed to get participants of conversation %d: %v", conversationID, err)
+		return
+	}
+
+	userIDs := make([]int, 0, len(participants))
+	for _, p := range participants {
+		userIDs = append(userIDs, p.UserID)
+	}
+
+	h.publisher.SendToUsers(userIDs, event)
+}
@@ -0,0 +1,840 @@
+package message
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageServiceHandlers(t *testing.T) {
+	messageStore := &mockMessageStore{messages: map[int]*types.Message{}}
+	draftStore := &mockDraftStore{drafts: map[int]bool{1: true}}
+	publisher := &mockPublisher{}
+	conversationStore := &mockConversationStore{
+		participants: map[int]string{1: types.RoleMember, 2: types.RoleAdmin},
+	}
+	commands := &mockCommands{}
+	moderator := &mockModerator{verdicts: map[string]*types.ModerationVerdict{
+		"buy pills":      {Action: types.ModerationReject, Moderator: "links", Reason: "blocked domain"},
+		"darn it":        {Action: types.ModerationMask, Text: "**** it", Moderator: "words", Reason: "blocked word"},
+		"borderline one": {Action: types.ModerationHold, Text: "borderline one", Moderator: "classifier", Reason: "toxicity"},
+	}}
+	handler := NewHandler(messageStore, &mockPollStore{}, conversationStore, draftStore, &mockUserStore{}, publisher, &mockDispatcher{}, commands, moderator, &mockIdempotencyStore{})
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	t.Run("should fail if the message is empty", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/conversations/1/messages", types.SendMessagePayload{}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should fail if the sender is not a participant", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/conversations/1/messages", types.SendMessagePayload{Content: "hi"}, 3)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should send a message and clear the draft", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/conversations/1/messages", types.SendMessagePayload{Content: "hi"}, 1)
+		req.Header.Set("X-Device-ID", "laptop")
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Len(t, messageStore.messages, 1)
+		assert.False(t, draftStore.drafts[1], "expected draft to be cleared")
+		assert.Equal(t, []string{types.EventMessageCreated, types.EventDraftDeleted}, publisher.types())
+		assert.Equal(t, []int{1, 2}, publisher.events[0].userIDs)
+		assert.Equal(t, "laptop", publisher.events[1].exceptDevice)
+	})
+
+	t.Run("should mark a conversation as read", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/conversations/1/read", types.MarkReadPayload{MessageID: 1}, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, 1, conversationStore.lastRead)
+		assert.Equal(t, types.EventReceiptRead, publisher.events[len(publisher.events)-1].event.Type)
+	})
+
+	t.Run("should only let the sender edit a message", func(t *testing.T) {
+		req := newRequest(t, http.MethodPatch, "/messages/1", types.UpdateMessagePayload{Content: "edited"}, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should edit a message", func(t *testing.T) {
+		req := newRequest(t, http.MethodPatch, "/messages/1", types.UpdateMessagePayload{Content: "edited"}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "edited", messageStore.messages[1].Content)
+		assert.True(t, messageStore.messages[1].EditedAt.Valid)
+	})
+
+	t.Run("should let an admin delete a message", func(t *testing.T) {
+		req := newRequest(t, http.MethodDelete, "/messages/1", nil, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.True(t, messageStore.messages[1].DeletedAt.Valid)
+		assert.Equal(t, types.EventMessageDeleted, publisher.events[len(publisher.events)-1].event.Type)
+	})
+
+	t.Run("should answer an ephemeral command without sending a message", func(t *testing.T) {
+		commands.result = &types.CommandResult{Command: "help", ResponseType: types.CommandResponseEphemeral, Text: "/help - List the commands"}
+		req := newRequest(t, http.MethodPost, "/conversations/1/messages", types.SendMessagePayload{Content: "/help"}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, messageStore.messages, 1)
+	})
+
+	t.Run("should send the text of a public command", func(t *testing.T) {
+		commands.result = &types.CommandResult{Command: "shrug", ResponseType: types.CommandResponsePublic, Text: `¯\_(ツ)_/¯`}
+		req := newRequest(t, http.MethodPost, "/conversations/1/messages", types.SendMessagePayload{Content: "/shrug"}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, `¯\_(ツ)_/¯`, messageStore.messages[2].Content)
+	})
+
+	t.Run("should run commands on the path shared with the socket", func(t *testing.T) {
+		commands.result = &types.CommandResult{Command: "help", ResponseType: types.CommandResponseEphemeral, Text: "/help - List the commands"}
+		sent := len(messageStore.messages)
+
+		message, result, err := handler.SendMessage(types.Message{ConversationID: 1, SenderID: 1, Content: "/help"}, "phone")
+		assert.NoError(t, err)
+		assert.Nil(t, message)
+		assert.Equal(t, "help", result.Command)
+		assert.Len(t, messageStore.messages, sent)
+	})
+
+	t.Run("should return the original message when a send is retried", func(t *testing.T) {
+		commands.result = nil
+		payload := types.SendMessagePayload{Content: "once", ClientMessageID: "c0ffee"}
+
+		req := newRequest(t, http.MethodPost, "/conversations/1/messages", payload, 1)
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		published := len(publisher.events)
+
+		req = newRequest(t, http.MethodPost, "/conversations/1/messages", payload, 1)
+		resp, err = app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var message types.Message
+		json.NewDecoder(resp.Body).Decode(&message)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, messageStore.messages, 3)
+		assert.Equal(t, 3, message.ID)
+		assert.Equal(t, "c0ffee", message.ClientMessageID.String)
+		assert.Len(t, publisher.events, published, "expected a retry not to publish again")
+	})
+
+	t.Run("should not accept both content and ciphertexts", func(t *testing.T) {
+		payload := types.SendMessagePayload{
+			Content:     "plain",
+			Ciphertexts: []types.DeviceCiphertextPayload{{UserID: 2, DeviceID: "phone", Ciphertext: "c2VjcmV0"}},
+		}
+		req := newRequest(t, http.MethodPost, "/conversations/1/messages", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should fail if a ciphertext is addressed to a non participant", func(t *testing.T) {
+		payload := types.SendMessagePayload{
+			Ciphertexts: []types.DeviceCiphertextPayload{{UserID: 3, DeviceID: "phone", Ciphertext: "c2VjcmV0"}},
+		}
+		req := newRequest(t, http.MethodPost, "/conversations/1/messages", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should send each participant their own ciphertexts", func(t *testing.T) {
+		payload := types.SendMessagePayload{
+			Ciphertexts: []types.DeviceCiphertextPayload{
+				{UserID: 1, DeviceID: "tablet", Ciphertext: "Zm9yIG1l"},
+				{UserID: 2, DeviceID: "phone", Ciphertext: "Zm9yIHlvdQ=="},
+				{UserID: 2, DeviceID: "laptop", Ciphertext: "Zm9yIHlvdSB0b28="},
+			},
+		}
+		published := len(publisher.events)
+		req := newRequest(t, http.MethodPost, "/conversations/1/messages", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var message types.Message
+		json.NewDecoder(resp.Body).Decode(&message)
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, types.MessageTypeEncrypted, message.Type)
+		assert.Empty(t, message.Content)
+		assert.Len(t, message.Ciphertexts, 1)
+		assert.Equal(t, "tablet", message.Ciphertexts[0].DeviceID)
+
+		for _, e := range publisher.events[published:] {
+			if e.event.Type != types.EventMessageCreated {
+				continue
+			}
+			sent := e.event.Payload.(*types.Message)
+			for _, c := range sent.Ciphertexts {
+				assert.Equal(t, e.userIDs[0], c.UserID, "expected only the ciphertexts of the recipient")
+			}
+		}
+	})
+
+	t.Run("should reject a message the moderators refuse", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/conversations/1/messages", types.SendMessagePayload{Content: "buy pills"}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Len(t, messageStore.messages, 4)
+		assert.Equal(t, types.ModerationReject, moderator.decisions[0].Action)
+		assert.False(t, moderator.decisions[0].MessageID.Valid)
+		assert.Equal(t, "buy pills", moderator.decisions[0].Content)
+	})
+
+	t.Run("should send the masked text of a message", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/conversations/1/messages", types.SendMessagePayload{Content: "darn it"}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "**** it", messageStore.messages[5].Content)
+		assert.Equal(t, int64(5), moderator.decisions[1].MessageID.Int64)
+		assert.Equal(t, "darn it", moderator.decisions[1].Content)
+	})
+
+	t.Run("should hold a message for review without publishing it", func(t *testing.T) {
+		published := len(publisher.events)
+		req := newRequest(t, http.MethodPost, "/conversations/1/messages", types.SendMessagePayload{Content: "borderline one"}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.True(t, messageStore.messages[6].HeldAt.Valid)
+		for _, e := range publisher.events[published:] {
+			assert.NotEqual(t, types.EventMessageCreated, e.event.Type, "expected a held message not to be published")
+		}
+	})
+
+	t.Run("should refuse an edit the moderators would hold", func(t *testing.T) {
+		req := newRequest(t, http.MethodPatch, "/messages/5", types.UpdateMessagePayload{Content: "borderline one"}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "**** it", messageStore.messages[5].Content)
+	})
+
+	t.Run("should fail to edit a message held for review", func(t *testing.T) {
+		published := len(publisher.events)
+		req := newRequest(t, http.MethodPatch, "/messages/6", types.UpdateMessagePayload{Content: "fine now"}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, "borderline one", messageStore.messages[6].Content)
+		assert.Len(t, publisher.events, published)
+	})
+
+	t.Run("should only let admins review held messages", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/messages/6/release", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should list the held messages", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/conversations/1/held-messages", nil, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var messages []types.Message
+		json.NewDecoder(resp.Body).Decode(&messages)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, messages, 1)
+		assert.Equal(t, 6, messages[0].ID)
+	})
+
+	t.Run("should publish a held message once released", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/messages/6/release", nil, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.False(t, messageStore.messages[6].HeldAt.Valid)
+		assert.Equal(t, types.EventMessageCreated, publisher.events[len(publisher.events)-1].event.Type)
+	})
+
+	t.Run("should fail to release a message that is not held", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/messages/6/release", nil, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestPollHandlers(t *testing.T) {
+	messageStore := &mockMessageStore{messages: map[int]*types.Message{}}
+	pollStore := &mockPollStore{messageStore: messageStore, votes: map[int][]int{}}
+	publisher := &mockPublisher{}
+	conversationStore := &mockConversationStore{
+		participants: map[int]string{1: types.RoleMember, 2: types.RoleMember},
+	}
+	commands := &mockCommands{}
+	moderator := &mockModerator{verdicts: map[string]*types.ModerationVerdict{
+		"spam?":  {Action: types.ModerationReject, Text: "spam?", Reason: "spam"},
+		"crude?": {Action: types.ModerationHold, Text: "crude?", Reason: "needs review"},
+		"darn":   {Action: types.ModerationMask, Text: "****", Reason: "blocked word"},
+	}}
+	handler := NewHandler(messageStore, pollStore, conversationStore, &mockDraftStore{drafts: map[int]bool{}}, &mockUserStore{}, publisher, &mockDispatcher{}, commands, moderator, &mockIdempotencyStore{})
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	t.Run("should fail if a poll has less than two options", func(t *testing.T) {
+		payload := types.CreatePollPayload{Question: "lunch?", Options: []string{"pizza"}}
+		req := newRequest(t, http.MethodPost, "/conversations/1/polls", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should post a poll message", func(t *testing.T) {
+		payload := types.CreatePollPayload{Question: "lunch?", Options: []string{"pizza", "sushi"}}
+		req := newRequest(t, http.MethodPost, "/conversations/1/polls", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var message types.Message
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&message))
+		assert.Equal(t, types.MessageTypePoll, message.Type)
+		assert.Len(t, message.Poll.Options, 2)
+		assert.Equal(t, types.EventMessageCreated, publisher.events[0].event.Type)
+	})
+
+	t.Run("should only accept one option on single choice polls", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/polls/1/votes", types.VotePollPayload{OptionIDs: []int{1, 2}}, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should record a vote and publish the results", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/polls/1/votes", types.VotePollPayload{OptionIDs: []int{2}}, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var poll types.Poll
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&poll))
+		assert.Equal(t, 1, poll.Options[1].Votes)
+		assert.Equal(t, []int{2}, poll.Options[1].Voters)
+		assert.Equal(t, types.EventPollUpdated, publisher.events[len(publisher.events)-1].event.Type)
+	})
+
+	t.Run("should retract a vote", func(t *testing.T) {
+		req := newRequest(t, http.MethodDelete, "/polls/1/votes", nil, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var poll types.Poll
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&poll))
+		assert.Equal(t, 0, poll.TotalVoters)
+	})
+
+	t.Run("should reject votes on closed polls", func(t *testing.T) {
+		pollStore.poll.ClosesAt = sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+
+		req := newRequest(t, http.MethodPost, "/polls/1/votes", types.VotePollPayload{OptionIDs: []int{1}}, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should reject a poll with a rejected question", func(t *testing.T) {
+		stored := len(messageStore.messages)
+		payload := types.CreatePollPayload{Question: "spam?", Options: []string{"yes", "no"}}
+		req := newRequest(t, http.MethodPost, "/conversations/1/polls", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Len(t, messageStore.messages, stored)
+		assert.Equal(t, types.ModerationReject, moderator.decisions[len(moderator.decisions)-1].Action)
+	})
+
+	t.Run("should mask the options of a poll", func(t *testing.T) {
+		payload := types.CreatePollPayload{Question: "lunch?", Options: []string{"darn", "sushi"}}
+		req := newRequest(t, http.MethodPost, "/conversations/1/polls", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var message types.Message
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&message))
+		assert.Equal(t, "****", message.Poll.Options[0].Text)
+		assert.Equal(t, message.ID, int(moderator.decisions[len(moderator.decisions)-1].MessageID.Int64))
+	})
+
+	t.Run("should hold a poll without publishing it", func(t *testing.T) {
+		published := len(publisher.events)
+		payload := types.CreatePollPayload{Question: "crude?", Options: []string{"yes", "no"}}
+		req := newRequest(t, http.MethodPost, "/conversations/1/polls", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var message types.Message
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&message))
+		assert.True(t, message.HeldAt.Valid)
+		assert.Len(t, publisher.events, published)
+	})
+}
+
+func newRequest(t *testing.T, method, target string, payload any, userID int) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+type mockMessageStore struct {
+	messages    map[int]*types.Message
+	ciphertexts map[int][]types.DeviceCiphertext
+}
+
+func (m *mockMessageStore) CreateMessage(message types.Message) (*types.Message, error) {
+	message.ID = len(m.messages) + 1
+	message.SentAt = time.Now()
+	if message.Type == "" {
+		message.Type = types.MessageTypeText
+	}
+	m.messages[message.ID] = &message
+	return &message, nil
+}
+
+func (m *mockMessageStore) GetMessageByID(id int) (*types.Message, error) {
+	if message, ok := m.messages[id]; ok {
+		return message, nil
+	}
+	return nil, fmt.Errorf("message not found")
+}
+
+func (m *mockMessageStore) GetMessagesByConversationID(conversationID, beforeID, limit int) ([]types.Message, error) {
+	return nil, nil
+}
+
+func (m *mockMessageStore) UpdateMessageContent(id int, content string) error {
+	m.messages[id].Content = content
+	m.messages[id].EditedAt.Valid = true
+	return nil
+}
+
+func (m *mockMessageStore) DeleteMessage(id int) error {
+	m.messages[id].Content = ""
+	m.messages[id].DeletedAt.Valid = true
+	return nil
+}
+
+func (m *mockMessageStore) GetMessageByClientID(senderID int, clientMessageID string) (*types.Message, error) {
+	for _, message := range m.messages {
+		if message.SenderID == senderID && message.ClientMessageID.Valid && message.ClientMessageID.String == clientMessageID {
+			return message, nil
+		}
+	}
+	return nil, fmt.Errorf("message not found")
+}
+
+func (m *mockMessageStore) CreateEncryptedMessage(message types.Message, ciphertexts []types.DeviceCiphertext) (*types.Message, error) {
+	message.Type = types.MessageTypeEncrypted
+	message.Ciphertexts = nil
+	created, _ := m.CreateMessage(message)
+
+	if m.ciphertexts == nil {
+		m.ciphertexts = map[int][]types.DeviceCiphertext{}
+	}
+	for _, c := range ciphertexts {
+		c.MessageID = created.ID
+		m.ciphertexts[created.ID] = append(m.ciphertexts[created.ID], c)
+	}
+
+	return created, nil
+}
+
+func (m *mockMessageStore) GetCiphertexts(messageIDs []int, userID int) (map[int][]types.DeviceCiphertext, error) {
+	ciphertexts := map[int][]types.DeviceCiphertext{}
+	for _, id := range messageIDs {
+		for _, c := range m.ciphertexts[id] {
+			if c.UserID == userID {
+				ciphertexts[id] = append(ciphertexts[id], c)
+			}
+		}
+	}
+	return ciphertexts, nil
+}
+
+func (m *mockMessageStore) GetHeldMessages(conversationID int) ([]types.Message, error) {
+	messages := []types.Message{}
+	for _, message := range m.messages {
+		if message.ConversationID == conversationID && message.HeldAt.Valid {
+			messages = append(messages, *message)
+		}
+	}
+	return messages, nil
+}
+
+func (m *mockMessageStore) ReleaseMessage(id int) error {
+	m.messages[id].HeldAt.Valid = false
+	return nil
+}
+
+type mockPollStore struct {
+	messageStore *mockMessageStore
+	poll         *types.Poll
+	votes        map[int][]int
+}
+
+func (m *mockPollStore) CreatePoll(message types.Message, poll types.Poll) (*types.Message, error) {
+	message.Type = types.MessageTypePoll
+	message.Content = poll.Question
+	created, _ := m.messageStore.CreateMessage(message)
+
+	poll.ID = 1
+	poll.MessageID = created.ID
+	for i := range poll.Options {
+		poll.Options[i].ID = i + 1
+		poll.Options[i].PollID = poll.ID
+	}
+	m.poll = &poll
+	created.Poll = &poll
+
+	return created, nil
+}
+
+func (m *mockPollStore) GetPollByID(id int) (*types.Poll, error) {
+	if m.poll == nil || m.poll.ID != id {
+		return nil, fmt.Errorf("poll not found")
+	}
+
+	poll := *m.poll
+	poll.Options = nil
+	poll.TotalVoters = len(m.votes)
+	for _, o := range m.poll.Options {
+		o.Votes, o.Voters = 0, nil
+		for userID, optionIDs := range m.votes {
+			for _, id := range optionIDs {
+				if id == o.ID {
+					o.Votes++
+					o.Voters = append(o.Voters, userID)
+				}
+			}
+		}
+		poll.Options = append(poll.Options, o)
+	}
+
+	return &poll, nil
+}
+
+func (m *mockPollStore) SetPollVotes(pollID, userID int, optionIDs []int) error {
+	m.votes[userID] = optionIDs
+	return nil
+}
+
+func (m *mockPollStore) RetractPollVotes(pollID, userID int) error {
+	delete(m.votes, userID)
+	return nil
+}
+
+type mockDraftStore struct {
+	drafts map[int]bool
+}
+
+func (m *mockDraftStore) GetDraft(userID, conversationID int) (*types.Draft, error) {
+	return nil, fmt.Errorf("draft not found")
+}
+
+func (m *mockDraftStore) SaveDraft(draft types.Draft) error {
+	m.drafts[draft.ConversationID] = true
+	return nil
+}
+
+func (m *mockDraftStore) DeleteDraft(userID, conversationID int) error {
+	m.drafts[conversationID] = false
+	return nil
+}
+
+type publishedEvent struct {
+	userIDs      []int
+	event        types.Event
+	exceptDevice string
+}
+
+type mockPublisher struct {
+	events []publishedEvent
+}
+
+func (m *mockPublisher) SendToUser(userID int, event types.Event, exceptDevice string) {
+	m.events = append(m.events, publishedEvent{userIDs: []int{userID}, event: event, exceptDevice: exceptDevice})
+}
+
+func (m *mockPublisher) SendToUsers(userIDs []int, event types.Event) {
+	m.events = append(m.events, publishedEvent{userIDs: userIDs, event: event})
+}
+
+func (m *mockPublisher) types() []string {
+	names := []string{}
+	for _, e := range m.events {
+		names = append(names, e.event.Type)
+	}
+	return names
+}
+
+type mockConversationStore struct {
+	participants map[int]string
+	lastRead     int
+}
+
+func (m *mockConversationStore) CreateConversation(name string, creatorID int, participantIDs []int) (*types.Conversation, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) GetConversationByID(id int) (*types.Conversation, error) {
+	return &types.Conversation{ID: id}, nil
+}
+
+func (m *mockConversationStore) GetParticipant(conversationID, userID int) (*types.Participant, error) {
+	if role, ok := m.participants[userID]; ok {
+		return &types.Participant{ConversationID: conversationID, UserID: userID, Role: role}, nil
+	}
+	return nil, fmt.Errorf("participant not found")
+}
+
+func (m *mockConversationStore) GetParticipants(conversationID int) ([]types.Participant, error) {
+	return []types.Participant{
+		{ConversationID: conversationID, UserID: 1, Role: m.participants[1]},
+		{ConversationID: conversationID, UserID: 2, Role: m.participants[2]},
+	}, nil
+}
+
+func (m *mockConversationStore) RemoveParticipant(conversationID, userID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) MarkRead(conversationID, userID, messageID int) error {
+	m.lastRead = messageID
+	return nil
+}
+
+func (m *mockConversationStore) GetContactIDs(userID int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) ExportMessages(conversationID int, fn func(*types.ExportedMessage) error) error {
+	return nil
+}
+
+func (m *mockConversationStore) UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error {
+	return nil
+}
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
+
+type mockDispatcher struct {
+	events []string
+}
+
+func (m *mockDispatcher) Dispatch(conversationID int, event string, data any) {
+	m.events = append(m.events, event)
+}
+
+// mockIdempotencyStore never saw a key before.
+type mockIdempotencyStore struct{}
+
+func (m *mockIdempotencyStore) ReserveIdempotencyKey(userID int, key, fingerprint string) (*types.IdempotencyRecord, bool, error) {
+	return &types.IdempotencyRecord{UserID: userID, Key: key, Fingerprint: fingerprint}, true, nil
+}
+
+func (m *mockIdempotencyStore) CompleteIdempotencyKey(userID int, key string, statusCode int, body []byte) error {
+	return nil
+}
+
+func (m *mockIdempotencyStore) ReleaseIdempotencyKey(userID int, key string) error {
+	return nil
+}
+
+type mockCommands struct {
+	result *types.CommandResult
+}
+
+func (m *mockCommands) Execute(conversationID, userID int, content string) (*types.CommandResult, error) {
+	return m.result, nil
+}
+
+type mockModerator struct {
+	verdicts  map[string]*types.ModerationVerdict
+	decisions []types.ModerationDecision
+}
+
+func (m *mockModerator) Moderate(text string) (*types.ModerationVerdict, error) {
+	if verdict, ok := m.verdicts[text]; ok {
+		return verdict, nil
+	}
+	return &types.ModerationVerdict{Action: types.ModerationAllow, Text: text}, nil
+}
+
+func (m *mockModerator) Record(decision types.ModerationDecision) error {
+	m.decisions = append(m.decisions, decision)
+	return nil
+}
@@ -0,0 +1,430 @@
+package message
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateMessage(message types.Message) (*types.Message, error) {
+	// messages posted by incoming webhooks have no sender account
+	senderID := sql.NullInt64{Int64: int64(message.SenderID), Valid: message.SenderID != 0}
+
+	res, err := s.db.Exec(
+		"INSERT INTO messages (conversation_id, sender_id, content, incoming_webhook_id, senderName, senderAvatar, clientMessageId, heldAt) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		message.ConversationID, senderID, message.Content, message.IncomingWebhookID, message.SenderName, message.SenderAvatar, message.ClientMessageID, message.HeldAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetMessageByID(int(id))
+}
+
+func (s *Store) GetMessageByID(id int) (*types.Message, error) {
+	return s.getMessage("SELECT * FROM messages WHERE id = ?", id)
+}
+
+// GetMessageByClientID finds a message sent earlier by a client retrying it.
+func (s *Store) GetMessageByClientID(senderID int, clientMessageID string) (*types.Message, error) {
+	return s.getMessage("SELECT * FROM messages WHERE sender_id = ? AND clientMessageId = ?", senderID, clientMessageID)
+}
+
+func (s *Store) getMessage(query string, args ...any) (*types.Message, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := new(types.Message)
+	for rows.Next() {
+		m, err = scanRowIntoMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if m.ID == 0 {
+		return nil, fmt.Errorf("Message not found.")
+	}
+
+	if err := s.attachPoll(m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// GetMessagesByConversationID returns a page of messages, newest first.
+// beforeID of 0 starts from the latest message.
+func (s *Store) GetMessagesByConversationID(conversationID, beforeID, limit int) ([]types.Message, error) {
+	rows, err := s.db.Query(
+		"SELECT * FROM messages WHERE conversation_id = ? AND deletedAt IS NULL AND heldAt IS NULL AND (? = 0 OR id < ?) ORDER BY id DESC LIMIT ?",
+		conversationID, beforeID, beforeID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []types.Message{}
+	for rows.Next() {
+		m, err := scanRowIntoMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *m)
+	}
+	rows.Close()
+
+	for i := range messages {
+		if err := s.attachPoll(&messages[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return messages, nil
+}
+
+// GetHeldMessages returns the messages of the conversation waiting for a
+// review, oldest first.
+func (s *Store) GetHeldMessages(conversationID int) ([]types.Message, error) {
+	rows, err := s.db.Query(
+		"SELECT * FROM messages WHERE conversation_id = ? AND deletedAt IS NULL AND heldAt IS NOT NULL ORDER BY id",
+		conversationID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []types.Message{}
+	for rows.Next() {
+		m, err := scanRowIntoMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *m)
+	}
+
+	return messages, nil
+}
+
+func (s *Store) ReleaseMessage(id int) error {
+	_, err := s.db.Exec("UPDATE messages SET heldAt = NULL WHERE id = ? AND deletedAt IS NULL;", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) UpdateMessageContent(id int, content string) error {
+	_, err := s.db.Exec("UPDATE messages SET content = ?, editedAt = CURRENT_TIMESTAMP WHERE id = ? AND deletedAt IS NULL;", content, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteMessage soft deletes a message and clears its content.
+func (s *Store) DeleteMessage(id int) error {
+	_, err := s.db.Exec("UPDATE messages SET content = '', deletedAt = CURRENT_TIMESTAMP WHERE id = ? AND deletedAt IS NULL;", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreatePoll stores a poll message together with its poll and options.
+func (s *Store) CreatePoll(message types.Message, poll types.Poll) (*types.Message, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT INTO messages (conversation_id, sender_id, content, type, heldAt) VALUES (?, ?, ?, ?, ?)",
+		message.ConversationID, message.SenderID, poll.Question, types.MessageTypePoll, message.HeldAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	messageID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err = tx.Exec(
+		"INSERT INTO polls (message_id, question, multipleChoice, anonymous, closesAt) VALUES (?, ?, ?, ?, ?)",
+		messageID, poll.Question, poll.MultipleChoice, poll.Anonymous, poll.ClosesAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	pollID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, option := range poll.Options {
+		_, err := tx.Exec("INSERT INTO poll_options (poll_id, text, position) VALUES (?, ?, ?)", pollID, option.Text, i)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetMessageByID(int(messageID))
+}
+
+// CreateEncryptedMessage stores a message without content together with the
+// ciphertexts of its recipient devices.
+func (s *Store) CreateEncryptedMessage(message types.Message, ciphertexts []types.DeviceCiphertext) (*types.Message, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT INTO messages (conversation_id, sender_id, content, type, clientMessageId) VALUES (?, ?, '', ?, ?)",
+		message.ConversationID, message.SenderID, types.MessageTypeEncrypted, message.ClientMessageID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	messageID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range ciphertexts {
+		_, err := tx.Exec(
+			"INSERT INTO message_ciphertexts (message_id, recipient_id, recipientDeviceId, ciphertext) VALUES (?, ?, ?, ?)",
+			messageID, c.UserID, c.DeviceID, c.Ciphertext,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetMessageByID(int(messageID))
+}
+
+func (s *Store) GetCiphertexts(messageIDs []int, userID int) (map[int][]types.DeviceCiphertext, error) {
+	ciphertexts := map[int][]types.DeviceCiphertext{}
+	if len(messageIDs) == 0 {
+		return ciphertexts, nil
+	}
+
+	args := []any{userID}
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(messageIDs)), ", ")
+
+	rows, err := s.db.Query(
+		"SELECT message_id, recipient_id, recipientDeviceId, ciphertext FROM message_ciphertexts WHERE recipient_id = ? AND message_id IN ("+placeholders+")",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c types.DeviceCiphertext
+		if err := rows.Scan(&c.MessageID, &c.UserID, &c.DeviceID, &c.Ciphertext); err != nil {
+			return nil, err
+		}
+		ciphertexts[c.MessageID] = append(ciphertexts[c.MessageID], c)
+	}
+
+	return ciphertexts, nil
+}
+
+func (s *Store) GetPollByID(id int) (*types.Poll, error) {
+	return s.getPoll("SELECT * FROM polls WHERE id = ?", id)
+}
+
+// SetPollVotes replaces the votes of the user on the poll.
+func (s *Store) SetPollVotes(pollID, userID int, optionIDs []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM poll_votes WHERE poll_id = ? AND user_id = ?;", pollID, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, optionID := range optionIDs {
+		_, err := tx.Exec("INSERT INTO poll_votes (poll_id, option_id, user_id) VALUES (?, ?, ?)", pollID, optionID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) RetractPollVotes(pollID, userID int) error {
+	_, err := s.db.Exec("DELETE FROM poll_votes WHERE poll_id = ? AND user_id = ?;", pollID, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) attachPoll(m *types.Message) error {
+	if m.Type != types.MessageTypePoll {
+		return nil
+	}
+
+	poll, err := s.getPoll("SELECT * FROM polls WHERE message_id = ?", m.ID)
+	if err != nil {
+		return err
+	}
+	m.Poll = poll
+
+	return nil
+}
+
+// getPoll loads a poll along with its options and aggregated votes.
+func (s *Store) getPoll(query string, arg any) (*types.Poll, error) {
+	rows, err := s.db.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	p := new(types.Poll)
+	for rows.Next() {
+		p, err = scanRowIntoPoll(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rows.Close()
+
+	if p.ID == 0 {
+		return nil, fmt.Errorf("Poll not found.")
+	}
+
+	options, err := s.db.Query(
+		`SELECT o.id, o.poll_id, o.text, o.position, v.user_id
+		FROM poll_options o
+		LEFT JOIN poll_votes v ON v.option_id = o.id
+		WHERE o.poll_id = ?
+		ORDER BY o.position, v.createdAt`,
+		p.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer options.Close()
+
+	voters := map[int]struct{}{}
+	p.Options = []types.PollOption{}
+	for options.Next() {
+		var (
+			o     types.PollOption
+			voter sql.NullInt64
+		)
+		if err := options.Scan(&o.ID, &o.PollID, &o.Text, &o.Position, &voter); err != nil {
+			return nil, err
+		}
+
+		if len(p.Options) == 0 || p.Options[len(p.Options)-1].ID != o.ID {
+			p.Options = append(p.Options, o)
+		}
+
+		if voter.Valid {
+			current := &p.Options[len(p.Options)-1]
+			current.Votes++
+			if !p.Anonymous {
+				current.Voters = append(current.Voters, int(voter.Int64))
+			}
+			voters[int(voter.Int64)] = struct{}{}
+		}
+	}
+	p.TotalVoters = len(voters)
+
+	return p, nil
+}
+
+func scanRowIntoPoll(rows *sql.Rows) (*types.Poll, error) {
+	p := new(types.Poll)
+
+	err := rows.Scan(
+		&p.ID,
+		&p.MessageID,
+		&p.Question,
+		&p.MultipleChoice,
+		&p.Anonymous,
+		&p.ClosesAt,
+		&p.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func scanRowIntoMessage(rows *sql.Rows) (*types.Message, error) {
+	m := new(types.Message)
+
+	var senderID sql.NullInt64
+	err := rows.Scan(
+		&m.ID,
+		&m.ConversationID,
+		&senderID,
+		&m.Content,
+		&m.SentAt,
+		&m.EditedAt,
+		&m.ReadAt,
+		&m.DeletedAt,
+		&m.Type,
+		&m.IncomingWebhookID,
+		&m.SenderName,
+		&m.SenderAvatar,
+		&m.ClientMessageID,
+		&m.HeldAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.SenderID = int(senderID.Int64)
+
+	return m, nil
+}
@@ -0,0 +1,97 @@
+package moderation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+const classifierTimeout = 3 * time.Second
+
+// Classifier scores text against categories such as spam or harassment, each
+// score between 0 and 1.
+type Classifier interface {
+	Classify(text string) (map[string]float64, error)
+}
+
+// ClassifierModerator holds or rejects messages a classifier scores above
+// its thresholds, a threshold of 0 is not applied.
+type ClassifierModerator struct {
+	classifier  Classifier
+	holdScore   float64
+	rejectScore float64
+}
+
+func NewClassifierModerator(classifier Classifier, holdScore, rejectScore float64) *ClassifierModerator {
+	return &ClassifierModerator{classifier: classifier, holdScore: holdScore, rejectScore: rejectScore}
+}
+
+func (m *ClassifierModerator) Name() string {
+	return "classifier"
+}
+
+func (m *ClassifierModerator) Check(text string) (*types.ModerationVerdict, error) {
+	scores, err := m.classifier.Classify(text)
+	if err != nil {
+		return nil, err
+	}
+
+	category, top := "", 0.0
+	for c, score := range scores {
+		if score > top || (score == top && c < category) {
+			category, top = c, score
+		}
+	}
+
+	reason := fmt.Sprintf("classified as %s (%.2f)", category, top)
+	switch {
+	case m.rejectScore > 0 && top >= m.rejectScore:
+		return &types.ModerationVerdict{Action: types.ModerationReject, Text: text, Reason: reason}, nil
+	case m.holdScore > 0 && top >= m.holdScore:
+		return &types.ModerationVerdict{Action: types.ModerationHold, Text: text, Reason: reason}, nil
+	}
+
+	return nil, nil
+}
+
+// HTTPClassifier asks an external service, posting {"text": ...} and reading
+// {"scores": {"<category>": <score>}} back.
+type HTTPClassifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPClassifier(url string) *HTTPClassifier {
+	return &HTTPClassifier{url: url, client: &http.Client{Timeout: classifierTimeout}}
+}
+
+func (c *HTTPClassifier) Classify(text string) (map[string]float64, error) {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("classifier answered with status %d", res.StatusCode)
+	}
+
+	var result struct {
+		Scores map[string]float64 `json:"scores"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return result.Scores, nil
+}
@@ -0,0 +1,64 @@
+package moderation
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+// Config lists the moderators to run, as read from the moderation file.
+// Moderators left without rules are not added to the pipeline.
+type Config struct {
+	Words          []string `json:"words"`
+	Patterns       []string `json:"patterns"`
+	WordAction     string   `json:"wordAction"`
+	BlockedDomains []string `json:"blockedDomains"`
+	LinkAction     string   `json:"linkAction"`
+	ClassifierURL  string   `json:"classifierUrl"`
+	HoldScore      float64  `json:"holdScore"`
+	RejectScore    float64  `json:"rejectScore"`
+}
+
+// LoadPipeline builds the pipeline described by the JSON file at path. With
+// no path every message is allowed.
+func LoadPipeline(path string, store types.ModerationStore) (*Pipeline, error) {
+	var cfg Config
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewPipelineFromConfig(cfg, store)
+}
+
+func NewPipelineFromConfig(cfg Config, store types.ModerationStore) (*Pipeline, error) {
+	moderators := []Moderator{}
+
+	if len(cfg.Words) > 0 || len(cfg.Patterns) > 0 {
+		filter, err := NewWordFilter(cfg.Words, cfg.Patterns, cfg.WordAction)
+		if err != nil {
+			return nil, err
+		}
+		moderators = append(moderators, filter)
+	}
+
+	if len(cfg.BlockedDomains) > 0 {
+		blocklist, err := NewLinkBlocklist(cfg.BlockedDomains, cfg.LinkAction)
+		if err != nil {
+			return nil, err
+		}
+		moderators = append(moderators, blocklist)
+	}
+
+	if cfg.ClassifierURL != "" {
+		moderators = append(moderators, NewClassifierModerator(NewHTTPClassifier(cfg.ClassifierURL), cfg.HoldScore, cfg.RejectScore))
+	}
+
+	return NewPipeline(store, moderators...), nil
+}
@@ -0,0 +1,148 @@
+package moderation
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+// WordFilter acts on messages containing one of its words, matched as whole
+// words regardless of case, or matching one of its regular expressions.
+// Masking replaces each match with asterisks.
+type WordFilter struct {
+	action   string
+	patterns []*regexp.Regexp
+}
+
+func NewWordFilter(words, patterns []string, action string) (*WordFilter, error) {
+	if action == "" {
+		action = types.ModerationMask
+	}
+	if _, ok := severity[action]; !ok {
+		return nil, fmt.Errorf("unknown moderation action %q", action)
+	}
+
+	f := &WordFilter{action: action}
+	for _, w := range words {
+		if w == "" {
+			continue
+		}
+		f.patterns = append(f.patterns, regexp.MustCompile(`(?i)`+wordEdge(w[0])+regexp.QuoteMeta(w)+wordEdge(w[len(w)-1])))
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid moderation pattern %q: %w", p, err)
+		}
+		f.patterns = append(f.patterns, re)
+	}
+
+	return f, nil
+}
+
+// wordEdge anchors a word on the side ending with c. \b only holds next to a
+// word character, an edge that is not one, as in c++ or @admin, must not
+// touch a word character instead.
+func wordEdge(c byte) string {
+	if c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' {
+		return `\b`
+	}
+	return `\B`
+}
+
+func (f *WordFilter) Name() string {
+	return "word-filter"
+}
+
+func (f *WordFilter) Check(text string) (*types.ModerationVerdict, error) {
+	matched := false
+	masked := text
+	for _, re := range f.patterns {
+		masked = re.ReplaceAllStringFunc(masked, func(match string) string {
+			matched = true
+			return strings.Repeat("*", utf8.RuneCountInString(match))
+		})
+	}
+
+	if !matched {
+		return nil, nil
+	}
+
+	verdict := &types.ModerationVerdict{Action: f.action, Text: text, Reason: "contains a blocked word"}
+	if f.action == types.ModerationMask {
+		verdict.Text = masked
+	}
+
+	return verdict, nil
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://)?(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}(?::\d+)?(?:/\S*)?`)
+
+// LinkBlocklist acts on messages linking to one of its domains or their
+// subdomains. Masking replaces the links.
+type LinkBlocklist struct {
+	action  string
+	domains []string
+}
+
+func NewLinkBlocklist(domains []string, action string) (*LinkBlocklist, error) {
+	if action == "" {
+		action = types.ModerationReject
+	}
+	if _, ok := severity[action]; !ok {
+		return nil, fmt.Errorf("unknown moderation action %q", action)
+	}
+
+	l := &LinkBlocklist{action: action}
+	for _, d := range domains {
+		l.domains = append(l.domains, strings.ToLower(strings.TrimPrefix(d, ".")))
+	}
+
+	return l, nil
+}
+
+func (l *LinkBlocklist) Name() string {
+	return "link-blocklist"
+}
+
+func (l *LinkBlocklist) Check(text string) (*types.ModerationVerdict, error) {
+	blocked := ""
+	masked := linkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		host := hostOf(link)
+		for _, d := range l.domains {
+			if host == d || strings.HasSuffix(host, "."+d) {
+				blocked = d
+				return "[blocked link]"
+			}
+		}
+		return link
+	})
+
+	if blocked == "" {
+		return nil, nil
+	}
+
+	verdict := &types.ModerationVerdict{Action: l.action, Text: text, Reason: fmt.Sprintf("links to %s", blocked)}
+	if l.action == types.ModerationMask {
+		verdict.Text = masked
+	}
+
+	return verdict, nil
+}
+
+func hostOf(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
@@ -0,0 +1,69 @@
+package moderation
+
+import (
+	"log"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+// Moderator is one step of the pipeline. It returns a nil verdict, or one
+// with the allow action, when it has nothing against the text.
+type Moderator interface {
+	Name() string
+	Check(text string) (*types.ModerationVerdict, error)
+}
+
+var severity = map[string]int{
+	types.ModerationAllow:  0,
+	types.ModerationMask:   1,
+	types.ModerationHold:   2,
+	types.ModerationReject: 3,
+}
+
+// Pipeline runs the text of messages through its moderators in order. Masks
+// are applied as they come so the next moderators see the masked text, a
+// rejection stops the chain, and the most severe verdict is the one kept.
+//
+// A moderator failing to answer, like an external classifier being down, is
+// skipped rather than blocking every conversation.
+type Pipeline struct {
+	store      types.ModerationStore
+	moderators []Moderator
+}
+
+func NewPipeline(store types.ModerationStore, moderators ...Moderator) *Pipeline {
+	return &Pipeline{store: store, moderators: moderators}
+}
+
+func (p *Pipeline) Moderate(text string) (*types.ModerationVerdict, error) {
+	result := &types.ModerationVerdict{Action: types.ModerationAllow, Text: text}
+
+	for _, m := range p.moderators {
+		verdict, err := m.Check(result.Text)
+		if err != nil {
+			log.Printf("moderation: %s failed: %v", m.Name(), err)
+			continue
+		}
+		if verdict == nil || verdict.Action == types.ModerationAllow {
+			continue
+		}
+
+		if verdict.Action == types.ModerationMask {
+			result.Text = verdict.Text
+		}
+		if severity[verdict.Action] > severity[result.Action] {
+			result.Action = verdict.Action
+			result.Moderator = m.Name()
+			result.Reason = verdict.Reason
+		}
+		if verdict.Action == types.ModerationReject {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func (p *Pipeline) Record(decision types.ModerationDecision) error {
+	return p.store.CreateModerationDecision(decision)
+}
@@ -0,0 +1,144 @@
+package moderation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeline(t *testing.T) {
+	words, err := NewWordFilter([]string{"darn"}, []string{`\d{4}-\d{4}-\d{4}-\d{4}`}, "")
+	assert.NoError(t, err)
+	links, err := NewLinkBlocklist([]string{"spam.example"}, "")
+	assert.NoError(t, err)
+
+	t.Run("should allow clean text", func(t *testing.T) {
+		verdict, err := NewPipeline(&mockModerationStore{}, words, links).Moderate("hello there")
+		assert.NoError(t, err)
+		assert.Equal(t, types.ModerationAllow, verdict.Action)
+		assert.Equal(t, "hello there", verdict.Text)
+	})
+
+	t.Run("should mask blocked words and patterns", func(t *testing.T) {
+		verdict, err := NewPipeline(&mockModerationStore{}, words).Moderate("Darn, my card is 1234-5678-9012-3456 but darnit")
+		assert.NoError(t, err)
+		assert.Equal(t, types.ModerationMask, verdict.Action)
+		assert.Equal(t, "word-filter", verdict.Moderator)
+		assert.Equal(t, "****, my card is ******************* but darnit", verdict.Text)
+	})
+
+	t.Run("should match words that start or end with a symbol", func(t *testing.T) {
+		symbols, err := NewWordFilter([]string{"c++", "@admin"}, nil, "")
+		assert.NoError(t, err)
+
+		verdict, err := NewPipeline(&mockModerationStore{}, symbols).Moderate("C++ is fine, ask @admin.")
+		assert.NoError(t, err)
+		assert.Equal(t, "*** is fine, ask ******.", verdict.Text)
+
+		verdict, err = NewPipeline(&mockModerationStore{}, symbols).Moderate("c++x or me@admin")
+		assert.NoError(t, err)
+		assert.Equal(t, types.ModerationAllow, verdict.Action)
+	})
+
+	t.Run("should reject links to blocked domains and their subdomains", func(t *testing.T) {
+		for _, text := range []string{"see https://spam.example/deal", "go to www.spam.example now"} {
+			verdict, err := NewPipeline(&mockModerationStore{}, links).Moderate(text)
+			assert.NoError(t, err)
+			assert.Equal(t, types.ModerationReject, verdict.Action, text)
+		}
+
+		verdict, err := NewPipeline(&mockModerationStore{}, links).Moderate("see https://notspam.example")
+		assert.NoError(t, err)
+		assert.Equal(t, types.ModerationAllow, verdict.Action)
+	})
+
+	t.Run("should mask links when asked to", func(t *testing.T) {
+		masking, err := NewLinkBlocklist([]string{"spam.example"}, types.ModerationMask)
+		assert.NoError(t, err)
+
+		verdict, err := NewPipeline(&mockModerationStore{}, masking).Moderate("see spam.example/deal today")
+		assert.NoError(t, err)
+		assert.Equal(t, "see [blocked link] today", verdict.Text)
+	})
+
+	t.Run("should keep the most severe verdict and stop at a rejection", func(t *testing.T) {
+		after := &mockModerator{name: "after"}
+		pipeline := NewPipeline(&mockModerationStore{}, words, links, after)
+
+		verdict, err := pipeline.Moderate("darn, https://spam.example")
+		assert.NoError(t, err)
+		assert.Equal(t, types.ModerationReject, verdict.Action)
+		assert.Equal(t, "link-blocklist", verdict.Moderator)
+		assert.Equal(t, 0, after.calls, "expected the chain to stop")
+	})
+
+	t.Run("should skip moderators that fail", func(t *testing.T) {
+		failing := &mockModerator{name: "failing", err: fmt.Errorf("unavailable")}
+
+		verdict, err := NewPipeline(&mockModerationStore{}, failing, words).Moderate("darn")
+		assert.NoError(t, err)
+		assert.Equal(t, types.ModerationMask, verdict.Action)
+	})
+
+	t.Run("should refuse unknown actions", func(t *testing.T) {
+		_, err := NewWordFilter([]string{"darn"}, nil, "explode")
+		assert.Error(t, err)
+	})
+}
+
+func TestClassifier(t *testing.T) {
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+
+		scores := map[string]float64{"spam": 0.1, "harassment": 0.2}
+		switch received["text"] {
+		case "borderline":
+			scores["harassment"] = 0.7
+		case "awful":
+			scores["harassment"] = 0.95
+		case "down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"scores": scores})
+	}))
+	defer server.Close()
+
+	pipeline := NewPipeline(&mockModerationStore{}, NewClassifierModerator(NewHTTPClassifier(server.URL), 0.6, 0.9))
+
+	for text, action := range map[string]string{
+		"fine":       types.ModerationAllow,
+		"borderline": types.ModerationHold,
+		"awful":      types.ModerationReject,
+		"down":       types.ModerationAllow,
+	} {
+		verdict, err := pipeline.Moderate(text)
+		assert.NoError(t, err)
+		assert.Equal(t, action, verdict.Action, text)
+		assert.Equal(t, text, received["text"])
+	}
+
+	verdict, _ := pipeline.Moderate("awful")
+	assert.Equal(t, "classified as harassment (0.95)", verdict.Reason)
+}
+
+type mockModerator struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (m *mockModerator) Name() string {
+	return m.name
+}
+
+func (m *mockModerator) Check(text string) (*types.ModerationVerdict, error) {
+	m.calls++
+	return nil, m.err
+}
@@ -0,0 +1,70 @@
+package moderation
+
+import (
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type Handler struct {
+	store             types.ModerationStore
+	conversationStore types.ConversationStore
+	userStore         types.UserStore
+}
+
+func NewHandler(store types.ModerationStore, conversationStore types.ConversationStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, conversationStore: conversationStore, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Get("/conversations/:id/moderation-log", auth.WithJWTAuth(h.handleGetModerationLog, h.userStore))
+}
+
+// List the moderation decisions taken in a conversation, newest first
+func (h *Handler) handleGetModerationLog(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	limit := c.QueryInt("limit", defaultPageSize)
+	if limit <= 0 || limit > maxPageSize {
+		limit = defaultPageSize
+	}
+
+	decisions, err := h.store.GetModerationDecisionsByConversationID(conversationID, c.QueryInt("before"), limit)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(decisions)
+}
+
+// requireAdmin parses the conversation id and makes sure the current user is
+// one of its admins. It writes the error response itself when the check fails.
+func (h *Handler) requireAdmin(c *fiber.Ctx) (int, bool) {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+		return 0, false
+	}
+
+	p, err := h.conversationStore.GetParticipant(conversationID, auth.GetIDFromContext(c))
+	if err != nil || p.Role != types.RoleAdmin {
+		c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only conversation admins can see the moderation log",
+		})
+		return 0, false
+	}
+
+	return conversationID, true
+}
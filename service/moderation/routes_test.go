@@ -0,0 +1,179 @@
+package moderation
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModerationServiceHandlers(t *testing.T) {
+	store := &mockModerationStore{}
+	conversationStore := &mockConversationStore{
+		participants: map[int]string{1: types.RoleAdmin, 2: types.RoleMember},
+	}
+	handler := NewHandler(store, conversationStore, &mockUserStore{})
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	pipeline := NewPipeline(store, &mockModerator{name: "noop"})
+	for i := 0; i < 3; i++ {
+		pipeline.Record(types.ModerationDecision{ConversationID: 1, Action: types.ModerationMask, Content: fmt.Sprintf("darn %d", i)})
+	}
+
+	t.Run("should only let admins see the moderation log", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/conversations/1/moderation-log", nil, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should page through the moderation log", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/conversations/1/moderation-log?limit=2&before=3", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var decisions []types.ModerationDecision
+		json.NewDecoder(resp.Body).Decode(&decisions)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, decisions, 2)
+		assert.Equal(t, 2, decisions[0].ID)
+		assert.Equal(t, "darn 0", decisions[1].Content)
+	})
+}
+
+func newRequest(t *testing.T, method, target string, payload any, userID int) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+type mockModerationStore struct {
+	decisions []types.ModerationDecision
+}
+
+func (m *mockModerationStore) CreateModerationDecision(decision types.ModerationDecision) error {
+	decision.ID = len(m.decisions) + 1
+	m.decisions = append(m.decisions, decision)
+	return nil
+}
+
+func (m *mockModerationStore) GetModerationDecisionsByConversationID(conversationID, beforeID, limit int) ([]types.ModerationDecision, error) {
+	decisions := []types.ModerationDecision{}
+	for i := len(m.decisions) - 1; i >= 0 && len(decisions) < limit; i-- {
+		d := m.decisions[i]
+		if d.ConversationID == conversationID && (beforeID == 0 || d.ID < beforeID) {
+			decisions = append(decisions, d)
+		}
+	}
+	return decisions, nil
+}
+
+type mockConversationStore struct {
+	participants map[int]string
+}
+
+func (m *mockConversationStore) CreateConversation(name string, creatorID int, participantIDs []int) (*types.Conversation, error) {
+	return &types.Conversation{ID: 1}, nil
+}
+
+func (m *mockConversationStore) GetConversationByID(id int) (*types.Conversation, error) {
+	return &types.Conversation{ID: id}, nil
+}
+
+func (m *mockConversationStore) GetParticipant(conversationID, userID int) (*types.Participant, error) {
+	if role, ok := m.participants[userID]; ok {
+		return &types.Participant{ConversationID: conversationID, UserID: userID, Role: role}, nil
+	}
+	return nil, fmt.Errorf("participant not found")
+}
+
+func (m *mockConversationStore) GetParticipants(conversationID int) ([]types.Participant, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) RemoveParticipant(conversationID, userID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) MarkRead(conversationID, userID, messageID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) GetContactIDs(userID int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) ExportMessages(conversationID int, fn func(*types.ExportedMessage) error) error {
+	return nil
+}
+
+func (m *mockConversationStore) UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error {
+	return nil
+}
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
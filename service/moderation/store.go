@@ -0,0 +1,71 @@
+package moderation
+
+import (
+	"database/sql"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateModerationDecision(d types.ModerationDecision) error {
+	_, err := s.db.Exec(
+		"INSERT INTO moderation_decisions (message_id, conversation_id, user_id, action, moderator, reason, content) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		d.MessageID, d.ConversationID, d.UserID, d.Action, d.Moderator, d.Reason, d.Content,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetModerationDecisionsByConversationID returns a page of decisions, newest
+// first. beforeID of 0 starts from the latest one.
+func (s *Store) GetModerationDecisionsByConversationID(conversationID, beforeID, limit int) ([]types.ModerationDecision, error) {
+	rows, err := s.db.Query(
+		"SELECT * FROM moderation_decisions WHERE conversation_id = ? AND (? = 0 OR id < ?) ORDER BY id DESC LIMIT ?",
+		conversationID, beforeID, beforeID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decisions := []types.ModerationDecision{}
+	for rows.Next() {
+		d, err := scanRowIntoModerationDecision(rows)
+		if err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, *d)
+	}
+
+	return decisions, nil
+}
+
+func scanRowIntoModerationDecision(rows *sql.Rows) (*types.ModerationDecision, error) {
+	d := new(types.ModerationDecision)
+
+	err := rows.Scan(
+		&d.ID,
+		&d.MessageID,
+		&d.ConversationID,
+		&d.UserID,
+		&d.Action,
+		&d.Moderator,
+		&d.Reason,
+		&d.Content,
+		&d.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
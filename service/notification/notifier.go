@@ -0,0 +1,154 @@
+package notification
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+const maxBodyLength = 200
+
+// Notifier hands the events going through it to the next publisher, and
+// notifies the recipients of new messages who are not connected through the
+// notification providers.
+type Notifier struct {
+	next              types.EventPublisher
+	conversationStore types.ConversationStore
+	userStore         types.UserStore
+	presence          types.PresenceChecker
+	providers         []types.NotificationProvider
+	now               func() time.Time
+	wg                sync.WaitGroup
+}
+
+func NewNotifier(next types.EventPublisher, conversationStore types.ConversationStore, userStore types.UserStore, presence types.PresenceChecker, providers ...types.NotificationProvider) *Notifier {
+	return &Notifier{
+		next:              next,
+		conversationStore: conversationStore,
+		userStore:         userStore,
+		presence:          presence,
+		providers:         providers,
+		now:               time.Now,
+	}
+}
+
+func (n *Notifier) SendToUser(userID int, event types.Event, exceptDevice string) {
+	n.next.SendToUser(userID, event, exceptDevice)
+	n.notify([]int{userID}, event)
+}
+
+func (n *Notifier) SendToUsers(userIDs []int, event types.Event) {
+	n.next.SendToUsers(userIDs, event)
+	n.notify(userIDs, event)
+}
+
+// Wait blocks until every notification in flight is delivered.
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+// notify runs in the background, a slow push service must not hold up the
+// request that sent the message.
+func (n *Notifier) notify(userIDs []int, event types.Event) {
+	if event.Type != types.EventMessageCreated || len(n.providers) == 0 {
+		return
+	}
+
+	var message types.Message
+	switch m := event.Payload.(type) {
+	case *types.Message:
+		message = *m
+	case types.Message:
+		message = m
+	default:
+		return
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+
+		var notification *types.Notification
+		for _, userID := range userIDs {
+			if !n.shouldNotify(userID, &message) {
+				continue
+			}
+
+			// only built once someone is to be notified
+			if notification == nil {
+				notification = n.build(&message)
+			}
+
+			notification.UserID = userID
+			for _, provider := range n.providers {
+				if err := provider.Notify(*notification); err != nil {
+					log.Printf("notification: %s failed to notify user %d: %v", provider.Name(), userID, err)
+				}
+			}
+		}
+	}()
+}
+
+// shouldNotify applies the settings the recipient chose for the
+// conversation. Connected users already got the message.
+func (n *Notifier) shouldNotify(userID int, message *types.Message) bool {
+	if userID == message.SenderID || n.presence.IsOnline(userID) {
+		return false
+	}
+
+	p, err := n.conversationStore.GetParticipant(message.ConversationID, userID)
+	if err != nil {
+		return false
+	}
+
+	if p.MutedUntil.Valid && p.MutedUntil.Time.After(n.now()) {
+		return false
+	}
+
+	switch p.Notifications {
+	case types.NotifyNone:
+		return false
+	case types.NotifyMentions:
+		return message.Type != types.MessageTypeEncrypted && mentions(message.Content, userID)
+	default:
+		return true
+	}
+}
+
+func (n *Notifier) build(message *types.Message) *types.Notification {
+	notification := &types.Notification{
+		ConversationID: message.ConversationID,
+		MessageID:      message.ID,
+		Title:          message.SenderName.String,
+		Body:           truncate(message.Content, maxBodyLength),
+	}
+
+	if message.SenderID != 0 {
+		if sender, err := n.userStore.GetUserByID(message.SenderID); err == nil {
+			notification.Title = strings.TrimSpace(sender.FirstName + " " + sender.LastName)
+		}
+	}
+
+	// the server cannot read them, and should not leak them to push services
+	if message.Type == types.MessageTypeEncrypted {
+		notification.Body = "New encrypted message"
+	}
+
+	return notification
+}
+
+func mentions(content string, userID int) bool {
+	return strings.Contains(content, fmt.Sprintf("<@%d>", userID))
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
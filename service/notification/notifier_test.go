@@ -0,0 +1,104 @@
+package notification
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifier(t *testing.T) {
+	now := time.Date(2024, 8, 9, 12, 0, 0, 0, time.UTC)
+	conversationStore := &mockConversationStore{participants: map[int]types.Participant{
+		1: {UserID: 1, Notifications: types.NotifyAll},
+		2: {UserID: 2, Notifications: types.NotifyAll},
+		3: {UserID: 3, Notifications: types.NotifyAll},
+		4: {UserID: 4, Notifications: types.NotifyMentions},
+		5: {UserID: 5, Notifications: types.NotifyNone},
+		6: {UserID: 6, Notifications: types.NotifyAll, MutedUntil: sql.NullTime{Time: now.Add(time.Hour), Valid: true}},
+		7: {UserID: 7, Notifications: types.NotifyAll, MutedUntil: sql.NullTime{Time: now.Add(-time.Hour), Valid: true}},
+	}}
+	presence := &mockPresence{online: map[int]bool{2: true}}
+
+	newNotifier := func() (*Notifier, *mockPublisher, *mockProvider) {
+		next := &mockPublisher{}
+		provider := &mockProvider{}
+		n := NewNotifier(next, conversationStore, &mockUserStore{}, presence, provider)
+		n.now = func() time.Time { return now }
+		return n, next, provider
+	}
+
+	recipients := func(provider *mockProvider) []int {
+		userIDs := []int{}
+		for _, n := range provider.sent {
+			userIDs = append(userIDs, n.UserID)
+		}
+		return userIDs
+	}
+
+	allUsers := []int{1, 2, 3, 4, 5, 6, 7}
+
+	t.Run("should only notify offline recipients who want it", func(t *testing.T) {
+		n, next, provider := newNotifier()
+
+		message := &types.Message{ID: 10, ConversationID: 1, SenderID: 1, Content: "lunch?", Type: types.MessageTypeText}
+		n.SendToUsers(allUsers, types.Event{Type: types.EventMessageCreated, Payload: message})
+		n.Wait()
+
+		assert.Equal(t, [][]int{allUsers}, next.userIDs, "expected the event to be forwarded")
+		assert.ElementsMatch(t, []int{3, 7}, recipients(provider))
+		assert.Equal(t, types.Notification{UserID: 3, ConversationID: 1, MessageID: 10, Title: "Jane Doe", Body: "lunch?"}, provider.sent[0])
+	})
+
+	t.Run("should notify users who only want mentions when mentioned", func(t *testing.T) {
+		n, _, provider := newNotifier()
+
+		message := &types.Message{ID: 11, ConversationID: 1, SenderID: 1, Content: "<@4> can you review?", Type: types.MessageTypeText}
+		n.SendToUsers(allUsers, types.Event{Type: types.EventMessageCreated, Payload: message})
+		n.Wait()
+
+		assert.ElementsMatch(t, []int{3, 4, 7}, recipients(provider))
+	})
+
+	t.Run("should hide the content of encrypted messages", func(t *testing.T) {
+		n, _, provider := newNotifier()
+
+		message := &types.Message{ID: 12, ConversationID: 1, SenderID: 1, Type: types.MessageTypeEncrypted}
+		for _, userID := range allUsers {
+			n.SendToUser(userID, types.Event{Type: types.EventMessageCreated, Payload: message}, "")
+		}
+		n.Wait()
+
+		assert.ElementsMatch(t, []int{3, 7}, recipients(provider))
+		assert.Equal(t, "New encrypted message", provider.sent[0].Body)
+	})
+
+	t.Run("should use the name of the bot and truncate long messages", func(t *testing.T) {
+		n, _, provider := newNotifier()
+
+		message := &types.Message{
+			ID: 13, ConversationID: 1, Type: types.MessageTypeText,
+			SenderName: sql.NullString{String: "CI", Valid: true},
+			Content:    strings.Repeat("é", 300),
+		}
+		n.SendToUsers([]int{3}, types.Event{Type: types.EventMessageCreated, Payload: message})
+		n.Wait()
+
+		assert.Len(t, provider.sent, 1)
+		assert.Equal(t, "CI", provider.sent[0].Title)
+		assert.Equal(t, maxBodyLength, len([]rune(provider.sent[0].Body)))
+	})
+
+	t.Run("should ignore other events", func(t *testing.T) {
+		n, next, provider := newNotifier()
+
+		n.SendToUsers([]int{3}, types.Event{Type: types.EventMessageUpdated, Payload: &types.Message{ID: 10, ConversationID: 1}})
+		n.Wait()
+
+		assert.Len(t, next.userIDs, 1)
+		assert.Empty(t, provider.sent)
+	})
+}
@@ -0,0 +1,132 @@
+package notification
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	store          types.PushSubscriptionStore
+	userStore      types.UserStore
+	vapidPublicKey string
+}
+
+// NewHandler takes the VAPID public key browsers subscribe with, empty
+// when Web Push is not configured.
+func NewHandler(store types.PushSubscriptionStore, userStore types.UserStore, vapidPublicKey string) *Handler {
+	return &Handler{store: store, userStore: userStore, vapidPublicKey: vapidPublicKey}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Get("/push/vapid-public-key", h.handleGetVAPIDPublicKey)
+	router.Post("/push/subscriptions", auth.WithJWTAuth(h.handleSubscribe, h.userStore))
+	router.Delete("/push/subscriptions", auth.WithJWTAuth(h.handleUnsubscribe, h.userStore))
+}
+
+// Get the key browsers pass to pushManager.subscribe() as applicationServerKey
+func (h *Handler) handleGetVAPIDPublicKey(c *fiber.Ctx) error {
+	if h.vapidPublicKey == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "push notifications are not enabled",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"publicKey": h.vapidPublicKey,
+	})
+}
+
+// Register the push subscription of a browser
+func (h *Handler) handleSubscribe(c *fiber.Ctx) error {
+	if h.vapidPublicKey == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "push notifications are not enabled",
+		})
+	}
+
+	var payload types.PushSubscriptionPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	if _, _, err := DecodeKeys(payload.Keys.P256dh, payload.Keys.Auth); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var expiresAt sql.NullTime
+	if payload.ExpirationTime != nil {
+		expiresAt = sql.NullTime{Time: time.UnixMilli(*payload.ExpirationTime), Valid: true}
+	}
+
+	err := h.store.SavePushSubscription(types.PushSubscription{
+		UserID:    auth.GetIDFromContext(c),
+		Endpoint:  payload.Endpoint,
+		P256dh:    payload.Keys.P256dh,
+		Auth:      payload.Keys.Auth,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "push subscription saved",
+	})
+}
+
+// Remove the push subscription of a browser, on logout or when the user
+// turns notifications off
+func (h *Handler) handleUnsubscribe(c *fiber.Ctx) error {
+	var payload types.DeletePushSubscriptionPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	if err := h.store.DeletePushSubscriptionByEndpoint(auth.GetIDFromContext(c), payload.Endpoint); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "push subscription deleted",
+	})
+}
@@ -0,0 +1,318 @@
+package notification
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationServiceHandlers(t *testing.T) {
+	browser := newBrowser(t)
+	store := newMockPushSubscriptionStore()
+	handler := NewHandler(store, &mockUserStore{}, "BPublicKey")
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	t.Run("should return the VAPID public key", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/push/vapid-public-key", nil)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var body map[string]string
+		json.NewDecoder(resp.Body).Decode(&body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "BPublicKey", body["publicKey"])
+	})
+
+	t.Run("should save a push subscription", func(t *testing.T) {
+		expiration := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+		payload := browser.subscription("https://push.example.com/send/abc")
+		payload.ExpirationTime = &expiration
+		req := newRequest(t, http.MethodPost, "/push/subscriptions", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Len(t, store.subs, 1)
+		assert.Equal(t, 1, store.subs[0].UserID)
+		assert.True(t, store.subs[0].ExpiresAt.Time.Equal(time.UnixMilli(expiration)))
+	})
+
+	t.Run("should reject keys that are not a P-256 point", func(t *testing.T) {
+		payload := browser.subscription("https://push.example.com/send/def")
+		payload.Keys.P256dh = "AAAA"
+		req := newRequest(t, http.MethodPost, "/push/subscriptions", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Len(t, store.subs, 1)
+	})
+
+	t.Run("should only delete the subscriptions of the user", func(t *testing.T) {
+		payload := types.DeletePushSubscriptionPayload{Endpoint: "https://push.example.com/send/abc"}
+		req := newRequest(t, http.MethodDelete, "/push/subscriptions", payload, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		resp.Body.Close()
+		assert.Len(t, store.subs, 1)
+
+		req = newRequest(t, http.MethodDelete, "/push/subscriptions", payload, 1)
+
+		resp, err = app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, store.subs)
+	})
+
+	t.Run("should answer 404 when push is not enabled", func(t *testing.T) {
+		app := fiber.New()
+		NewHandler(store, &mockUserStore{}, "").RegisterRoutes(app)
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/push/vapid-public-key", nil))
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func newRequest(t *testing.T, method, target string, payload any, userID int) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+type mockPushSubscriptionStore struct {
+	mu     sync.Mutex
+	subs   []types.PushSubscription
+	nextID int
+}
+
+func newMockPushSubscriptionStore() *mockPushSubscriptionStore {
+	return &mockPushSubscriptionStore{nextID: 1}
+}
+
+func (m *mockPushSubscriptionStore) SavePushSubscription(sub types.PushSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.subs {
+		if m.subs[i].Endpoint == sub.Endpoint {
+			sub.ID = m.subs[i].ID
+			m.subs[i] = sub
+			return nil
+		}
+	}
+
+	sub.ID = m.nextID
+	m.nextID++
+	m.subs = append(m.subs, sub)
+	return nil
+}
+
+func (m *mockPushSubscriptionStore) GetPushSubscriptionsByUserID(userID int) ([]types.PushSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subs := []types.PushSubscription{}
+	for _, sub := range m.subs {
+		if sub.UserID == userID {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+func (m *mockPushSubscriptionStore) DeletePushSubscription(id int) error {
+	return m.deleteWhere(func(sub types.PushSubscription) bool { return sub.ID == id })
+}
+
+func (m *mockPushSubscriptionStore) DeletePushSubscriptionByEndpoint(userID int, endpoint string) error {
+	return m.deleteWhere(func(sub types.PushSubscription) bool {
+		return sub.UserID == userID && sub.Endpoint == endpoint
+	})
+}
+
+func (m *mockPushSubscriptionStore) DeleteExpiredPushSubscriptions(now time.Time) (int64, error) {
+	m.mu.Lock()
+	before := len(m.subs)
+	m.mu.Unlock()
+
+	m.deleteWhere(func(sub types.PushSubscription) bool {
+		return sub.ExpiresAt.Valid && !sub.ExpiresAt.Time.After(now)
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(before - len(m.subs)), nil
+}
+
+func (m *mockPushSubscriptionStore) deleteWhere(match func(types.PushSubscription) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.subs[:0]
+	for _, sub := range m.subs {
+		if !match(sub) {
+			kept = append(kept, sub)
+		}
+	}
+	m.subs = kept
+	return nil
+}
+
+type mockConversationStore struct {
+	participants map[int]types.Participant
+}
+
+func (m *mockConversationStore) CreateConversation(name string, creatorID int, participantIDs []int) (*types.Conversation, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) GetConversationByID(id int) (*types.Conversation, error) {
+	return &types.Conversation{ID: id}, nil
+}
+
+func (m *mockConversationStore) GetParticipant(conversationID, userID int) (*types.Participant, error) {
+	if p, ok := m.participants[userID]; ok {
+		return &p, nil
+	}
+	return nil, fmt.Errorf("participant not found")
+}
+
+func (m *mockConversationStore) GetParticipants(conversationID int) ([]types.Participant, error) {
+	participants := []types.Participant{}
+	for _, p := range m.participants {
+		participants = append(participants, p)
+	}
+	return participants, nil
+}
+
+func (m *mockConversationStore) RemoveParticipant(conversationID, userID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) MarkRead(conversationID, userID, messageID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) GetContactIDs(userID int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) ExportMessages(conversationID int, fn func(*types.ExportedMessage) error) error {
+	return nil
+}
+
+func (m *mockConversationStore) UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error {
+	return nil
+}
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id, FirstName: "Jane", LastName: "Doe"}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
+
+type mockPublisher struct {
+	userIDs [][]int
+}
+
+func (m *mockPublisher) SendToUser(userID int, event types.Event, exceptDevice string) {
+	m.userIDs = append(m.userIDs, []int{userID})
+}
+
+func (m *mockPublisher) SendToUsers(userIDs []int, event types.Event) {
+	m.userIDs = append(m.userIDs, userIDs)
+}
+
+type mockPresence struct {
+	online map[int]bool
+}
+
+func (m *mockPresence) IsOnline(userID int) bool {
+	return m.online[userID]
+}
+
+type mockProvider struct {
+	mu   sync.Mutex
+	sent []types.Notification
+}
+
+func (m *mockProvider) Name() string {
+	return "mock"
+}
+
+func (m *mockProvider) Notify(n types.Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, n)
+	return nil
+}
@@ -0,0 +1,119 @@
+package notification
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) SavePushSubscription(sub types.PushSubscription) error {
+	// a browser keeps its endpoint when another user logs in, the
+	// subscription then moves to them
+	_, err := s.db.Exec(
+		`INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, expiresAt) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), p256dh = VALUES(p256dh), auth = VALUES(auth), expiresAt = VALUES(expiresAt)`,
+		sub.UserID, sub.Endpoint, sub.P256dh, sub.Auth, sub.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) GetPushSubscriptionsByUserID(userID int) ([]types.PushSubscription, error) {
+	rows, err := s.db.Query(
+		"SELECT * FROM push_subscriptions WHERE user_id = ? AND (expiresAt IS NULL OR expiresAt > ?)",
+		userID, time.Now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []types.PushSubscription{}
+	for rows.Next() {
+		sub, err := scanRowIntoPushSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+
+	return subs, nil
+}
+
+func (s *Store) DeletePushSubscription(id int) error {
+	_, err := s.db.Exec("DELETE FROM push_subscriptions WHERE id = ?;", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) DeletePushSubscriptionByEndpoint(userID int, endpoint string) error {
+	_, err := s.db.Exec("DELETE FROM push_subscriptions WHERE user_id = ? AND endpoint = ?;", userID, endpoint)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) DeleteExpiredPushSubscriptions(now time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM push_subscriptions WHERE expiresAt IS NOT NULL AND expiresAt <= ?;", now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Cleanup drops the expired push subscriptions every interval, until stop
+// is closed.
+func Cleanup(store types.PushSubscriptionStore, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			deleted, err := store.DeleteExpiredPushSubscriptions(time.Now())
+			if err != nil {
+				log.Printf("notification: cleanup failed: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("notification: deleted %d expired push subscriptions", deleted)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func scanRowIntoPushSubscription(rows *sql.Rows) (*types.PushSubscription, error) {
+	sub := new(types.PushSubscription)
+
+	err := rows.Scan(
+		&sub.ID,
+		&sub.UserID,
+		&sub.Endpoint,
+		&sub.P256dh,
+		&sub.Auth,
+		&sub.ExpiresAt,
+		&sub.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
@@ -0,0 +1,284 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// how long push services keep a notification for an unreachable device
+	pushTTL = 24 * time.Hour
+	// lifetime of the VAPID tokens, push services refuse more than a day
+	vapidExpiration = 12 * time.Hour
+	// a single record is sent, it holds the whole payload
+	recordSize     = 4096
+	requestTimeout = 10 * time.Second
+)
+
+// WebPush delivers notifications through the Web Push protocol to the push
+// subscriptions of the browsers of a user. Payloads are encrypted for the
+// browser (RFC 8291) and requests are signed with the VAPID keys of the
+// server (RFC 8292).
+type WebPush struct {
+	store     types.PushSubscriptionStore
+	client    *http.Client
+	key       *ecdsa.PrivateKey
+	publicKey string
+	subject   string
+}
+
+// NewWebPush takes the VAPID key pair encoded as unpadded base64url, the
+// public key as an uncompressed P-256 point and the private key as its
+// 32 bytes scalar. The subject is a mailto: or https: URL push services can
+// reach the operator at.
+func NewWebPush(store types.PushSubscriptionStore, publicKey, privateKey, subject string) (*WebPush, error) {
+	d, err := base64.RawURLEncoding.DecodeString(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	priv, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	pub := priv.PublicKey().Bytes()
+	if base64.RawURLEncoding.EncodeToString(pub) != publicKey {
+		return nil, fmt.Errorf("the VAPID public key does not match the private key")
+	}
+
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(pub[1:33]),
+			Y:     new(big.Int).SetBytes(pub[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}
+
+	return &WebPush{
+		store:     store,
+		client:    &http.Client{Timeout: requestTimeout},
+		key:       key,
+		publicKey: publicKey,
+		subject:   subject,
+	}, nil
+}
+
+func (w *WebPush) Name() string {
+	return "webpush"
+}
+
+// Notify pushes the notification to every browser the user subscribed
+// from. Subscriptions the push service no longer knows are dropped.
+func (w *WebPush) Notify(notification types.Notification) error {
+	subs, err := w.store.GetPushSubscriptionsByUserID(notification.UserID)
+	if err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sub := range subs {
+		if err := w.send(sub, payload); err != nil {
+			errs = append(errs, fmt.Errorf("subscription %d: %w", sub.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (w *WebPush) send(sub types.PushSubscription, payload []byte) error {
+	uaPublic, authSecret, err := DecodeKeys(sub.P256dh, sub.Auth)
+	if err != nil {
+		return err
+	}
+
+	body, err := encrypt(payload, uaPublic, authSecret)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := w.vapid(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(pushTTL.Seconds())))
+	req.Header.Set("Authorization", authorization)
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		// the browser unsubscribed or the subscription expired
+		if err := w.store.DeletePushSubscription(sub.ID); err != nil {
+			log.Printf("notification: failed to delete push subscription %d: %v", sub.ID, err)
+		}
+		return nil
+	case res.StatusCode < 200 || res.StatusCode >= 300:
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// vapid builds the Authorization header identifying the server to the push
+// service of the endpoint.
+func (w *WebPush) vapid(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(vapidExpiration).Unix(),
+		"sub": w.subject,
+	})
+
+	signed, err := token.SignedString(w.key)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("vapid t=%s, k=%s", signed, w.publicKey), nil
+}
+
+// DecodeKeys checks the keys of a push subscription, the public key of the
+// browser is a P-256 point and the authentication secret is 16 bytes long.
+func DecodeKeys(p256dh, auth string) ([]byte, []byte, error) {
+	uaPublic, err := base64.RawURLEncoding.DecodeString(p256dh)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid p256dh key")
+	}
+	if _, err := ecdh.P256().NewPublicKey(uaPublic); err != nil {
+		return nil, nil, fmt.Errorf("invalid p256dh key")
+	}
+
+	authSecret, err := base64.RawURLEncoding.DecodeString(auth)
+	if err != nil || len(authSecret) != 16 {
+		return nil, nil, fmt.Errorf("invalid auth secret")
+	}
+
+	return uaPublic, authSecret, nil
+}
+
+// encrypt seals the payload for the browser with the aes128gcm content
+// encoding, using a new key pair and salt for every message.
+func encrypt(plaintext, uaPublic, authSecret []byte) ([]byte, error) {
+	// the padding delimiter and the tag have to fit in the record
+	if len(plaintext)+1+16 > recordSize {
+		return nil, fmt.Errorf("payload too large")
+	}
+
+	curve := ecdh.P256()
+	ua, err := curve.NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	as, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := as.PublicKey().Bytes()
+
+	shared, err := as.ECDH(ua)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	cek, nonce, err := deriveKeys(shared, authSecret, salt, uaPublic, asPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// 0x02 marks the last record, no padding follows
+	record := append(append([]byte{}, plaintext...), 0x02)
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+// deriveKeys computes the content encryption key and the nonce from the
+// shared secret, as described in RFC 8291 section 3.4.
+func deriveKeys(shared, authSecret, salt, uaPublic, asPublic []byte) ([]byte, []byte, error) {
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, authSecret, keyInfo), ikm); err != nil {
+		return nil, nil, err
+	}
+
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return cek, nonce, nil
+}
@@ -0,0 +1,276 @@
+package notification
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebPush(t *testing.T) {
+	vapid, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := base64.RawURLEncoding.EncodeToString(vapid.PublicKey().Bytes())
+	privateKey := base64.RawURLEncoding.EncodeToString(vapid.Bytes())
+
+	browser := newBrowser(t)
+	service := newPushService(browser, publicKey)
+	defer service.Close()
+
+	t.Run("should reject mismatched VAPID keys", func(t *testing.T) {
+		other, _ := ecdh.P256().GenerateKey(rand.Reader)
+		_, err := NewWebPush(newMockPushSubscriptionStore(), publicKey, base64.RawURLEncoding.EncodeToString(other.Bytes()), "mailto:ops@example.com")
+		assert.Error(t, err)
+	})
+
+	t.Run("should push an encrypted and signed notification", func(t *testing.T) {
+		store := newMockPushSubscriptionStore()
+		store.SavePushSubscription(browser.subscriptionFor(1, service.URL+"/push/abc"))
+
+		w, err := NewWebPush(store, publicKey, privateKey, "mailto:ops@example.com")
+		assert.NoError(t, err)
+
+		notification := types.Notification{UserID: 1, ConversationID: 2, MessageID: 3, Title: "Jane Doe", Body: "lunch?"}
+		assert.NoError(t, w.Notify(notification))
+
+		received := service.last()
+		assert.Equal(t, "aes128gcm", received.encoding)
+		assert.Equal(t, "86400", received.ttl)
+		assert.Equal(t, service.URL, received.audience)
+		assert.Equal(t, "mailto:ops@example.com", received.subject)
+		// the recipient is not part of the payload
+		notification.UserID = 0
+		assert.Equal(t, notification, received.notification)
+	})
+
+	t.Run("should drop subscriptions the push service no longer knows", func(t *testing.T) {
+		store := newMockPushSubscriptionStore()
+		store.SavePushSubscription(browser.subscriptionFor(1, service.URL+"/gone/abc"))
+
+		w, _ := NewWebPush(store, publicKey, privateKey, "mailto:ops@example.com")
+		assert.NoError(t, w.Notify(types.Notification{UserID: 1, Title: "Jane Doe"}))
+
+		assert.Empty(t, store.subs)
+	})
+
+	t.Run("should report other failures", func(t *testing.T) {
+		store := newMockPushSubscriptionStore()
+		store.SavePushSubscription(browser.subscriptionFor(1, service.URL+"/fail/abc"))
+
+		w, _ := NewWebPush(store, publicKey, privateKey, "mailto:ops@example.com")
+		assert.Error(t, w.Notify(types.Notification{UserID: 1, Title: "Jane Doe"}))
+		assert.Len(t, store.subs, 1)
+	})
+
+	t.Run("should delete expired subscriptions", func(t *testing.T) {
+		store := newMockPushSubscriptionStore()
+		expired := browser.subscriptionFor(1, service.URL+"/push/old")
+		expired.ExpiresAt.Time, expired.ExpiresAt.Valid = time.Now().Add(-time.Minute), true
+		store.SavePushSubscription(expired)
+		store.SavePushSubscription(browser.subscriptionFor(1, service.URL+"/push/new"))
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			Cleanup(store, 10*time.Millisecond, stop)
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool {
+			subs, _ := store.GetPushSubscriptionsByUserID(1)
+			return len(subs) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		close(stop)
+		<-done
+	})
+}
+
+// browser holds the keys a browser generates when subscribing to push.
+type browser struct {
+	key        *ecdh.PrivateKey
+	authSecret []byte
+}
+
+func newBrowser(t *testing.T) *browser {
+	t.Helper()
+
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authSecret := make([]byte, 16)
+	rand.Read(authSecret)
+
+	return &browser{key: key, authSecret: authSecret}
+}
+
+func (b *browser) subscription(endpoint string) types.PushSubscriptionPayload {
+	return types.PushSubscriptionPayload{
+		Endpoint: endpoint,
+		Keys: types.PushSubscriptionKeys{
+			P256dh: base64.RawURLEncoding.EncodeToString(b.key.PublicKey().Bytes()),
+			Auth:   base64.RawURLEncoding.EncodeToString(b.authSecret),
+		},
+	}
+}
+
+func (b *browser) subscriptionFor(userID int, endpoint string) types.PushSubscription {
+	payload := b.subscription(endpoint)
+	return types.PushSubscription{UserID: userID, Endpoint: endpoint, P256dh: payload.Keys.P256dh, Auth: payload.Keys.Auth}
+}
+
+// decrypt reverses the aes128gcm encoding the way the browser does.
+func (b *browser) decrypt(body []byte) ([]byte, error) {
+	salt := body[:16]
+	rs := binary.BigEndian.Uint32(body[16:20])
+	idlen := int(body[20])
+	asPublic := body[21 : 21+idlen]
+	ciphertext := body[21+idlen:]
+	if len(ciphertext) > int(rs) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	as, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := b.key.ECDH(as)
+	if err != nil {
+		return nil, err
+	}
+
+	cek, nonce, err := deriveKeys(shared, b.authSecret, salt, b.key.PublicKey().Bytes(), asPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// strip the padding delimiter
+	return record[:len(record)-1], nil
+}
+
+type pushed struct {
+	encoding     string
+	ttl          string
+	audience     string
+	subject      string
+	notification types.Notification
+}
+
+// pushService stands in for the push service of a browser. It checks the
+// VAPID signature and decrypts the payload, answering 410 on /gone and 500
+// on /fail.
+type pushService struct {
+	*httptest.Server
+	mu       sync.Mutex
+	received []pushed
+}
+
+func newPushService(b *browser, vapidPublicKey string) *pushService {
+	s := &pushService{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/gone"):
+			w.WriteHeader(http.StatusGone)
+			return
+		case strings.HasPrefix(r.URL.Path, "/fail"):
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var token, key string
+		for _, part := range strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "vapid "), ", ") {
+			name, value, _ := strings.Cut(part, "=")
+			switch name {
+			case "t":
+				token = value
+			case "k":
+				key = value
+			}
+		}
+		if key != vapidPublicKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		raw, _ := base64.RawURLEncoding.DecodeString(key)
+		verifyKey := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(raw[1:33]),
+			Y:     new(big.Int).SetBytes(raw[33:]),
+		}
+
+		claims := jwt.MapClaims{}
+		if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) { return verifyKey, nil }, jwt.WithValidMethods([]string{"ES256"})); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		plaintext, err := b.decrypt(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		p := pushed{
+			encoding: r.Header.Get("Content-Encoding"),
+			ttl:      r.Header.Get("TTL"),
+			audience: claims["aud"].(string),
+			subject:  claims["sub"].(string),
+		}
+		json.Unmarshal(plaintext, &p.notification)
+
+		s.mu.Lock()
+		s.received = append(s.received, p)
+		s.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	return s
+}
+
+func (s *pushService) last() pushed {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.received) == 0 {
+		return pushed{}
+	}
+	return s.received[len(s.received)-1]
+}
@@ -0,0 +1,57 @@
+package pubsub
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Memory is a PubSub for a single instance, messages never leave the
+// process.
+type Memory struct {
+	mu     sync.RWMutex
+	subs   map[string][]func(data []byte)
+	closed bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{subs: map[string][]func(data []byte){}}
+}
+
+func (m *Memory) Publish(channel string, data []byte) error {
+	m.mu.RLock()
+	if m.closed {
+		m.mu.RUnlock()
+		return fmt.Errorf("pubsub is closed")
+	}
+	subs := m.subs[channel]
+	m.mu.RUnlock()
+
+	// subscribers run outside of the lock so they may publish themselves
+	for _, fn := range subs {
+		fn(data)
+	}
+
+	return nil
+}
+
+func (m *Memory) Subscribe(channel string, fn func(data []byte)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return fmt.Errorf("pubsub is closed")
+	}
+	m.subs[channel] = append(m.subs[channel], fn)
+
+	return nil
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	m.subs = map[string][]func(data []byte){}
+
+	return nil
+}
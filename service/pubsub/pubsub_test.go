@@ -0,0 +1,74 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	ps := NewMemory()
+	testPubSub(t, ps, ps)
+
+	t.Run("should fail once closed", func(t *testing.T) {
+		ps.Close()
+		assert.Error(t, ps.Publish("events", []byte("late")))
+	})
+}
+
+func TestRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	// two instances of the API sharing one server
+	a, err := NewRedis("redis://" + server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	b, err := NewRedis("redis://" + server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	testPubSub(t, a, b)
+
+	t.Run("should fail for an unreachable server", func(t *testing.T) {
+		_, err := NewRedis("redis://127.0.0.1:1")
+		assert.Error(t, err)
+	})
+}
+
+// testPubSub checks messages published on one side reach the subscribers of
+// the other.
+func testPubSub(t *testing.T, publisher, subscriber types.PubSub) {
+	t.Run("should deliver to subscribers of the channel", func(t *testing.T) {
+		events := make(chan string, 4)
+		others := make(chan string, 4)
+		assert.NoError(t, subscriber.Subscribe("events", func(data []byte) { events <- string(data) }))
+		assert.NoError(t, subscriber.Subscribe("other", func(data []byte) { others <- string(data) }))
+
+		assert.NoError(t, publisher.Publish("events", []byte("first")))
+		assert.NoError(t, publisher.Publish("events", []byte("second")))
+
+		assert.Equal(t, "first", receive(t, events))
+		assert.Equal(t, "second", receive(t, events))
+		assert.Len(t, others, 0)
+	})
+}
+
+func receive(t *testing.T, ch chan string) string {
+	t.Helper()
+
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a message")
+		return ""
+	}
+}
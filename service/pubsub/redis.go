@@ -0,0 +1,78 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a PubSub shared by every instance connected to the same Redis
+// server, or anything speaking its protocol.
+type Redis struct {
+	client *redis.Client
+	mu     sync.Mutex
+	subs   []*redis.PubSub
+	wg     sync.WaitGroup
+}
+
+// NewRedis connects to the server at url, e.g. redis://localhost:6379/0.
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &Redis{client: client}, nil
+}
+
+func (r *Redis) Publish(channel string, data []byte) error {
+	return r.client.Publish(context.Background(), channel, data).Err()
+}
+
+func (r *Redis) Subscribe(channel string, fn func(data []byte)) error {
+	ctx := context.Background()
+
+	sub := r.client.Subscribe(ctx, channel)
+	// wait for the server to confirm, messages published before that would
+	// otherwise be missed
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return err
+	}
+
+	r.mu.Lock()
+	r.subs = append(r.subs, sub)
+	r.mu.Unlock()
+
+	// go-redis reconnects on its own, the channel is only closed along with
+	// the subscription
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for msg := range sub.Channel() {
+			fn([]byte(msg.Payload))
+		}
+	}()
+
+	return nil
+}
+
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	for _, sub := range r.subs {
+		sub.Close()
+	}
+	r.subs = nil
+	r.mu.Unlock()
+
+	r.wg.Wait()
+
+	return r.client.Close()
+}
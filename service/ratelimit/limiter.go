@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"log"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+// Limiter applies a token bucket limit per key. Buckets start full and are
+// refilled steadily, so a short burst is allowed as long as the average rate
+// stays under the limit.
+type Limiter struct {
+	store types.RateLimitStore
+	name  string
+	rate  float64
+	burst int
+}
+
+// NewLimiter allows perMinute actions a minute for each key, a limit of 0 or
+// less turns it off. The name keeps the buckets of different limiters apart
+// in a shared store.
+func NewLimiter(store types.RateLimitStore, name string, perMinute int) *Limiter {
+	return &Limiter{store: store, name: name, rate: float64(perMinute) / 60, burst: perMinute}
+}
+
+// Allow lets the action through when the store cannot be reached, an outage
+// of the store should not take the API down with it.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l.burst <= 0 {
+		return true, 0
+	}
+
+	ok, retryAfter, err := l.store.Take(l.name+":"+key, l.rate, l.burst)
+	if err != nil {
+		log.Printf("ratelimit: failed to check %s for %s: %v", l.name, key, err)
+		return true, 0
+	}
+
+	return ok, retryAfter
+}
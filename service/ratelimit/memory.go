@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+// Memory keeps the buckets in process, each instance limits on its own.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// the bucket is full again from then on and can be forgotten
+	fullAt time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, lastSweep: time.Now(), now: time.Now}
+}
+
+func (m *Memory) Take(key string, rate float64, burst int) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	var retryAfter time.Duration
+	if allowed {
+		b.tokens--
+	} else {
+		retryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.fullAt = now.Add(time.Duration((float64(burst) - b.tokens) / rate * float64(time.Second)))
+
+	return allowed, retryAfter, nil
+}
+
+// sweep forgets the buckets that refilled, they would be created full again.
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if !now.Before(b.fullAt) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
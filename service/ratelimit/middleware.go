@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// KeyFunc picks the bucket a request is taken from.
+type KeyFunc func(c *fiber.Ctx) string
+
+// ByIP limits each client address.
+func ByIP(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+// ByUser limits each user, going by the token of the request as the route
+// has not authenticated it yet. Anonymous requests are limited by address.
+func ByUser(c *fiber.Ctx) string {
+	userID, err := auth.ParseUserID(utils.GetTokenFromRequest(c))
+	if err != nil {
+		return ByIP(c)
+	}
+
+	return UserKey(userID)
+}
+
+// UserKey is the key of a user, for limits also checked outside of HTTP
+// requests such as messages sent over the socket.
+func UserKey(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// New answers 429 Too Many Requests, with a Retry-After header, once the
+// bucket of the request is empty. It is meant to be mounted on the routes it
+// limits, ahead of them.
+func New(limiter types.RateLimiter, key KeyFunc) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ok, retryAfter := limiter.Allow(key(c)); !ok {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(RetryAfterSeconds(retryAfter)))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "rate limit exceeded",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// RetryAfterSeconds rounds the wait up, clients retrying early would only be
+// refused again.
+func RetryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
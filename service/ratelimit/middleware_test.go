@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Post("/login", New(NewLimiter(NewMemory(), "login", 1), ByIP))
+	app.Post("/login", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Post("/messages", New(NewLimiter(NewMemory(), "messages", 1), ByUser))
+	app.Post("/messages", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	t.Run("should answer 429 with Retry-After once the limit is reached", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/login", nil))
+		assert.NoError(t, err, "error testing request")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/login", nil))
+		assert.NoError(t, err, "error testing request")
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, "60", resp.Header.Get(fiber.HeaderRetryAfter))
+	})
+
+	t.Run("should limit each user on their own", func(t *testing.T) {
+		for _, userID := range []int{1, 2} {
+			resp, err := app.Test(request(t, userID))
+			assert.NoError(t, err, "error testing request")
+			assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		}
+
+		resp, err := app.Test(request(t, 1))
+		assert.NoError(t, err, "error testing request")
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	})
+}
+
+func request(t *testing.T, userID int) *http.Request {
+	t.Helper()
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/messages", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	store := NewMemory()
+	testStore(t, store)
+
+	t.Run("should refill the bucket over time", func(t *testing.T) {
+		now := time.Now()
+		store.now = func() time.Time { return now }
+
+		for i := 0; i < 2; i++ {
+			ok, _, _ := store.Take("refill", 1, 2)
+			assert.True(t, ok)
+		}
+		ok, retryAfter, _ := store.Take("refill", 1, 2)
+		assert.False(t, ok)
+		assert.Equal(t, time.Second, retryAfter)
+
+		now = now.Add(time.Second)
+		ok, _, _ = store.Take("refill", 1, 2)
+		assert.True(t, ok)
+	})
+
+	t.Run("should forget the buckets that refilled", func(t *testing.T) {
+		now := time.Now()
+		store.now = func() time.Time { return now }
+
+		store.Take("idle", 1, 2)
+		now = now.Add(sweepInterval)
+		store.Take("busy", 1, 2)
+
+		assert.NotContains(t, store.buckets, "idle")
+		assert.Contains(t, store.buckets, "busy")
+	})
+}
+
+func TestRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	store, err := NewRedis("redis://" + server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	testStore(t, store)
+
+	t.Run("should expire the buckets", func(t *testing.T) {
+		store.Take("expiring", 1, 2)
+		assert.Greater(t, server.TTL(keyPrefix+"expiring"), time.Duration(0))
+	})
+}
+
+// testStore checks a bucket lets a burst through and then has the caller
+// wait for the next token.
+func testStore(t *testing.T, store types.RateLimitStore) {
+	t.Run("should allow a burst and then refuse", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			ok, _, err := store.Take("burst", 0.5, 3)
+			assert.NoError(t, err)
+			assert.True(t, ok, "take %d", i)
+		}
+
+		ok, retryAfter, err := store.Take("burst", 0.5, 3)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Greater(t, retryAfter, time.Duration(0))
+		assert.LessOrEqual(t, retryAfter, 2*time.Second)
+	})
+
+	t.Run("should keep the buckets of different keys apart", func(t *testing.T) {
+		ok, _, err := store.Take("other", 0.5, 3)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestLimiter(t *testing.T) {
+	t.Run("should allow perMinute actions a minute", func(t *testing.T) {
+		limiter := NewLimiter(NewMemory(), "login", 2)
+
+		ok, _ := limiter.Allow("ip:1.2.3.4")
+		assert.True(t, ok)
+		ok, _ = limiter.Allow("ip:1.2.3.4")
+		assert.True(t, ok)
+		ok, retryAfter := limiter.Allow("ip:1.2.3.4")
+		assert.False(t, ok)
+		assert.InDelta(t, 30*time.Second, retryAfter, float64(time.Second))
+	})
+
+	t.Run("should be turned off by a limit of 0", func(t *testing.T) {
+		limiter := NewLimiter(&failingStore{}, "login", 0)
+
+		ok, _ := limiter.Allow("ip:1.2.3.4")
+		assert.True(t, ok)
+	})
+
+	t.Run("should let everything through when the store is down", func(t *testing.T) {
+		limiter := NewLimiter(&failingStore{}, "login", 1)
+
+		for i := 0; i < 3; i++ {
+			ok, _ := limiter.Allow("ip:1.2.3.4")
+			assert.True(t, ok)
+		}
+	})
+}
+
+type failingStore struct{}
+
+func (s *failingStore) Take(key string, rate float64, burst int) (bool, time.Duration, error) {
+	return false, 0, fmt.Errorf("connection refused")
+}
+
+func (s *failingStore) Close() error {
+	return nil
+}
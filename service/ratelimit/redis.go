@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const keyPrefix = "chat-app:ratelimit:"
+
+// takeScript refills and takes from the bucket in one step, so instances
+// racing on the same key cannot both spend the last token. Time comes from
+// the instances, their clocks are expected to be kept in sync.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(bucket[1]) or burst
+local last = tonumber(bucket[2]) or now
+
+tokens = math.min(burst, tokens + math.max(0, now - last) / 1000 * rate)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+
+return {allowed, wait}
+`)
+
+// Redis keeps the buckets on a Redis server, so the limits hold across every
+// instance of the API.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the server at url, e.g. redis://localhost:6379/0.
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &Redis{client: client}, nil
+}
+
+func (r *Redis) Take(key string, rate float64, burst int) (bool, time.Duration, error) {
+	res, err := takeScript.Run(context.Background(), r.client, []string{keyPrefix + key}, rate, burst, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,298 @@
+package realtime
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+// sendBuffer is how many events may queue up for a slow client before the
+// hub gives up on it.
+const sendBuffer = 64
+
+// historySize is how many recent events are kept per user so a client that
+// reconnects can resume its stream.
+const historySize = 256
+
+// historyGrace is how long the history of a user outlives their last client,
+// long enough for a dropped connection to come back and resume.
+const historyGrace = 10 * time.Minute
+
+// Client is one connected device of a user.
+type Client struct {
+	UserID   int
+	DeviceID string
+	send     chan types.Event
+	once     sync.Once
+}
+
+func NewClient(userID int, deviceID string) *Client {
+	return &Client{
+		UserID:   userID,
+		DeviceID: deviceID,
+		send:     make(chan types.Event, sendBuffer),
+	}
+}
+
+// Events is closed once the client has been unregistered from the hub.
+func (c *Client) Events() <-chan types.Event {
+	return c.send
+}
+
+func (c *Client) close() {
+	c.once.Do(func() { close(c.send) })
+}
+
+// Hub keeps track of the connected clients of every user and fans events
+// out to them.
+type Hub struct {
+	now func() time.Time
+
+	mu         sync.RWMutex
+	clients    map[int]map[*Client]struct{}
+	histories  map[int]*history
+	onPresence []func(userID int, online bool)
+}
+
+// history numbers the events of a user and remembers the latest ones. It is
+// only kept for users that connected at least once, and forgotten once they
+// have been offline for historyGrace.
+type history struct {
+	lastID  uint64
+	entries []historyEntry
+	// offlineSince is when the last client of the user went away, zero while
+	// the user is online
+	offlineSince time.Time
+}
+
+type historyEntry struct {
+	event        types.Event
+	exceptDevice string
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		now:       time.Now,
+		clients:   map[int]map[*Client]struct{}{},
+		histories: map[int]*history{},
+	}
+}
+
+// OnPresence adds a function called when a user comes online with a first
+// client or goes offline with the last one.
+func (h *Hub) OnPresence(fn func(userID int, online bool)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.onPresence = append(h.onPresence, fn)
+}
+
+func (h *Hub) Register(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.register(c)
+}
+
+// RegisterSince registers the client and returns the events it missed since
+// lastID. ok is false when some of them are no longer in the history and the
+// client has to reload its state instead.
+func (h *Hub) RegisterSince(c *Client, lastID uint64) ([]types.Event, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.register(c)
+
+	hist := h.histories[c.UserID]
+	if lastID > hist.lastID {
+		return nil, false
+	}
+	if lastID == hist.lastID {
+		return nil, true
+	}
+	if len(hist.entries) == 0 || hist.entries[0].event.ID > lastID+1 {
+		return nil, false
+	}
+
+	missed := []types.Event{}
+	for _, e := range hist.entries {
+		if e.event.ID <= lastID {
+			continue
+		}
+		if e.exceptDevice != "" && e.exceptDevice == c.DeviceID {
+			continue
+		}
+		missed = append(missed, e.event)
+	}
+
+	return missed, true
+}
+
+func (h *Hub) register(c *Client) {
+	if h.histories[c.UserID] == nil {
+		h.histories[c.UserID] = &history{}
+	}
+	h.histories[c.UserID].offlineSince = time.Time{}
+
+	if h.clients[c.UserID] == nil {
+		h.clients[c.UserID] = map[*Client]struct{}{}
+		h.presenceChanged(c.UserID, true)
+	}
+	h.clients[c.UserID][c] = struct{}{}
+}
+
+func (h *Hub) Unregister(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.unregister(c)
+}
+
+func (h *Hub) unregister(c *Client) {
+	if clients, ok := h.clients[c.UserID]; ok {
+		if _, ok := clients[c]; ok {
+			delete(clients, c)
+			if len(clients) == 0 {
+				delete(h.clients, c.UserID)
+				if hist, ok := h.histories[c.UserID]; ok {
+					hist.offlineSince = h.now()
+				}
+				h.presenceChanged(c.UserID, false)
+			}
+		}
+	}
+	c.close()
+}
+
+// presenceChanged runs the callbacks outside of the lock held by the caller,
+// they are free to send events through the hub.
+func (h *Hub) presenceChanged(userID int, online bool) {
+	for _, fn := range h.onPresence {
+		go fn(userID, online)
+	}
+}
+
+// DisconnectUser unregisters every client of the user, their connections
+// are closed.
+func (h *Hub) DisconnectUser(userID int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.clients[userID] {
+		h.unregister(c)
+	}
+}
+
+// EvictHistories forgets the histories of the users offline for longer than
+// historyGrace every interval, until stop is closed. A client of theirs that
+// reconnects later is asked to reload its state.
+func (h *Hub) EvictHistories(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.evictHistories()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (h *Hub) evictHistories() {
+	cutoff := h.now().Add(-historyGrace)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for userID, hist := range h.histories {
+		if !hist.offlineSince.IsZero() && hist.offlineSince.Before(cutoff) {
+			delete(h.histories, userID)
+		}
+	}
+}
+
+// IsOnline reports whether the user has at least one connected client.
+func (h *Hub) IsOnline(userID int) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.clients[userID]) > 0
+}
+
+// OnlineUsers lists the users with at least one connected client.
+func (h *Hub) OnlineUsers() []int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	userIDs := make([]int, 0, len(h.clients))
+	for userID := range h.clients {
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs
+}
+
+// SendToUser delivers the event to every client of the user, except the
+// device the change originated from.
+func (h *Hub) SendToUser(userID int, event types.Event, exceptDevice string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.deliver(userID, event, exceptDevice)
+}
+
+func (h *Hub) SendToUsers(userIDs []int, event types.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, userID := range userIDs {
+		h.deliver(userID, event, "")
+	}
+}
+
+// Reply sends the event to a single client, outside of the numbered stream
+// of its user. It answers requests made over that connection.
+func (h *Hub) Reply(c *Client, event types.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[c.UserID][c]; !ok {
+		return
+	}
+
+	select {
+	case c.send <- event:
+	default:
+		log.Printf("realtime: dropping slow client of user %d", c.UserID)
+		h.unregister(c)
+	}
+}
+
+func (h *Hub) deliver(userID int, event types.Event, exceptDevice string) {
+	if hist, ok := h.histories[userID]; ok {
+		hist.lastID++
+		event.ID = hist.lastID
+
+		hist.entries = append(hist.entries, historyEntry{event: event, exceptDevice: exceptDevice})
+		if len(hist.entries) > historySize {
+			hist.entries = hist.entries[len(hist.entries)-historySize:]
+		}
+	}
+
+	for c := range h.clients[userID] {
+		if exceptDevice != "" && c.DeviceID == exceptDevice {
+			continue
+		}
+
+		select {
+		case c.send <- event:
+		default:
+			log.Printf("realtime: dropping slow client of user %d", c.UserID)
+			h.unregister(c)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package realtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub(t *testing.T) {
+	t.Run("should deliver to every device except the origin", func(t *testing.T) {
+		hub := NewHub()
+		phone := NewClient(1, "phone")
+		laptop := NewClient(1, "laptop")
+		hub.Register(phone)
+		hub.Register(laptop)
+
+		hub.SendToUser(1, types.Event{Type: types.EventDraftUpdated}, "phone")
+
+		assert.Len(t, phone.send, 0)
+		assert.Len(t, laptop.send, 1)
+	})
+
+	t.Run("should deliver to all listed users", func(t *testing.T) {
+		hub := NewHub()
+		a := NewClient(1, "")
+		b := NewClient(2, "")
+		c := NewClient(3, "")
+		hub.Register(a)
+		hub.Register(b)
+		hub.Register(c)
+
+		hub.SendToUsers([]int{1, 2}, types.Event{Type: types.EventMessageCreated})
+
+		assert.Len(t, a.send, 1)
+		assert.Len(t, b.send, 1)
+		assert.Len(t, c.send, 0)
+	})
+
+	t.Run("should track online users", func(t *testing.T) {
+		hub := NewHub()
+		client := NewClient(1, "")
+		hub.Register(client)
+		assert.True(t, hub.IsOnline(1))
+
+		hub.Unregister(client)
+		assert.False(t, hub.IsOnline(1))
+
+		_, ok := <-client.Events()
+		assert.False(t, ok, "expected events channel to be closed")
+	})
+
+	t.Run("should drop clients that stop reading", func(t *testing.T) {
+		hub := NewHub()
+		client := NewClient(1, "")
+		hub.Register(client)
+
+		for i := 0; i <= sendBuffer; i++ {
+			hub.SendToUser(1, types.Event{Type: types.EventMessageCreated}, "")
+		}
+
+		assert.False(t, hub.IsOnline(1))
+	})
+
+	t.Run("should replay the events missed since the last id", func(t *testing.T) {
+		hub := NewHub()
+		first := NewClient(1, "laptop")
+		hub.Register(first)
+		hub.SendToUser(1, types.Event{Type: types.EventMessageCreated}, "")
+		hub.SendToUser(1, types.Event{Type: types.EventDraftUpdated}, "laptop")
+		hub.SendToUser(1, types.Event{Type: types.EventMessageDeleted}, "")
+		hub.Unregister(first)
+
+		client := NewClient(1, "laptop")
+		missed, ok := hub.RegisterSince(client, 1)
+
+		assert.True(t, ok)
+		assert.Len(t, missed, 1, "expected the event of the same device to be skipped")
+		assert.Equal(t, uint64(3), missed[0].ID)
+		assert.Equal(t, types.EventMessageDeleted, missed[0].Type)
+	})
+
+	t.Run("should ask for a resync when events are gone", func(t *testing.T) {
+		hub := NewHub()
+		hub.Register(NewClient(1, "phone"))
+		for i := 0; i < historySize+10; i++ {
+			hub.SendToUser(1, types.Event{Type: types.EventMessageCreated}, "laptop")
+		}
+
+		_, ok := hub.RegisterSince(NewClient(1, "laptop"), 5)
+		assert.False(t, ok)
+
+		_, ok = hub.RegisterSince(NewClient(1, "laptop"), 9999)
+		assert.False(t, ok)
+	})
+
+	t.Run("should forget the history of users offline for a while", func(t *testing.T) {
+		hub := NewHub()
+		phone := NewClient(1, "phone")
+		hub.Register(phone)
+		hub.Register(NewClient(2, "phone"))
+		hub.SendToUser(1, types.Event{Type: types.EventMessageCreated}, "")
+		hub.Unregister(phone)
+
+		hub.evictHistories()
+		assert.Contains(t, hub.histories, 1, "expected the history to outlive a short disconnection")
+
+		hub.now = func() time.Time { return time.Now().Add(historyGrace + time.Minute) }
+		hub.evictHistories()
+		assert.NotContains(t, hub.histories, 1)
+		assert.Contains(t, hub.histories, 2, "expected the history of online users to be kept")
+
+		_, ok := hub.RegisterSince(NewClient(1, "phone"), 1)
+		assert.False(t, ok)
+	})
+
+	t.Run("should report presence changes", func(t *testing.T) {
+		hub := NewHub()
+		changes := make(chan bool, 2)
+		hub.OnPresence(func(userID int, online bool) { changes <- online })
+
+		phone := NewClient(1, "phone")
+		laptop := NewClient(1, "laptop")
+		hub.Register(phone)
+		assert.True(t, <-changes)
+
+		hub.Register(laptop)
+		hub.Unregister(phone)
+		hub.Unregister(laptop)
+		assert.False(t, <-changes)
+		assert.Len(t, changes, 0)
+	})
+}
@@ -0,0 +1,170 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+)
+
+const presenceChannel = "chat-app:presence"
+
+// Presence tells whether a user is connected to any instance of the API.
+// Each instance announces the users coming online or going offline on its
+// hub through the pub/sub, and repeats the full list every so often.
+//
+// The users of an instance that stops announcing, because it crashed or
+// lost the pub/sub, are taken as offline once ttl is over.
+type Presence struct {
+	hub        *Hub
+	pubsub     types.PubSub
+	instanceID string
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	instances map[string]*instancePresence
+}
+
+// instancePresence is what another instance last announced.
+type instancePresence struct {
+	users map[int]struct{}
+	until time.Time
+}
+
+type announcement struct {
+	Origin  string `json:"origin"`
+	UserIDs []int  `json:"userIds"`
+	Online  bool   `json:"online"`
+	// Full lists every user online on the instance, the others are offline
+	Full bool `json:"full,omitempty"`
+}
+
+func NewPresence(hub *Hub, pubsub types.PubSub, ttl time.Duration) (*Presence, error) {
+	instanceID, err := utils.RandomString(12)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Presence{
+		hub:        hub,
+		pubsub:     pubsub,
+		instanceID: instanceID,
+		ttl:        ttl,
+		now:        time.Now,
+		instances:  map[string]*instancePresence{},
+	}
+	if err := pubsub.Subscribe(presenceChannel, p.receive); err != nil {
+		return nil, err
+	}
+	hub.OnPresence(p.changed)
+
+	return p, nil
+}
+
+// IsOnline reports whether the user has a client connected to this instance
+// or, as last announced, to another one.
+func (p *Presence) IsOnline(userID int) bool {
+	if p.hub.IsOnline(userID) {
+		return true
+	}
+
+	now := p.now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, instance := range p.instances {
+		if _, ok := instance.users[userID]; ok && now.Before(instance.until) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Announce publishes every user online on this instance every interval,
+// until stop is closed. The interval has to be well under the ttl of the
+// other instances.
+func (p *Presence) Announce(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.publish(announcement{UserIDs: p.hub.OnlineUsers(), Full: true})
+			p.sweep()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// changed is called by the hub, a missed or reordered change is corrected
+// by the next full announcement.
+func (p *Presence) changed(userID int, online bool) {
+	p.publish(announcement{UserIDs: []int{userID}, Online: online})
+}
+
+func (p *Presence) publish(a announcement) {
+	a.Origin = p.instanceID
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		log.Printf("realtime: failed to encode presence: %v", err)
+		return
+	}
+
+	if err := p.pubsub.Publish(presenceChannel, data); err != nil {
+		log.Printf("realtime: failed to publish presence: %v", err)
+	}
+}
+
+func (p *Presence) receive(data []byte) {
+	var a announcement
+	if err := json.Unmarshal(data, &a); err != nil {
+		log.Printf("realtime: dropping malformed presence: %v", err)
+		return
+	}
+
+	// the local hub is asked directly
+	if a.Origin == p.instanceID {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	instance, ok := p.instances[a.Origin]
+	if !ok || a.Full {
+		instance = &instancePresence{users: map[int]struct{}{}}
+		p.instances[a.Origin] = instance
+	}
+	instance.until = p.now().Add(p.ttl)
+
+	for _, userID := range a.UserIDs {
+		if a.Full || a.Online {
+			instance.users[userID] = struct{}{}
+		} else {
+			delete(instance.users, userID)
+		}
+	}
+}
+
+// sweep forgets the instances that stopped announcing.
+func (p *Presence) sweep() {
+	now := p.now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id, instance := range p.instances {
+		if !now.Before(instance.until) {
+			delete(p.instances, id)
+		}
+	}
+}
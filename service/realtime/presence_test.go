@@ -0,0 +1,54 @@
+package realtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/pubsub"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresence(t *testing.T) {
+	// two instances of the API sharing a backplane
+	ps := pubsub.NewMemory()
+	hubA, hubB := NewHub(), NewHub()
+	presenceA, err := NewPresence(hubA, ps, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	presenceB, err := NewPresence(hubB, ps, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should see users connected to another instance", func(t *testing.T) {
+		phone := NewClient(1, "phone")
+		hubB.Register(phone)
+
+		assert.True(t, presenceB.IsOnline(1))
+		assert.Eventually(t, func() bool { return presenceA.IsOnline(1) }, time.Second, 5*time.Millisecond)
+		assert.False(t, presenceA.IsOnline(2))
+
+		hubB.Unregister(phone)
+		assert.Eventually(t, func() bool { return !presenceA.IsOnline(1) }, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("should correct missed changes with the full list", func(t *testing.T) {
+		hubB.Register(NewClient(2, "phone"))
+		assert.Eventually(t, func() bool { return presenceA.IsOnline(2) }, time.Second, 5*time.Millisecond)
+
+		presenceB.publish(announcement{UserIDs: []int{3}, Full: true})
+		assert.False(t, presenceA.IsOnline(2))
+		assert.True(t, presenceA.IsOnline(3))
+	})
+
+	t.Run("should forget an instance that stopped announcing", func(t *testing.T) {
+		presenceA.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		defer func() { presenceA.now = time.Now }()
+
+		assert.False(t, presenceA.IsOnline(3))
+
+		presenceA.sweep()
+		assert.Empty(t, presenceA.instances)
+	})
+}
@@ -0,0 +1,105 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+)
+
+const eventsChannel = "chat-app:events"
+
+// Relay publishes events to every instance of the API. Events are delivered
+// to the local hub right away and to the hubs of the other instances through
+// the pub/sub, each instance only reaching the connections it holds.
+//
+// Event ids are numbered by each hub, a client that reconnects to another
+// instance is asked to resync.
+type Relay struct {
+	hub        *Hub
+	pubsub     types.PubSub
+	instanceID string
+}
+
+type envelope struct {
+	Origin       string      `json:"origin"`
+	UserIDs      []int       `json:"userIds"`
+	Event        types.Event `json:"event"`
+	ExceptDevice string      `json:"exceptDevice,omitempty"`
+	// Disconnect closes the connections of the users instead of sending an
+	// event
+	Disconnect bool `json:"disconnect,omitempty"`
+}
+
+func NewRelay(hub *Hub, pubsub types.PubSub) (*Relay, error) {
+	instanceID, err := utils.RandomString(12)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Relay{hub: hub, pubsub: pubsub, instanceID: instanceID}
+	if err := pubsub.Subscribe(eventsChannel, r.receive); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Relay) SendToUser(userID int, event types.Event, exceptDevice string) {
+	r.hub.SendToUser(userID, event, exceptDevice)
+	r.publish(envelope{UserIDs: []int{userID}, Event: event, ExceptDevice: exceptDevice})
+}
+
+func (r *Relay) SendToUsers(userIDs []int, event types.Event) {
+	r.hub.SendToUsers(userIDs, event)
+	r.publish(envelope{UserIDs: userIDs, Event: event})
+}
+
+// DisconnectUser closes the connections of the user to every instance.
+func (r *Relay) DisconnectUser(userID int) {
+	r.hub.DisconnectUser(userID)
+	r.publish(envelope{UserIDs: []int{userID}, Disconnect: true})
+}
+
+func (r *Relay) publish(e envelope) {
+	e.Origin = r.instanceID
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("realtime: failed to encode %s event: %v", e.Event.Type, err)
+		return
+	}
+
+	if err := r.pubsub.Publish(eventsChannel, data); err != nil {
+		log.Printf("realtime: failed to publish %s event: %v", e.Event.Type, err)
+	}
+}
+
+func (r *Relay) receive(data []byte) {
+	var e envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Printf("realtime: dropping malformed relayed event: %v", err)
+		return
+	}
+
+	// already delivered locally when it was sent
+	if e.Origin == r.instanceID {
+		return
+	}
+
+	if e.Disconnect {
+		for _, userID := range e.UserIDs {
+			r.hub.DisconnectUser(userID)
+		}
+		return
+	}
+
+	if e.ExceptDevice != "" {
+		for _, userID := range e.UserIDs {
+			r.hub.SendToUser(userID, e.Event, e.ExceptDevice)
+		}
+		return
+	}
+	r.hub.SendToUsers(e.UserIDs, e.Event)
+}
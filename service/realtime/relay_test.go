@@ -0,0 +1,64 @@
+package realtime
+
+import (
+	"testing"
+
+	"github.com/dclouisDan/chat-app-api/service/pubsub"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelay(t *testing.T) {
+	// two instances of the API sharing a backplane
+	ps := pubsub.NewMemory()
+	hubA, hubB := NewHub(), NewHub()
+	relayA, err := NewRelay(hubA, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRelay(hubB, ps); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should reach clients connected to another instance", func(t *testing.T) {
+		onA := NewClient(1, "phone")
+		onB := NewClient(2, "laptop")
+		hubA.Register(onA)
+		hubB.Register(onB)
+
+		relayA.SendToUsers([]int{1, 2}, types.Event{Type: types.EventMessageCreated})
+
+		assert.Len(t, onA.send, 1, "expected a single local delivery")
+		assert.Len(t, onB.send, 1)
+	})
+
+	t.Run("should keep skipping the origin device", func(t *testing.T) {
+		phone := NewClient(3, "phone")
+		laptop := NewClient(3, "laptop")
+		hubA.Register(phone)
+		hubB.Register(laptop)
+		otherPhone := NewClient(3, "phone")
+		hubB.Register(otherPhone)
+
+		relayA.SendToUser(3, types.Event{Type: types.EventDraftUpdated}, "phone")
+
+		assert.Len(t, phone.send, 0)
+		assert.Len(t, laptop.send, 1)
+		assert.Len(t, otherPhone.send, 0)
+	})
+
+	t.Run("should close the connections of a user on every instance", func(t *testing.T) {
+		phone := NewClient(4, "phone")
+		laptop := NewClient(4, "laptop")
+		hubA.Register(phone)
+		hubB.Register(laptop)
+
+		relayA.DisconnectUser(4)
+
+		_, open := <-phone.Events()
+		assert.False(t, open)
+		_, open = <-laptop.Events()
+		assert.False(t, open)
+		assert.False(t, hubB.IsOnline(4))
+	})
+}
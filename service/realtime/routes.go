@@ -0,0 +1,280 @@
+package realtime
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/service/ratelimit"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = (pongWait * 9) / 10
+)
+
+type Handler struct {
+	hub               *Hub
+	publisher         types.EventPublisher
+	sender            types.MessageSender
+	sendLimiter       types.RateLimiter
+	conversationStore types.ConversationStore
+	userStore         types.UserStore
+	upgrade           fiber.Handler
+	keepAlive         time.Duration
+}
+
+func NewHandler(hub *Hub, publisher types.EventPublisher, sender types.MessageSender, sendLimiter types.RateLimiter, conversationStore types.ConversationStore, userStore types.UserStore) *Handler {
+	h := &Handler{
+		hub:               hub,
+		publisher:         publisher,
+		sender:            sender,
+		sendLimiter:       sendLimiter,
+		conversationStore: conversationStore,
+		userStore:         userStore,
+		keepAlive:         keepAlivePeriod,
+	}
+	h.upgrade = websocket.New(h.handleSocket)
+	hub.OnPresence(h.publishPresence)
+	return h
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Get("/ws", auth.WithJWTAuth(h.handleUpgrade, h.userStore))
+	router.Get("/events/stream", auth.WithJWTAuth(h.handleEventStream, h.userStore))
+	router.Post("/conversations/:id/typing", auth.WithJWTAuth(h.handleTyping, h.userStore))
+}
+
+// Upgrade an authenticated request to a websocket connection
+func (h *Handler) handleUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+			"error": "websocket upgrade required",
+		})
+	}
+
+	// the websocket handler only sees locals, not the user context
+	c.Locals("userID", auth.GetIDFromContext(c))
+	c.Locals("deviceID", utils.GetDeviceIDFromRequest(c))
+
+	return h.upgrade(c)
+}
+
+func (h *Handler) handleSocket(conn *websocket.Conn) {
+	userID, _ := conn.Locals("userID").(int)
+	deviceID, _ := conn.Locals("deviceID").(string)
+
+	client := NewClient(userID, deviceID)
+	h.hub.Register(client)
+
+	done := make(chan struct{})
+	go writePump(conn, client, done)
+
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("realtime: read error for user %d: %v", userID, err)
+			}
+			break
+		}
+
+		h.receive(client, data)
+	}
+
+	h.hub.Unregister(client)
+	<-done
+}
+
+// writePump is the only goroutine writing to the connection. It stops once
+// the client is unregistered from the hub.
+func writePump(conn *websocket.Conn, client *Client, done chan struct{}) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+		close(done)
+	}()
+
+	for {
+		select {
+		case event, ok := <-client.Events():
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// inboundFrame is what clients may send over the socket.
+type inboundFrame struct {
+	Type    string `json:"type"`
+	Payload struct {
+		ConversationID  int    `json:"conversationId"`
+		Content         string `json:"content" validate:"required,max=4000"`
+		ClientMessageID string `json:"clientMessageId" validate:"required,max=64"`
+	} `json:"payload"`
+}
+
+// receive handles a frame sent by the client, malformed ones are ignored.
+func (h *Handler) receive(client *Client, data []byte) {
+	var frame inboundFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return
+	}
+
+	switch frame.Type {
+	case types.EventTyping:
+		h.typing(client.UserID, frame.Payload.ConversationID)
+	case types.EventMessageSend:
+		h.sendMessage(client, frame)
+	}
+}
+
+// sendMessage posts a message sent over the socket and acks it to the
+// sending connection. The ack carries the client message id so the client
+// can swap its optimistic message for the stored one, or flag it as failed.
+// An ephemeral command is acked with its result instead of a message.
+func (h *Handler) sendMessage(client *Client, frame inboundFrame) {
+	payload := frame.Payload
+	ack := fiber.Map{"clientMessageId": payload.ClientMessageID}
+
+	// the same bucket as messages sent over HTTP, switching transports does
+	// not get around the limit
+	if ok, retryAfter := h.sendLimiter.Allow(ratelimit.UserKey(client.UserID)); !ok {
+		ack["error"] = "rate limit exceeded"
+		ack["retryAfter"] = ratelimit.RetryAfterSeconds(retryAfter)
+		h.hub.Reply(client, types.Event{Type: types.EventMessageAck, Payload: ack})
+		return
+	}
+
+	message, result, err := h.trySendMessage(client, frame)
+	switch {
+	case err != nil:
+		ack["error"] = err.Error()
+	case result != nil:
+		ack["command"] = result
+	default:
+		ack["message"] = message
+	}
+
+	h.hub.Reply(client, types.Event{Type: types.EventMessageAck, Payload: ack})
+}
+
+func (h *Handler) trySendMessage(client *Client, frame inboundFrame) (*types.Message, *types.CommandResult, error) {
+	payload := frame.Payload
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return nil, nil, fmt.Errorf("invalid payload %v", errors)
+	}
+
+	// the socket outlives the request it was opened with, the user may have
+	// been suspended or verified their address since
+	u, err := h.userStore.GetUserByID(client.UserID)
+	if err != nil || u.SuspendedAt.Valid {
+		return nil, nil, fmt.Errorf("account suspended")
+	}
+	if auth.VerificationRequired(auth.VerifyBeforeMessaging) && !u.EmailVerifiedAt.Valid {
+		return nil, nil, fmt.Errorf("email not verified")
+	}
+
+	if _, err := h.conversationStore.GetParticipant(payload.ConversationID, client.UserID); err != nil {
+		return nil, nil, fmt.Errorf("not a participant of this conversation")
+	}
+
+	return h.sender.SendMessage(types.Message{
+		ConversationID:  payload.ConversationID,
+		SenderID:        client.UserID,
+		Content:         payload.Content,
+		ClientMessageID: sql.NullString{String: payload.ClientMessageID, Valid: true},
+	}, client.DeviceID)
+}
+
+// Tell the other participants the user is typing, for clients without a
+// socket
+func (h *Handler) handleTyping(c *fiber.Ctx) error {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+	}
+
+	if err := h.typing(auth.GetIDFromContext(c), conversationID); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// typing notifies the participants of the conversation other than the user.
+func (h *Handler) typing(userID, conversationID int) error {
+	participants, err := h.conversationStore.GetParticipants(conversationID)
+	if err != nil {
+		return err
+	}
+
+	others := []int{}
+	isParticipant := false
+	for _, p := range participants {
+		if p.UserID == userID {
+			isParticipant = true
+			continue
+		}
+		others = append(others, p.UserID)
+	}
+
+	if !isParticipant {
+		return fmt.Errorf("not a participant of this conversation")
+	}
+
+	h.publisher.SendToUsers(others, types.Event{
+		Type:    types.EventTyping,
+		Payload: fiber.Map{"conversationId": conversationID, "userId": userID},
+	})
+
+	return nil
+}
+
+// publishPresence tells the contacts of the user it came online or went
+// offline.
+func (h *Handler) publishPresence(userID int, online bool) {
+	contacts, err := h.conversationStore.GetContactIDs(userID)
+	if err != nil {
+		log.Printf("realtime: failed to get contacts of user %d: %v", userID, err)
+		return
+	}
+
+	h.publisher.SendToUsers(contacts, types.Event{
+		Type:    types.EventPresence,
+		Payload: fiber.Map{"userId": userID, "online": online},
+	})
+}
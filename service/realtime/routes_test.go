@@ -0,0 +1,265 @@
+package realtime
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypingHandler(t *testing.T) {
+	hub := NewHub()
+	handler := NewHandler(hub, hub, &mockSender{}, &mockLimiter{}, &mockConversationStore{}, &mockUserStore{})
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	sender := NewClient(1, "")
+	other := NewClient(2, "")
+	hub.Register(sender)
+	hub.Register(other)
+
+	t.Run("should notify the other participants", func(t *testing.T) {
+		resp, err := app.Test(newRequest(t, http.MethodPost, "/conversations/1/typing", 1))
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Len(t, sender.send, 0)
+		assert.Len(t, other.send, 1)
+		assert.Equal(t, types.EventTyping, (<-other.Events()).Type)
+	})
+
+	t.Run("should fail if the user is not a participant", func(t *testing.T) {
+		resp, err := app.Test(newRequest(t, http.MethodPost, "/conversations/1/typing", 3))
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestSocketFrames(t *testing.T) {
+	hub := NewHub()
+	sender := &mockSender{}
+	limiter := &mockLimiter{}
+	userStore := &mockUserStore{}
+	handler := NewHandler(hub, hub, sender, limiter, &mockConversationStore{}, userStore)
+
+	client := NewClient(1, "phone")
+	hub.Register(client)
+
+	ack := func(t *testing.T) map[string]any {
+		t.Helper()
+
+		event := <-client.Events()
+		assert.Equal(t, types.EventMessageAck, event.Type)
+		assert.Zero(t, event.ID, "expected acks to stay out of the numbered stream")
+		return event.Payload.(fiber.Map)
+	}
+
+	t.Run("should send a message and ack it with the client message id", func(t *testing.T) {
+		handler.receive(client, []byte(`{"type":"message.send","payload":{"conversationId":1,"content":"hi","clientMessageId":"abc"}}`))
+
+		payload := ack(t)
+		assert.Equal(t, "abc", payload["clientMessageId"])
+		assert.NotNil(t, payload["message"])
+		assert.Len(t, sender.sent, 1)
+		assert.Equal(t, "phone", sender.deviceID)
+	})
+
+	t.Run("should ack the original message when a send is retried", func(t *testing.T) {
+		handler.receive(client, []byte(`{"type":"message.send","payload":{"conversationId":1,"content":"hi","clientMessageId":"abc"}}`))
+
+		payload := ack(t)
+		assert.Equal(t, 1, payload["message"].(*types.Message).ID)
+		assert.Len(t, sender.sent, 1)
+	})
+
+	t.Run("should ack the result of an ephemeral command", func(t *testing.T) {
+		handler.receive(client, []byte(`{"type":"message.send","payload":{"conversationId":1,"content":"/help","clientMessageId":"cmd"}}`))
+
+		payload := ack(t)
+		assert.Equal(t, "cmd", payload["clientMessageId"])
+		assert.Equal(t, "help", payload["command"].(*types.CommandResult).Command)
+		assert.Nil(t, payload["message"])
+		assert.Len(t, sender.sent, 1)
+	})
+
+	t.Run("should ack an error without a client message id", func(t *testing.T) {
+		handler.receive(client, []byte(`{"type":"message.send","payload":{"conversationId":1,"content":"hi"}}`))
+
+		payload := ack(t)
+		assert.Contains(t, payload["error"], "invalid payload")
+	})
+
+	t.Run("should ack an error if the user is not a participant", func(t *testing.T) {
+		handler.receive(client, []byte(`{"type":"message.send","payload":{"conversationId":2,"content":"hi","clientMessageId":"def"}}`))
+
+		payload := ack(t)
+		assert.Equal(t, "not a participant of this conversation", payload["error"])
+	})
+
+	t.Run("should ack an error once the user sent too many messages", func(t *testing.T) {
+		limiter.retryAfter = 1500 * time.Millisecond
+		defer func() { limiter.retryAfter = 0 }()
+
+		handler.receive(client, []byte(`{"type":"message.send","payload":{"conversationId":1,"content":"hi","clientMessageId":"ghi"}}`))
+
+		payload := ack(t)
+		assert.Equal(t, "rate limit exceeded", payload["error"])
+		assert.Equal(t, 2, payload["retryAfter"])
+		assert.Equal(t, "user:1", limiter.key)
+		assert.Len(t, sender.sent, 1)
+	})
+
+	t.Run("should ack an error once the user is suspended", func(t *testing.T) {
+		userStore.suspended = true
+		defer func() { userStore.suspended = false }()
+
+		handler.receive(client, []byte(`{"type":"message.send","payload":{"conversationId":1,"content":"hi","clientMessageId":"jkl"}}`))
+
+		payload := ack(t)
+		assert.Equal(t, "account suspended", payload["error"])
+		assert.Len(t, sender.sent, 1)
+	})
+
+	t.Run("should ignore malformed frames", func(t *testing.T) {
+		handler.receive(client, []byte(`not json`))
+
+		assert.Len(t, client.send, 0)
+	})
+}
+
+func newRequest(t *testing.T, method, target string, userID int) *http.Request {
+	t.Helper()
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+// mockLimiter refuses everything while retryAfter is set.
+type mockLimiter struct {
+	retryAfter time.Duration
+	key        string
+}
+
+func (m *mockLimiter) Allow(key string) (bool, time.Duration) {
+	m.key = key
+	return m.retryAfter == 0, m.retryAfter
+}
+
+type mockSender struct {
+	sent     []types.Message
+	deviceID string
+}
+
+// SendMessage answers /help alone, as the commands would.
+func (m *mockSender) SendMessage(message types.Message, deviceID string) (*types.Message, *types.CommandResult, error) {
+	if message.Content == "/help" {
+		return nil, &types.CommandResult{Command: "help", ResponseType: types.CommandResponseEphemeral, Text: "/help - List the commands"}, nil
+	}
+
+	for i := range m.sent {
+		if m.sent[i].ClientMessageID == message.ClientMessageID {
+			return &m.sent[i], nil, nil
+		}
+	}
+
+	message.ID = len(m.sent) + 1
+	m.sent = append(m.sent, message)
+	m.deviceID = deviceID
+	return &message, nil, nil
+}
+
+type mockConversationStore struct{}
+
+func (m *mockConversationStore) CreateConversation(name string, creatorID int, participantIDs []int) (*types.Conversation, error) {
+	return &types.Conversation{ID: 1}, nil
+}
+
+func (m *mockConversationStore) GetConversationByID(id int) (*types.Conversation, error) {
+	return &types.Conversation{ID: id}, nil
+}
+
+func (m *mockConversationStore) GetParticipant(conversationID, userID int) (*types.Participant, error) {
+	if conversationID != 1 {
+		return nil, fmt.Errorf("participant not found")
+	}
+	return &types.Participant{ConversationID: conversationID, UserID: userID}, nil
+}
+
+func (m *mockConversationStore) GetParticipants(conversationID int) ([]types.Participant, error) {
+	return []types.Participant{{ConversationID: conversationID, UserID: 1}, {ConversationID: conversationID, UserID: 2}}, nil
+}
+
+func (m *mockConversationStore) RemoveParticipant(conversationID, userID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) MarkRead(conversationID, userID, messageID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) GetContactIDs(userID int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) ExportMessages(conversationID int, fn func(*types.ExportedMessage) error) error {
+	return nil
+}
+
+func (m *mockConversationStore) UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error {
+	return nil
+}
+
+type mockUserStore struct {
+	suspended bool
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id, SuspendedAt: sql.NullTime{Time: time.Now(), Valid: m.suspended}}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
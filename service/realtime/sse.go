@@ -0,0 +1,108 @@
+package realtime
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	keepAlivePeriod = 15 * time.Second
+	// how long browsers wait before reconnecting a dropped stream
+	retryMillis = 3000
+)
+
+// Stream the events of the user as Server-Sent Events, for clients sitting
+// behind proxies that do not let websockets through
+func (h *Handler) handleEventStream(c *fiber.Ctx) error {
+	userID := auth.GetIDFromContext(c)
+	deviceID := utils.GetDeviceIDFromRequest(c)
+
+	// browsers send the header on their own when reconnecting, the query
+	// parameter is for the first connection of a page
+	lastEventID := c.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		client := NewClient(userID, deviceID)
+
+		resumed := true
+		var missed []types.Event
+		if lastEventID == "" {
+			h.hub.Register(client)
+		} else if id, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+			missed, resumed = h.hub.RegisterSince(client, id)
+		} else {
+			h.hub.Register(client)
+			resumed = false
+		}
+		defer h.hub.Unregister(client)
+
+		fmt.Fprintf(w, "retry: %d\n\n", retryMillis)
+		if !resumed {
+			writeEvent(w, types.Event{Type: types.EventResync})
+		}
+		for _, event := range missed {
+			writeEvent(w, event)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(h.keepAlive)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case event, ok := <-client.Events():
+				if !ok {
+					return
+				}
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			case <-ticker.C:
+				// comments are ignored by clients but keep proxies from
+				// closing an idle connection
+				if _, err := w.WriteString(": keep-alive\n\n"); err != nil {
+					return
+				}
+			}
+
+			// a failing flush is how a closed connection shows up
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+func writeEvent(w *bufio.Writer, event types.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if event.ID != 0 {
+		fmt.Fprintf(w, "id: %d\n", event.ID)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+
+	return err
+}
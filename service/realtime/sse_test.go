@@ -0,0 +1,128 @@
+package realtime
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventStream(t *testing.T) {
+	hub := NewHub()
+	handler := NewHandler(hub, hub, &mockSender{}, &mockLimiter{}, &mockConversationStore{}, &mockUserStore{})
+	handler.keepAlive = 50 * time.Millisecond
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), 1, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	open := func(t *testing.T, lastEventID string) (*http.Response, *bufio.Reader) {
+		t.Helper()
+
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/events/stream?token=%s", ln.Addr(), token), nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+
+	t.Run("should stream events with their id", func(t *testing.T) {
+		resp, r := open(t, "")
+		defer resp.Body.Close()
+
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "retry: 3000", readLine(t, r))
+		readLine(t, r)
+
+		waitOnline(t, hub, 1)
+		hub.SendToUser(1, types.Event{Type: types.EventMessageCreated, Payload: fiber.Map{"id": 7}}, "")
+
+		assert.Equal(t, "id: 1", readLine(t, r))
+		assert.Equal(t, "event: message.created", readLine(t, r))
+		assert.Contains(t, readLine(t, r), `"payload":{"id":7}`)
+	})
+
+	t.Run("should send keep-alive comments", func(t *testing.T) {
+		resp, r := open(t, "1")
+		defer resp.Body.Close()
+
+		readLine(t, r)
+		readLine(t, r)
+		assert.Equal(t, ": keep-alive", readLine(t, r))
+	})
+
+	t.Run("should resume from the last event id", func(t *testing.T) {
+		waitOffline(t, hub, 1)
+		hub.SendToUser(1, types.Event{Type: types.EventMessageUpdated}, "")
+		hub.SendToUser(1, types.Event{Type: types.EventMessageDeleted}, "")
+
+		resp, r := open(t, "2")
+		defer resp.Body.Close()
+
+		readLine(t, r)
+		readLine(t, r)
+		assert.Equal(t, "id: 3", readLine(t, r))
+		assert.Equal(t, "event: message.deleted", readLine(t, r))
+	})
+
+	t.Run("should ask for a resync when it cannot resume", func(t *testing.T) {
+		resp, r := open(t, "999")
+		defer resp.Body.Close()
+
+		readLine(t, r)
+		readLine(t, r)
+		assert.Equal(t, "event: resync", readLine(t, r))
+	})
+}
+
+func readLine(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+func waitOnline(t *testing.T, hub *Hub, userID int) {
+	t.Helper()
+
+	for i := 0; i < 100 && !hub.IsOnline(userID); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitOffline waits for the server to notice the previous stream was closed.
+func waitOffline(t *testing.T, hub *Hub, userID int) {
+	t.Helper()
+
+	for i := 0; i < 100 && hub.IsOnline(userID); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
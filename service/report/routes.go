@@ -0,0 +1,250 @@
+package report
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type Handler struct {
+	store             types.ReportStore
+	messageStore      types.MessageStore
+	conversationStore types.ConversationStore
+	userStore         types.UserStore
+	deleter           types.MessageDeleter
+	publisher         types.EventPublisher
+	signOut           types.SignOuter
+	connections       types.ConnectionCloser
+}
+
+func NewHandler(store types.ReportStore, messageStore types.MessageStore, conversationStore types.ConversationStore, userStore types.UserStore, deleter types.MessageDeleter, publisher types.EventPublisher, signOut types.SignOuter, connections types.ConnectionCloser) *Handler {
+	return &Handler{
+		store:             store,
+		messageStore:      messageStore,
+		conversationStore: conversationStore,
+		userStore:         userStore,
+		deleter:           deleter,
+		publisher:         publisher,
+		signOut:           signOut,
+		connections:       connections,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Post("/reports", auth.WithJWTAuth(h.handleCreateReport, h.userStore))
+	router.Get("/reports", auth.WithJWTAuth(auth.RequireRole(h.handleGetReports, types.SystemRoleModerator), h.userStore))
+	router.Post("/reports/:id/resolve", auth.WithJWTAuth(auth.RequireRole(h.handleResolveReport, types.SystemRoleModerator), h.userStore))
+}
+
+// Report a message, or a user, to the moderators
+func (h *Handler) handleCreateReport(c *fiber.Ctx) error {
+	var payload types.CreateReportPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	report := types.Report{ReporterID: userID, Reason: payload.Reason}
+
+	if payload.MessageID != 0 {
+		message, err := h.messageStore.GetMessageByID(payload.MessageID)
+		if err == nil && !message.DeletedAt.Valid {
+			_, err = h.conversationStore.GetParticipant(message.ConversationID, userID)
+		}
+		// messages of other conversations are none of the reporter's business
+		if err != nil || message.DeletedAt.Valid {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "message not found",
+			})
+		}
+
+		if message.SenderID == userID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "you cannot report your own message",
+			})
+		}
+
+		report.MessageID = sql.NullInt64{Int64: int64(message.ID), Valid: true}
+		report.ConversationID = sql.NullInt64{Int64: int64(message.ConversationID), Valid: true}
+		report.Content = sql.NullString{String: message.Content, Valid: true}
+		// messages posted by bots have no sender to report
+		report.ReportedUserID = sql.NullInt64{Int64: int64(message.SenderID), Valid: message.SenderID != 0}
+	} else {
+		if payload.UserID == userID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "you cannot report yourself",
+			})
+		}
+
+		if _, err := h.userStore.GetUserByID(payload.UserID); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "user not found",
+			})
+		}
+
+		report.ReportedUserID = sql.NullInt64{Int64: int64(payload.UserID), Valid: true}
+	}
+
+	created, err := h.store.CreateReport(report)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// List the reports to handle, oldest first
+func (h *Handler) handleGetReports(c *fiber.Ctx) error {
+	status := c.Query("status", types.ReportOpen)
+	if status != types.ReportOpen && status != types.ReportResolved {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid report status",
+		})
+	}
+
+	limit := c.QueryInt("limit", defaultPageSize)
+	if limit <= 0 || limit > maxPageSize {
+		limit = defaultPageSize
+	}
+
+	reports, err := h.store.GetReportsByStatus(status, c.QueryInt("after"), limit)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(reports)
+}
+
+// Resolve a report with an action and let the reporter know the outcome
+func (h *Handler) handleResolveReport(c *fiber.Ctx) error {
+	reportID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid report id",
+		})
+	}
+
+	var payload types.ResolveReportPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	report, err := h.store.GetReportByID(reportID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "report not found",
+		})
+	}
+
+	if report.Status != types.ReportOpen {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "report already resolved",
+		})
+	}
+
+	switch payload.Action {
+	case types.ReportActionDeleteMessage:
+		if !report.MessageID.Valid {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "the report is not about a message",
+			})
+		}
+		err = h.deleter.DeleteMessage(int(report.MessageID.Int64))
+	case types.ReportActionSuspendUser:
+		if !report.ReportedUserID.Valid {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "the reported message was not sent by a user",
+			})
+		}
+
+		// staff is only suspended by someone above them
+		reported, lookupErr := h.userStore.GetUserByID(int(report.ReportedUserID.Int64))
+		if lookupErr == nil && auth.HasRole(reported.Role, auth.GetRoleFromContext(c)) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "you cannot suspend this user",
+			})
+		}
+		err = h.suspendUser(int(report.ReportedUserID.Int64))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.store.ResolveReport(report.ID, auth.GetIDFromContext(c), payload.Action); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	h.publisher.SendToUser(report.ReporterID, types.Event{
+		Type:    types.EventReportResolved,
+		Payload: fiber.Map{"reportId": report.ID, "action": payload.Action},
+	}, "")
+
+	resolved, err := h.store.GetReportByID(report.ID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resolved)
+}
+
+// suspendUser suspends the user and signs them out of every device, their
+// open connections included.
+func (h *Handler) suspendUser(userID int) error {
+	if err := h.userStore.SuspendUser(userID); err != nil {
+		return err
+	}
+
+	if err := h.signOut.SignOutEverywhere(userID); err != nil {
+		return err
+	}
+
+	h.connections.DisconnectUser(userID)
+	return nil
+}
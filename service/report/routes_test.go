@@ -0,0 +1,414 @@
+package report
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportServiceHandlers(t *testing.T) {
+	store := &mockReportStore{reports: map[int]*types.Report{}}
+	messageStore := &mockMessageStore{messages: map[int]*types.Message{
+		1: {ID: 1, ConversationID: 1, SenderID: 2, Content: "you are awful"},
+		2: {ID: 2, ConversationID: 1, SenderID: 0, Content: "buy now"},
+	}}
+	conversationStore := &mockConversationStore{
+		participants: map[int]string{1: types.RoleMember, 2: types.RoleMember},
+	}
+	userStore := &mockUserStore{suspended: map[int]bool{}}
+	deleter := &mockDeleter{}
+	publisher := &mockPublisher{}
+	signOut := &mockSignOut{}
+	handler := NewHandler(store, messageStore, conversationStore, userStore, deleter, publisher, signOut, signOut)
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	t.Run("should fail if the report has no reason", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/reports", types.CreateReportPayload{MessageID: 1}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should not let outsiders report a message", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/reports", types.CreateReportPayload{MessageID: 1, Reason: "harassment"}, 3)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("should report a message with its content", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/reports", types.CreateReportPayload{MessageID: 1, Reason: "harassment"}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "you are awful", store.reports[1].Content.String)
+		assert.Equal(t, int64(2), store.reports[1].ReportedUserID.Int64)
+	})
+
+	t.Run("should report a user", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/reports", types.CreateReportPayload{UserID: 2, Reason: "spam"}, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.False(t, store.reports[2].MessageID.Valid)
+	})
+
+	t.Run("should only let moderators list reports", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/reports", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should list the open reports", func(t *testing.T) {
+		req := newRequest(t, http.MethodGet, "/reports", nil, 9)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		var reports []types.Report
+		json.NewDecoder(resp.Body).Decode(&reports)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, reports, 2)
+		assert.Equal(t, 1, reports[0].ID)
+	})
+
+	t.Run("should delete the reported message and notify the reporter", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/reports/1/resolve", types.ResolveReportPayload{Action: types.ReportActionDeleteMessage}, 9)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, []int{1}, deleter.deleted)
+		assert.Equal(t, types.ReportResolved, store.reports[1].Status)
+		assert.Equal(t, types.EventReportResolved, publisher.events[0].Type)
+		assert.Equal(t, []int{1}, publisher.userIDs[0])
+	})
+
+	t.Run("should not resolve a report twice", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/reports/1/resolve", types.ResolveReportPayload{Action: types.ReportActionDismiss}, 9)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should not delete a message for a report about a user", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/reports/2/resolve", types.ResolveReportPayload{Action: types.ReportActionDeleteMessage}, 9)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should suspend the reported user", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/reports/2/resolve", types.ResolveReportPayload{Action: types.ReportActionSuspendUser}, 9)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.True(t, userStore.suspended[2])
+		assert.Equal(t, types.ReportActionSuspendUser, store.reports[2].Action.String)
+		assert.Equal(t, []int{2}, signOut.signedOut)
+		assert.Equal(t, []int{2}, signOut.disconnected)
+	})
+
+	t.Run("should not let a moderator suspend another one", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/reports", types.CreateReportPayload{UserID: 8, Reason: "abuse of power"}, 1)
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		req = newRequest(t, http.MethodPost, "/reports/3/resolve", types.ResolveReportPayload{Action: types.ReportActionSuspendUser}, 9)
+		resp, err = app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.False(t, userStore.suspended[8])
+		assert.Equal(t, []int{2}, signOut.signedOut)
+	})
+
+	t.Run("should not suspend anyone for a message posted by a bot", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/reports", types.CreateReportPayload{MessageID: 2, Reason: "spam"}, 1)
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		req = newRequest(t, http.MethodPost, "/reports/4/resolve", types.ResolveReportPayload{Action: types.ReportActionSuspendUser}, 9)
+		resp, err = app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func newRequest(t *testing.T, method, target string, payload any, userID int) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+type mockReportStore struct {
+	reports map[int]*types.Report
+}
+
+func (m *mockReportStore) CreateReport(report types.Report) (*types.Report, error) {
+	report.ID = len(m.reports) + 1
+	report.Status = types.ReportOpen
+	report.CreatedAt = time.Now()
+	m.reports[report.ID] = &report
+	return &report, nil
+}
+
+func (m *mockReportStore) GetReportByID(id int) (*types.Report, error) {
+	if report, ok := m.reports[id]; ok {
+		return report, nil
+	}
+	return nil, fmt.Errorf("report not found")
+}
+
+func (m *mockReportStore) GetReportsByStatus(status string, afterID, limit int) ([]types.Report, error) {
+	reports := []types.Report{}
+	for id := afterID + 1; id <= len(m.reports) && len(reports) < limit; id++ {
+		if m.reports[id].Status == status {
+			reports = append(reports, *m.reports[id])
+		}
+	}
+	return reports, nil
+}
+
+func (m *mockReportStore) ResolveReport(id, resolvedBy int, action string) error {
+	m.reports[id].Status = types.ReportResolved
+	m.reports[id].Action.String, m.reports[id].Action.Valid = action, true
+	m.reports[id].ResolvedBy.Int64, m.reports[id].ResolvedBy.Valid = int64(resolvedBy), true
+	return nil
+}
+
+type mockMessageStore struct {
+	messages map[int]*types.Message
+}
+
+func (m *mockMessageStore) CreateMessage(message types.Message) (*types.Message, error) {
+	return nil, nil
+}
+
+func (m *mockMessageStore) GetMessageByID(id int) (*types.Message, error) {
+	if message, ok := m.messages[id]; ok {
+		return message, nil
+	}
+	return nil, fmt.Errorf("message not found")
+}
+
+func (m *mockMessageStore) GetMessagesByConversationID(conversationID, beforeID, limit int) ([]types.Message, error) {
+	return nil, nil
+}
+
+func (m *mockMessageStore) UpdateMessageContent(id int, content string) error {
+	return nil
+}
+
+func (m *mockMessageStore) DeleteMessage(id int) error {
+	return nil
+}
+
+func (m *mockMessageStore) GetMessageByClientID(senderID int, clientMessageID string) (*types.Message, error) {
+	return nil, fmt.Errorf("message not found")
+}
+
+func (m *mockMessageStore) CreateEncryptedMessage(message types.Message, ciphertexts []types.DeviceCiphertext) (*types.Message, error) {
+	return nil, nil
+}
+
+func (m *mockMessageStore) GetCiphertexts(messageIDs []int, userID int) (map[int][]types.DeviceCiphertext, error) {
+	return nil, nil
+}
+
+func (m *mockMessageStore) GetHeldMessages(conversationID int) ([]types.Message, error) {
+	return nil, nil
+}
+
+func (m *mockMessageStore) ReleaseMessage(id int) error {
+	return nil
+}
+
+// mockSignOut records the users signed out and disconnected.
+type mockSignOut struct {
+	signedOut    []int
+	disconnected []int
+}
+
+func (m *mockSignOut) SignOutEverywhere(userID int) error {
+	m.signedOut = append(m.signedOut, userID)
+	return nil
+}
+
+func (m *mockSignOut) DisconnectUser(userID int) {
+	m.disconnected = append(m.disconnected, userID)
+}
+
+type mockDeleter struct {
+	deleted []int
+}
+
+func (m *mockDeleter) DeleteMessage(id int) error {
+	m.deleted = append(m.deleted, id)
+	return nil
+}
+
+type mockPublisher struct {
+	events  []types.Event
+	userIDs [][]int
+}
+
+func (m *mockPublisher) SendToUser(userID int, event types.Event, exceptDevice string) {
+	m.SendToUsers([]int{userID}, event)
+}
+
+func (m *mockPublisher) SendToUsers(userIDs []int, event types.Event) {
+	m.events = append(m.events, event)
+	m.userIDs = append(m.userIDs, userIDs)
+}
+
+type mockConversationStore struct {
+	participants map[int]string
+}
+
+func (m *mockConversationStore) CreateConversation(name string, creatorID int, participantIDs []int) (*types.Conversation, error) {
+	return &types.Conversation{ID: 1}, nil
+}
+
+func (m *mockConversationStore) GetConversationByID(id int) (*types.Conversation, error) {
+	return &types.Conversation{ID: id}, nil
+}
+
+func (m *mockConversationStore) GetParticipant(conversationID, userID int) (*types.Participant, error) {
+	if role, ok := m.participants[userID]; ok {
+		return &types.Participant{ConversationID: conversationID, UserID: userID, Role: role}, nil
+	}
+	return nil, fmt.Errorf("participant not found")
+}
+
+func (m *mockConversationStore) GetParticipants(conversationID int) ([]types.Participant, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) RemoveParticipant(conversationID, userID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) MarkRead(conversationID, userID, messageID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) GetContactIDs(userID int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) ExportMessages(conversationID int, fn func(*types.ExportedMessage) error) error {
+	return nil
+}
+
+func (m *mockConversationStore) UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error {
+	return nil
+}
+
+type mockUserStore struct {
+	suspended map[int]bool
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	switch {
+	case id > 9:
+		return nil, fmt.Errorf("user not found")
+	case id >= 8:
+		return &types.User{ID: id, Role: types.SystemRoleModerator}, nil
+	}
+	return &types.User{ID: id, Role: types.SystemRoleUser}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	m.suspended[userID] = true
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
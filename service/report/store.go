@@ -0,0 +1,114 @@
+package report
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateReport(report types.Report) (*types.Report, error) {
+	res, err := s.db.Exec(
+		"INSERT INTO reports (reporter_id, reported_user_id, message_id, conversation_id, reason, content) VALUES (?, ?, ?, ?, ?, ?)",
+		report.ReporterID, report.ReportedUserID, report.MessageID, report.ConversationID, report.Reason, report.Content,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetReportByID(int(id))
+}
+
+func (s *Store) GetReportByID(id int) (*types.Report, error) {
+	rows, err := s.db.Query("SELECT * FROM reports WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := new(types.Report)
+	for rows.Next() {
+		r, err = scanRowIntoReport(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.ID == 0 {
+		return nil, fmt.Errorf("Report not found.")
+	}
+
+	return r, nil
+}
+
+// GetReportsByStatus returns a page of reports, oldest first so the queue is
+// worked through in order. afterID of 0 starts from the first one.
+func (s *Store) GetReportsByStatus(status string, afterID, limit int) ([]types.Report, error) {
+	rows, err := s.db.Query(
+		"SELECT * FROM reports WHERE status = ? AND id > ? ORDER BY id LIMIT ?",
+		status, afterID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []types.Report{}
+	for rows.Next() {
+		r, err := scanRowIntoReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *r)
+	}
+
+	return reports, nil
+}
+
+func (s *Store) ResolveReport(id, resolvedBy int, action string) error {
+	_, err := s.db.Exec(
+		"UPDATE reports SET status = ?, action = ?, resolved_by = ?, resolvedAt = CURRENT_TIMESTAMP WHERE id = ?;",
+		types.ReportResolved, action, resolvedBy, id,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func scanRowIntoReport(rows *sql.Rows) (*types.Report, error) {
+	r := new(types.Report)
+
+	err := rows.Scan(
+		&r.ID,
+		&r.ReporterID,
+		&r.ReportedUserID,
+		&r.MessageID,
+		&r.ConversationID,
+		&r.Reason,
+		&r.Content,
+		&r.Status,
+		&r.Action,
+		&r.ResolvedBy,
+		&r.ResolvedAt,
+		&r.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,90 @@
+package user
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"net/mail"
+	"net/url"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/*.html"))
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templates, "templates/*.txt"))
+)
+
+type emailData struct {
+	FirstName string
+	Email     string
+	Link      string
+	ValidFor  string
+}
+
+// sendEmail renders the templates with the name to the user, linking to the
+// page of the app at path with the token.
+func (h *Handler) sendEmail(u *types.User, name, subject, path, token string, validFor time.Duration) error {
+	data := emailData{
+		FirstName: u.FirstName,
+		Email:     u.Email,
+		Link:      config.Envs.PublicHost + path + "?token=" + url.QueryEscape(token),
+		ValidFor:  formatDuration(validFor),
+	}
+
+	var text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return err
+	}
+
+	to := (&mail.Address{Name: u.FirstName, Address: u.Email}).String()
+	return h.mailer.Send(types.Email{
+		To:      to,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	})
+}
+
+// sendInBackground runs f, which looks up who to email, after the answer is
+// sent. The answer then takes as long whether an address has an account or
+// not.
+func (h *Handler) sendInBackground(f func()) {
+	h.emails.Add(1)
+	go func() {
+		defer h.emails.Done()
+		f()
+	}()
+}
+
+// Wait blocks until every email in flight is sent.
+func (h *Handler) Wait() {
+	h.emails.Wait()
+}
+
+func formatDuration(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return plural(int(d/(24*time.Hour)), "day")
+	}
+	if d >= time.Hour && d%time.Hour == 0 {
+		return plural(int(d/time.Hour), "hour")
+	}
+	return plural(int(d/time.Minute), "minute")
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,200 @@
+package user
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+// exportProfile is the profile section of a data export. It is spelled out
+// separately so the password hash never ends up in the archive.
+type exportProfile struct {
+	ID             int    `json:"id"`
+	FirstName      string `json:"firstName"`
+	LastName       string `json:"lastName"`
+	Email          string `json:"email"`
+	ProfilePicture string `json:"profilePicture,omitempty"`
+	CreatedAt      string `json:"createdAt"`
+}
+
+// buildDataExport runs in the background, writes the archive for the export
+// and records the outcome on the export row.
+func (h *Handler) buildDataExport(export *types.DataExport) {
+	path, err := h.writeDataExport(export)
+	if err != nil {
+		log.Printf("data export %d failed: %v", export.ID, err)
+		if err := h.exportStore.FailDataExport(export.ID, err.Error()); err != nil {
+			log.Printf("data export %d: %v", export.ID, err)
+		}
+		return
+	}
+
+	if err := h.exportStore.CompleteDataExport(export.ID, path); err != nil {
+		log.Printf("data export %d: %v", export.ID, err)
+	}
+}
+
+func (h *Handler) writeDataExport(export *types.DataExport) (string, error) {
+	u, err := h.store.GetUserByID(export.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(config.Envs.ExportsDir, 0o750); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(config.Envs.ExportsDir, exportFileName(export.UserID, export.ID))
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+
+	zw := zip.NewWriter(f)
+	if err := h.writeArchive(zw, u); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+func (h *Handler) writeArchive(zw *zip.Writer, u *types.User) error {
+	profile := exportProfile{
+		ID:             u.ID,
+		FirstName:      u.FirstName,
+		LastName:       u.LastName,
+		Email:          u.Email,
+		ProfilePicture: u.ProfilePicture.String,
+		CreatedAt:      u.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if err := writeJSONEntry(zw, "profile.json", profile); err != nil {
+		return err
+	}
+
+	conversations, err := h.exportStore.GetConversationsByUserID(u.ID)
+	if err != nil {
+		return err
+	}
+	if err := writeJSONEntry(zw, "conversations.json", conversations); err != nil {
+		return err
+	}
+
+	// messages are streamed into the archive, only the attachment paths are
+	// kept around so the files can be copied afterwards
+	w, err := zw.Create("messages.json")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	files := map[string]string{}
+	count := 0
+	err = h.exportStore.GetMessagesBySenderID(u.ID, func(m *types.ExportedMessage) error {
+		for _, a := range m.Attachments {
+			files[fmt.Sprintf("files/attachments/%d_%s", m.ID, filepath.Base(a.FileName))] = a.URL
+		}
+
+		if count > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		count++
+
+		return json.NewEncoder(w).Encode(m)
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "]"); err != nil {
+		return err
+	}
+
+	if u.ProfilePicture.Valid && u.ProfilePicture.String != "" {
+		files["files/"+u.ProfilePicture.String] = u.ProfilePicture.String
+	}
+
+	for name, path := range files {
+		if err := copyFileEntry(zw, name, fmt.Sprintf("./web/static/%s", path)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeJSONEntry(zw *zip.Writer, name string, v any) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func copyFileEntry(zw *zip.Writer, name string, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// files removed from disk are simply left out of the archive
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func exportFileName(userID, exportID int) string {
+	return fmt.Sprintf("%d_%d.zip", userID, exportID)
+}
+
+// removeDataExports deletes every archive generated for the user.
+func removeDataExports(userID int) error {
+	matches, err := filepath.Glob(filepath.Join(config.Envs.ExportsDir, fmt.Sprintf("%d_*.zip", userID)))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range matches {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
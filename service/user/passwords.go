@@ -0,0 +1,256 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+const passwordResetTokenTTL = time.Hour
+
+// Email a password reset link. The answer is the same whether the address
+// belongs to an account or not, so that it can not be used to find out who
+// signed up
+func (h *Handler) handleForgotPassword(c *fiber.Ctx) error {
+	var payload types.ForgotPasswordPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	// fiber reuses the request buffer the payload may point into
+	email := strings.Clone(payload.Email)
+	h.sendInBackground(func() {
+		if u, err := h.store.GetUserByEmail(email); err == nil {
+			h.sendPasswordResetEmail(u)
+		}
+	})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "a password reset email was sent if the address belongs to an account",
+	})
+}
+
+// Choose a new password with the token of a password reset email, every
+// device of the user is signed out
+func (h *Handler) handleResetPassword(c *fiber.Ctx) error {
+	var payload types.ResetPasswordPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	stored, err := h.passwordStore.GetPasswordResetTokenByHash(hashToken(payload.Token))
+	if err != nil || stored.UsedAt.Valid || time.Now().After(stored.ExpiresAt) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid or expired reset token",
+		})
+	}
+
+	used, err := h.passwordStore.UsePasswordResetToken(stored.ID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if !used {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid or expired reset token",
+		})
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.Password)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.passwordStore.UpdateUserPassword(stored.UserID, hashedPassword); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// the other links emailed meanwhile would reset the new password
+	if err := h.passwordStore.InvalidateUserPasswordResetTokens(stored.UserID); err != nil {
+		log.Printf("failed to invalidate the password reset tokens of user %d: %v", stored.UserID, err)
+	}
+
+	// whoever knew the old password is signed out too
+	if err := h.SignOutEverywhere(stored.UserID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "password reset, please log in again",
+	})
+}
+
+// Change the password of the user, who has to know the current one. The
+// other devices can be signed out at the same time
+func (h *Handler) handleChangePassword(c *fiber.Ctx) error {
+	var payload types.ChangePasswordPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	claims := auth.GetClaimsFromContext(c)
+	u, err := h.store.GetUserByID(claims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "user not found",
+		})
+	}
+
+	if !auth.ComparePasswords(u.Password, []byte(payload.CurrentPassword)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid password",
+		})
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.NewPassword)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.passwordStore.UpdateUserPassword(u.ID, hashedPassword); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// a reset link emailed before would undo the change
+	if err := h.passwordStore.InvalidateUserPasswordResetTokens(u.ID); err != nil {
+		log.Printf("failed to invalidate the password reset tokens of user %d: %v", u.ID, err)
+	}
+
+	if payload.SignOutOtherSessions {
+		if err := h.signOutOtherSessions(u.ID, claims.SessionID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "password changed",
+	})
+}
+
+// signOutOtherSessions signs out every session of the user but the current
+// one. Tokens issued before sessions existed are not bound to any and keep
+// working until they expire.
+func (h *Handler) signOutOtherSessions(userID int, currentSessionID string) error {
+	sessions, err := h.sessionStore.GetUserSessions(userID, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == currentSessionID {
+			continue
+		}
+		if err := h.revokeSession(session.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendPasswordResetEmail emails the user a single use link to choose a new
+// password. A failure is only logged, the user can ask for another email.
+func (h *Handler) sendPasswordResetEmail(u *types.User) {
+	token, err := utils.RandomString(32)
+	if err != nil {
+		log.Printf("failed to create the password reset token of user %d: %v", u.ID, err)
+		return
+	}
+
+	err = h.passwordStore.CreatePasswordResetToken(types.PasswordResetToken{
+		UserID:    u.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(passwordResetTokenTTL),
+	})
+	if err != nil {
+		log.Printf("failed to store the password reset token of user %d: %v", u.ID, err)
+		return
+	}
+
+	err = h.sendEmail(u, "reset-password", "Reset your password", "/reset-password", token, passwordResetTokenTTL)
+	if err != nil {
+		log.Printf("failed to send the password reset email of user %d: %v", u.ID, err)
+	}
+}
+
+// CleanupPasswordResetTokens drops the expired password reset tokens every
+// interval, until stop is closed.
+func CleanupPasswordResetTokens(store types.PasswordStore, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			deleted, err := store.DeleteExpiredPasswordResetTokens(time.Now())
+			if err != nil {
+				log.Printf("user: password reset token cleanup failed: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("user: deleted %d expired password reset tokens", deleted)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -4,9 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"time"
+	"sync"
 
-	"github.com/dclouisDan/chat-app-api/config"
 	"github.com/dclouisDan/chat-app-api/service/auth"
 	"github.com/dclouisDan/chat-app-api/types"
 	"github.com/dclouisDan/chat-app-api/utils"
@@ -15,19 +14,53 @@ import (
 )
 
 type Handler struct {
-	store types.UserStore
+	store             types.UserStore
+	exportStore       types.DataExportStore
+	refreshStore      types.RefreshTokenStore
+	sessionStore      types.SessionStore
+	verificationStore types.EmailVerificationStore
+	passwordStore     types.PasswordStore
+	revoker           types.TokenRevoker
+	sessions          types.SessionRevoker
+	mailer            types.Mailer
+	emails            sync.WaitGroup
 }
 
-func NewHandler(store types.UserStore) *Handler {
-	return &Handler{store: store}
+func NewHandler(store types.UserStore, exportStore types.DataExportStore, refreshStore types.RefreshTokenStore, sessionStore types.SessionStore, verificationStore types.EmailVerificationStore, passwordStore types.PasswordStore, revoker types.TokenRevoker, sessions types.SessionRevoker, mailer types.Mailer) *Handler {
+	return &Handler{
+		store:             store,
+		exportStore:       exportStore,
+		refreshStore:      refreshStore,
+		sessionStore:      sessionStore,
+		verificationStore: verificationStore,
+		passwordStore:     passwordStore,
+		revoker:           revoker,
+		sessions:          sessions,
+		mailer:            mailer,
+	}
 }
 
 func (h *Handler) RegisterRoutes(router fiber.Router) {
 	router.Post("/login", h.handleLogin)
 	router.Post("/register", h.handleRegister)
+	router.Post("/auth/refresh", h.handleRefreshToken)
+	router.Post("/auth/verify-email", h.handleVerifyEmail)
+	router.Post("/auth/verify-email/resend", h.handleResendVerification)
+	router.Post("/auth/forgot-password", h.handleForgotPassword)
+	router.Post("/auth/reset-password", h.handleResetPassword)
+	router.Post("/logout", auth.WithJWTAuth(h.handleLogout, h.store))
+	router.Post("/logout-all", auth.WithJWTAuth(h.handleLogoutAll, h.store))
+	router.Get("/sessions", auth.WithJWTAuth(h.handleGetSessions, h.store))
+	router.Delete("/sessions/:id", auth.WithJWTAuth(h.handleDeleteSession, h.store))
 	router.Post("/profile/updateProfilePhoto", auth.WithJWTAuth(h.handleProfilePictureUpdate, h.store))
 	router.Post("/profile/update", auth.WithJWTAuth(h.handleProfileUpdate, h.store))
+	router.Post("/profile/password", auth.WithJWTAuth(h.handleChangePassword, h.store))
 	router.Get("/profile", auth.WithJWTAuth(h.handleProfile, h.store))
+	router.Delete("/profile", auth.WithJWTAuth(h.handleDeleteAccount, h.store))
+	router.Post("/profile/export", auth.WithJWTAuth(h.handleRequestDataExport, h.store))
+	router.Get("/profile/export/:id", auth.WithJWTAuth(h.handleDataExportStatus, h.store))
+	router.Get("/profile/export/:id/download", auth.WithJWTAuth(h.handleDataExportDownload, h.store))
+	router.Put("/users/:id/role", auth.WithJWTAuth(auth.RequireRole(h.handleUpdateRole, types.SystemRoleAdmin), h.store))
 }
 
 // User Login
@@ -65,25 +98,28 @@ func (h *Handler) handleLogin(c *fiber.Ctx) error {
 		})
 	}
 
-	secret := []byte(config.Envs.JWTSecret)
-	token, expireAt, err := auth.CreateJWT(secret, u.ID)
+	if u.SuspendedAt.Valid {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "account suspended",
+		})
+	}
+
+	if !u.EmailVerifiedAt.Valid && auth.VerificationRequired(auth.VerifyBeforeLogin) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "email not verified",
+		})
+	}
+
+	session, err := h.newSession(c, u.ID, payload.DeviceName)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "token",
-		Value:    token,
-		Expires:  time.Unix(expireAt, 0),
-		HTTPOnly: true,
-	})
 	log.Print("login success")
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"token": token,
-	})
+	return h.issueTokens(c, u, session.ID)
 }
 
 // User Registration
@@ -132,6 +168,11 @@ func (h *Handler) handleRegister(c *fiber.Ctx) error {
 		})
 	}
 
+	// the id of the user is only known once stored
+	if u, err := h.store.GetUserByEmail(payload.Email); err == nil {
+		h.sendVerificationEmail(u)
+	}
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "user created.",
 	})
@@ -151,6 +192,58 @@ func (h *Handler) handleProfile(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(u)
 }
 
+// Grant a system role to a user
+func (h *Handler) handleUpdateRole(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid user id",
+		})
+	}
+
+	// an instance left without admins could only be fixed in the database
+	if userID == auth.GetIDFromContext(c) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "you cannot change your own role",
+		})
+	}
+
+	var payload types.UpdateUserRolePayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	if _, err := h.store.GetUserByID(userID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "user not found",
+		})
+	}
+
+	if err := h.store.UpdateUserRole(userID, payload.Role); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"id":   userID,
+		"role": payload.Role,
+	})
+}
+
 // Account profile update
 func (h *Handler) handleProfileUpdate(c *fiber.Ctx) error {
 	var payload types.UpdateUserPayload
@@ -181,25 +274,34 @@ func (h *Handler) handleProfileUpdate(c *fiber.Ctx) error {
 
 	userID := auth.GetIDFromContext(c)
 
-	_, err = h.store.GetUserByID(userID)
+	current, err := h.store.GetUserByID(userID)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "user not found",
 		})
 	}
 
-	err = h.store.UpdateUser(types.User{
+	emailChanged := current.Email != payload.Email
+
+	updated := types.User{
 		ID:        userID,
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Email:     payload.Email,
-	})
+	}
+	err = h.store.UpdateUser(updated)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
+	// the new address is not verified until the user follows the link sent
+	// to it
+	if emailChanged {
+		h.sendVerificationEmail(&updated)
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "user account updated",
 	})
@@ -251,6 +353,126 @@ func (h *Handler) handleProfilePictureUpdate(c *fiber.Ctx) error {
 	})
 }
 
+// Request an archive of all personal data, built in the background
+func (h *Handler) handleRequestDataExport(c *fiber.Ctx) error {
+	userID := auth.GetIDFromContext(c)
+
+	export, err := h.exportStore.CreateDataExport(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	go h.buildDataExport(export)
+
+	return c.Status(fiber.StatusAccepted).JSON(export)
+}
+
+// Status of a personal data export
+func (h *Handler) handleDataExportStatus(c *fiber.Ctx) error {
+	export, err := h.getOwnDataExport(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(export)
+}
+
+// Download a finished personal data export
+func (h *Handler) handleDataExportDownload(c *fiber.Ctx) error {
+	export, err := h.getOwnDataExport(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if export.Status != types.DataExportCompleted || !export.FilePath.Valid {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("data export is %s", export.Status),
+		})
+	}
+
+	return c.Download(export.FilePath.String, fmt.Sprintf("data-export-%d.zip", export.ID))
+}
+
+func (h *Handler) getOwnDataExport(c *fiber.Ctx) (*types.DataExport, error) {
+	exportID, err := c.ParamsInt("id")
+	if err != nil {
+		return nil, fmt.Errorf("invalid data export id")
+	}
+
+	export, err := h.exportStore.GetDataExportByID(exportID)
+	if err != nil || export.UserID != auth.GetIDFromContext(c) {
+		return nil, fmt.Errorf("data export not found")
+	}
+
+	return export, nil
+}
+
+// Delete the account. Personal data is scrubbed while the messages stay in
+// their conversations attributed to "Deleted user".
+func (h *Handler) handleDeleteAccount(c *fiber.Ctx) error {
+	var payload types.DeleteAccountPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	userID := auth.GetIDFromContext(c)
+	u, err := h.store.GetUserByID(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "user not found",
+		})
+	}
+
+	if !auth.ComparePasswords(u.Password, []byte(payload.Password)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid password",
+		})
+	}
+
+	if err := checkOldPhoto(u.ProfilePicture.String); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := removeDataExports(userID); err != nil {
+		log.Printf("failed to remove data exports of user %d: %v", userID, err)
+	}
+
+	// deleted users are no longer found by id, which invalidates every
+	// token issued to them in auth.WithJWTAuth
+	if err := h.store.AnonymizeUser(userID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	c.ClearCookie("token")
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "user account deleted",
+	})
+}
+
 func checkOldPhoto(path string) error {
 	if path == "" {
 		return nil
@@ -1,13 +1,21 @@
 package user
 
 import (
+	"archive/zip"
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
 	"github.com/dclouisDan/chat-app-api/types"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -15,7 +23,7 @@ import (
 
 func TestUserServiceHandlers(t *testing.T) {
 	userStore := &mockUserStore{}
-	handler := NewHandler(userStore)
+	handler := NewHandler(userStore, &mockDataExportStore{}, newMockRefreshTokenStore(), newMockSessionStore(), userStore, newMockPasswordStore(), &mockTokenRevoker{}, &mockSessionRevoker{}, &mockMailer{})
 
 	app := fiber.New()
 
@@ -80,21 +88,644 @@ func TestUserServiceHandlers(t *testing.T) {
 
 }
 
-type mockUserStore struct{}
+func TestEmailVerificationHandlers(t *testing.T) {
+	userStore := &mockUserStore{}
+	mailer := &mockMailer{}
+	handler := NewHandler(userStore, &mockDataExportStore{}, newMockRefreshTokenStore(), newMockSessionStore(), userStore, newMockPasswordStore(), &mockTokenRevoker{}, &mockSessionRevoker{}, mailer)
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	post := func(t *testing.T, target, token string, payload any) int {
+		t.Helper()
+
+		marshalled, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewBuffer(marshalled))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		handler.Wait()
+		return resp.StatusCode
+	}
+
+	var verificationToken string
+
+	t.Run("should email a verification link on registration", func(t *testing.T) {
+		status := post(t, "/register", "", types.RegisterUserPayload{FirstName: "user", LastName: "client", Email: "user@email.com", Password: "password"})
+		assert.Equal(t, http.StatusCreated, status)
+
+		assert.Len(t, mailer.sent, 1)
+		assert.Contains(t, mailer.sent[0].To, "user@email.com")
+		verificationToken = mailer.token(t)
+	})
+
+	t.Run("should block login until the email is verified when configured", func(t *testing.T) {
+		config.Envs.RequireVerifiedEmail = auth.VerifyBeforeLogin
+		defer func() { config.Envs.RequireVerifiedEmail = "" }()
+
+		status := post(t, "/login", "", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+		assert.Equal(t, http.StatusForbidden, status)
+	})
+
+	t.Run("should refuse tokens that are not verification tokens", func(t *testing.T) {
+		accessToken, _, _ := auth.CreateJWT([]byte(config.Envs.JWTSecret), 1, types.SystemRoleUser, "")
+		status := post(t, "/auth/verify-email", "", types.VerifyEmailPayload{Token: accessToken})
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		status = post(t, "/auth/verify-email", "", types.VerifyEmailPayload{Token: "made-up"})
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.False(t, userStore.user.EmailVerifiedAt.Valid)
+	})
+
+	t.Run("should verify the email with the emailed token", func(t *testing.T) {
+		status := post(t, "/auth/verify-email", "", types.VerifyEmailPayload{Token: verificationToken})
+		assert.Equal(t, http.StatusOK, status)
+		assert.True(t, userStore.user.EmailVerifiedAt.Valid)
+
+		config.Envs.RequireVerifiedEmail = auth.VerifyBeforeLogin
+		defer func() { config.Envs.RequireVerifiedEmail = "" }()
+
+		status = post(t, "/login", "", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+		assert.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("should ask to verify a new address", func(t *testing.T) {
+		token, _, _ := auth.CreateJWT([]byte(config.Envs.JWTSecret), 1, types.SystemRoleUser, "")
+		status := post(t, "/profile/update", token, types.UpdateUserPayload{FirstName: "user", LastName: "client", Email: "new@email.com"})
+		assert.Equal(t, http.StatusOK, status)
+		assert.False(t, userStore.user.EmailVerifiedAt.Valid)
+		assert.Contains(t, mailer.sent[len(mailer.sent)-1].To, "new@email.com")
+
+		// the link sent to the old address no longer works
+		status = post(t, "/auth/verify-email", "", types.VerifyEmailPayload{Token: verificationToken})
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.False(t, userStore.user.EmailVerifiedAt.Valid)
+	})
+
+	t.Run("should resend the verification email without telling who signed up", func(t *testing.T) {
+		sent := len(mailer.sent)
+
+		status := post(t, "/auth/verify-email/resend", "", types.ResendVerificationPayload{Email: "nobody@email.com"})
+		assert.Equal(t, http.StatusOK, status)
+		assert.Len(t, mailer.sent, sent)
+
+		status = post(t, "/auth/verify-email/resend", "", types.ResendVerificationPayload{Email: "new@email.com"})
+		assert.Equal(t, http.StatusOK, status)
+		assert.Len(t, mailer.sent, sent+1)
+
+		status = post(t, "/auth/verify-email", "", types.VerifyEmailPayload{Token: mailer.token(t)})
+		assert.Equal(t, http.StatusOK, status)
+		assert.True(t, userStore.user.EmailVerifiedAt.Valid)
+	})
+}
+
+func TestPasswordResetHandlers(t *testing.T) {
+	hashed, err := auth.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userStore := &mockUserStore{
+		user: &types.User{ID: 1, FirstName: "user", LastName: "client", Email: "user@email.com", Password: hashed},
+	}
+	refreshStore := newMockRefreshTokenStore()
+	passwordStore := newMockPasswordStore()
+	revoker := &mockTokenRevoker{}
+	mailer := &mockMailer{}
+	handler := NewHandler(userStore, &mockDataExportStore{}, refreshStore, newMockSessionStore(), userStore, passwordStore, revoker, &mockSessionRevoker{}, mailer)
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	post := func(t *testing.T, target string, payload any) int {
+		t.Helper()
+
+		marshalled, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewBuffer(marshalled))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		handler.Wait()
+		return resp.StatusCode
+	}
+
+	t.Run("should answer the same for unknown addresses", func(t *testing.T) {
+		status := post(t, "/auth/forgot-password", types.ForgotPasswordPayload{Email: "nobody@email.com"})
+		assert.Equal(t, http.StatusOK, status)
+		assert.Empty(t, mailer.sent)
+		assert.Empty(t, passwordStore.tokens)
+	})
+
+	var first, second string
+
+	t.Run("should email a reset link and store the token hashed", func(t *testing.T) {
+		status := post(t, "/auth/forgot-password", types.ForgotPasswordPayload{Email: "user@email.com"})
+		assert.Equal(t, http.StatusOK, status)
+		first = mailer.token(t)
+
+		post(t, "/auth/forgot-password", types.ForgotPasswordPayload{Email: "user@email.com"})
+		second = mailer.token(t)
+
+		assert.Len(t, passwordStore.tokens, 2)
+		assert.Equal(t, hashToken(first), passwordStore.tokens[0].TokenHash)
+		assert.NotEqual(t, first, passwordStore.tokens[0].TokenHash)
+	})
+
+	t.Run("should enforce the password policy", func(t *testing.T) {
+		status := post(t, "/auth/reset-password", types.ResetPasswordPayload{Token: first, Password: "ab"})
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Empty(t, passwordStore.passwords)
+	})
+
+	t.Run("should reset the password and sign every device out", func(t *testing.T) {
+		refreshStore.CreateRefreshToken(types.RefreshToken{UserID: 1, FamilyID: "laptop", TokenHash: hashToken("refresh"), ExpiresAt: time.Now().Add(time.Hour)})
+
+		status := post(t, "/auth/reset-password", types.ResetPasswordPayload{Token: first, Password: "new-password"})
+		assert.Equal(t, http.StatusOK, status)
+
+		assert.True(t, auth.ComparePasswords(passwordStore.passwords[1], []byte("new-password")))
+		assert.Equal(t, []int{1}, revoker.revokedUsers)
+		assert.True(t, refreshStore.tokens[0].RevokedAt.Valid)
+	})
+
+	t.Run("should only accept a token once", func(t *testing.T) {
+		status := post(t, "/auth/reset-password", types.ResetPasswordPayload{Token: first, Password: "other-password"})
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		// the link sent before the reset went too
+		status = post(t, "/auth/reset-password", types.ResetPasswordPayload{Token: second, Password: "other-password"})
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		assert.True(t, auth.ComparePasswords(passwordStore.passwords[1], []byte("new-password")))
+	})
+
+	t.Run("should refuse expired tokens", func(t *testing.T) {
+		post(t, "/auth/forgot-password", types.ForgotPasswordPayload{Email: "user@email.com"})
+		passwordStore.tokens[len(passwordStore.tokens)-1].ExpiresAt = time.Now().Add(-time.Minute)
+
+		status := post(t, "/auth/reset-password", types.ResetPasswordPayload{Token: mailer.token(t), Password: "other-password"})
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+}
+
+func TestAccountDataHandlers(t *testing.T) {
+	config.Envs.ExportsDir = t.TempDir()
+
+	hashed, err := auth.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userStore := &mockUserStore{
+		user: &types.User{ID: 1, FirstName: "user", LastName: "client", Email: "user@email.com", Password: hashed},
+	}
+	exportStore := &mockDataExportStore{done: make(chan struct{})}
+	handler := NewHandler(userStore, exportStore, newMockRefreshTokenStore(), newMockSessionStore(), userStore, newMockPasswordStore(), &mockTokenRevoker{}, &mockSessionRevoker{}, &mockMailer{})
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), 1, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should build a data export archive in the background", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/profile/export", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		select {
+		case <-exportStore.done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("data export was not completed")
+		}
+
+		assert.Equal(t, types.DataExportCompleted, exportStore.export.Status)
+
+		archive, err := zip.OpenReader(exportStore.export.FilePath.String)
+		assert.NoError(t, err, "error opening archive")
+		defer archive.Close()
+
+		names := []string{}
+		for _, f := range archive.File {
+			names = append(names, f.Name)
+		}
+		assert.ElementsMatch(t, []string{"profile.json", "conversations.json", "messages.json"}, names)
+
+		profile, err := archive.Open("profile.json")
+		assert.NoError(t, err)
+		defer profile.Close()
+		body, _ := io.ReadAll(profile)
+		assert.NotContains(t, string(body), hashed)
+	})
+
+	t.Run("should refuse the tokens of a suspended account", func(t *testing.T) {
+		userStore.user.SuspendedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		defer func() { userStore.user.SuspendedAt = sql.NullTime{} }()
+
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should only let admins grant roles", func(t *testing.T) {
+		marshalled, _ := json.Marshal(types.UpdateUserRolePayload{Role: types.SystemRoleAdmin})
+		req := httptest.NewRequest(http.MethodPut, "/users/1/role", bytes.NewBuffer(marshalled))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should not let admins change their own role", func(t *testing.T) {
+		userStore.user.Role = types.SystemRoleAdmin
+		defer func() { userStore.user.Role = types.SystemRoleUser }()
+
+		marshalled, _ := json.Marshal(types.UpdateUserRolePayload{Role: types.SystemRoleUser})
+		req := httptest.NewRequest(http.MethodPut, "/users/1/role", bytes.NewBuffer(marshalled))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Empty(t, userStore.role)
+	})
+
+	t.Run("should fail to delete the account with a wrong password", func(t *testing.T) {
+		marshalled, _ := json.Marshal(types.DeleteAccountPayload{Password: "wrongpassword"})
+		req := httptest.NewRequest(http.MethodDelete, "/profile", bytes.NewBuffer(marshalled))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.False(t, userStore.anonymized)
+	})
+
+	t.Run("should anonymize the account on deletion", func(t *testing.T) {
+		marshalled, _ := json.Marshal(types.DeleteAccountPayload{Password: "password"})
+		req := httptest.NewRequest(http.MethodDelete, "/profile", bytes.NewBuffer(marshalled))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.True(t, userStore.anonymized)
+
+		matches, _ := filepath.Glob(filepath.Join(config.Envs.ExportsDir, "1_*.zip"))
+		assert.Empty(t, matches, "expected data exports to be removed")
+	})
+}
+
+func TestTokenHandlers(t *testing.T) {
+	hashed, err := auth.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userStore := &mockUserStore{
+		user: &types.User{ID: 1, FirstName: "user", LastName: "client", Email: "user@email.com", Password: hashed},
+	}
+	refreshStore := newMockRefreshTokenStore()
+	revocations := auth.NewRevocations(newMockRevocationStore(), time.Minute)
+	auth.UseRevocations(revocations)
+	defer auth.UseRevocations(nil)
+	sessionStore := newMockSessionStore()
+	passwordStore := newMockPasswordStore()
+	sessions := auth.NewSessions(sessionStore, time.Minute)
+	auth.UseSessions(sessions)
+	defer auth.UseSessions(nil)
+	handler := NewHandler(userStore, &mockDataExportStore{}, refreshStore, sessionStore, userStore, passwordStore, revocations, sessions, &mockMailer{})
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	post := func(t *testing.T, target string, payload any) (*http.Response, map[string]any) {
+		t.Helper()
+
+		marshalled, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewBuffer(marshalled))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body := map[string]any{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp, body
+	}
+
+	var refreshToken string
+
+	t.Run("should return an access token and a refresh token on login", func(t *testing.T) {
+		resp, body := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotEmpty(t, body["token"])
+		assert.NotEmpty(t, body["refreshToken"])
+		refreshToken = body["refreshToken"].(string)
+
+		assert.Len(t, refreshStore.tokens, 1)
+		assert.NotEqual(t, refreshToken, refreshStore.tokens[0].TokenHash, "expected the refresh token to be stored hashed")
+	})
+
+	var rotated string
+
+	t.Run("should rotate the refresh token", func(t *testing.T) {
+		resp, body := post(t, "/auth/refresh", types.RefreshTokenPayload{RefreshToken: refreshToken})
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotEmpty(t, body["token"])
+		rotated = body["refreshToken"].(string)
+		assert.NotEqual(t, refreshToken, rotated)
+
+		assert.Len(t, refreshStore.tokens, 2)
+		assert.Equal(t, refreshStore.tokens[0].FamilyID, refreshStore.tokens[1].FamilyID)
+		assert.True(t, refreshStore.tokens[0].UsedAt.Valid)
+	})
+
+	t.Run("should revoke the family when a refresh token is reused", func(t *testing.T) {
+		resp, _ := post(t, "/auth/refresh", types.RefreshTokenPayload{RefreshToken: refreshToken})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		// the token the legitimate client holds is gone too
+		resp, _ = post(t, "/auth/refresh", types.RefreshTokenPayload{RefreshToken: rotated})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("should refuse expired refresh tokens", func(t *testing.T) {
+		_, body := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+		refreshStore.tokens[len(refreshStore.tokens)-1].ExpiresAt = time.Now().Add(-time.Minute)
+
+		resp, _ := post(t, "/auth/refresh", types.RefreshTokenPayload{RefreshToken: body["refreshToken"].(string)})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("should refuse unknown refresh tokens", func(t *testing.T) {
+		resp, _ := post(t, "/auth/refresh", types.RefreshTokenPayload{RefreshToken: "made-up"})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	authorized := func(t *testing.T, method, target, token string, payload any) *http.Response {
+		t.Helper()
+
+		body := new(bytes.Buffer)
+		if payload != nil {
+			json.NewEncoder(body).Encode(payload)
+		}
+		req := httptest.NewRequest(method, target, body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	t.Run("should revoke the token and the refresh token on logout", func(t *testing.T) {
+		_, first := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+		_, second := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+		token := first["token"].(string)
+
+		resp := authorized(t, http.MethodPost, "/logout", token, types.LogoutPayload{RefreshToken: first["refreshToken"].(string)})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var cleared bool
+		for _, cookie := range resp.Cookies() {
+			cleared = cleared || (cookie.Name == "token" && cookie.Value == "")
+		}
+		assert.True(t, cleared, "expected the token cookie to be cleared")
+
+		resp = authorized(t, http.MethodGet, "/profile", token, nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		resp, _ = post(t, "/auth/refresh", types.RefreshTokenPayload{RefreshToken: first["refreshToken"].(string)})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		// the other device is still signed in
+		resp = authorized(t, http.MethodGet, "/profile", second["token"].(string), nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should list the sessions of the user", func(t *testing.T) {
+		_, body := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password", DeviceName: "Jane's laptop"})
+
+		req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+body["token"].(string))
+		req.Header.Set("User-Agent", "Mozilla/5.0")
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var listed []types.Session
+		json.NewDecoder(resp.Body).Decode(&listed)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		current := 0
+		for _, session := range listed {
+			if session.Current {
+				current++
+				assert.Equal(t, "Jane's laptop", session.DeviceName)
+			}
+		}
+		assert.Equal(t, 1, current, "expected the session of the request to be marked")
+		assert.Len(t, listed, len(sessionStore.active(1)))
+	})
+
+	t.Run("should sign a single device out", func(t *testing.T) {
+		_, laptop := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password", DeviceName: "laptop"})
+		_, phone := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password", DeviceName: "phone"})
+
+		phoneSession := sessionStore.sessions[len(sessionStore.sessions)-1].ID
+		resp := authorized(t, http.MethodDelete, "/sessions/"+phoneSession, laptop["token"].(string), nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp = authorized(t, http.MethodGet, "/profile", phone["token"].(string), nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		resp, _ = post(t, "/auth/refresh", types.RefreshTokenPayload{RefreshToken: phone["refreshToken"].(string)})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		resp = authorized(t, http.MethodGet, "/profile", laptop["token"].(string), nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should not sign out the sessions of other users", func(t *testing.T) {
+		_, body := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+		sessionStore.CreateSession(types.Session{ID: "someone-else", UserID: 2, LastActiveAt: time.Now()})
+
+		resp := authorized(t, http.MethodDelete, "/sessions/someone-else", body["token"].(string), nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Len(t, sessionStore.active(2), 1)
+	})
+
+	t.Run("should give a session to logins from before sessions existed", func(t *testing.T) {
+		refreshStore.CreateRefreshToken(types.RefreshToken{
+			UserID:    1,
+			FamilyID:  "legacy",
+			TokenHash: hashToken("legacy-refresh-token"),
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+
+		resp, body := post(t, "/auth/refresh", types.RefreshTokenPayload{RefreshToken: "legacy-refresh-token"})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		_, err := sessionStore.GetSessionByID("legacy")
+		assert.NoError(t, err)
+
+		resp = authorized(t, http.MethodGet, "/profile", body["token"].(string), nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should only change the password given the current one", func(t *testing.T) {
+		_, body := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+		token := body["token"].(string)
+
+		resp := authorized(t, http.MethodPost, "/profile/password", token, types.ChangePasswordPayload{CurrentPassword: "wrong", NewPassword: "new-password"})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp = authorized(t, http.MethodPost, "/profile/password", token, types.ChangePasswordPayload{CurrentPassword: "password", NewPassword: "ab"})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		assert.Empty(t, passwordStore.passwords)
+	})
+
+	t.Run("should change the password and keep the other devices signed in", func(t *testing.T) {
+		_, laptop := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+		_, phone := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+
+		resp := authorized(t, http.MethodPost, "/profile/password", laptop["token"].(string), types.ChangePasswordPayload{CurrentPassword: "password", NewPassword: "new-password"})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.True(t, auth.ComparePasswords(passwordStore.passwords[1], []byte("new-password")))
+
+		resp = authorized(t, http.MethodGet, "/profile", phone["token"].(string), nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should sign the other devices out when asked", func(t *testing.T) {
+		_, laptop := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+		_, phone := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+
+		resp := authorized(t, http.MethodPost, "/profile/password", laptop["token"].(string), types.ChangePasswordPayload{
+			CurrentPassword:      "password",
+			NewPassword:          "new-password",
+			SignOutOtherSessions: true,
+		})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp = authorized(t, http.MethodGet, "/profile", phone["token"].(string), nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		resp, _ = post(t, "/auth/refresh", types.RefreshTokenPayload{RefreshToken: phone["refreshToken"].(string)})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		resp = authorized(t, http.MethodGet, "/profile", laptop["token"].(string), nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, sessionStore.active(1), 1)
+	})
+
+	t.Run("should revoke every token on logout-all", func(t *testing.T) {
+		_, body := post(t, "/login", types.LoginUserPayload{Email: "user@email.com", Password: "password"})
+		token := body["token"].(string)
+
+		resp := authorized(t, http.MethodPost, "/logout-all", token, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp = authorized(t, http.MethodGet, "/profile", token, nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		resp, _ = post(t, "/auth/refresh", types.RefreshTokenPayload{RefreshToken: body["refreshToken"].(string)})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Empty(t, sessionStore.active(1))
+	})
+}
+
+type mockUserStore struct {
+	user       *types.User
+	anonymized bool
+	role       string
+}
+
+func (m *mockUserStore) MarkEmailVerified(userID int, email string) error {
+	if m.user != nil && m.user.ID == userID && m.user.Email == email {
+		m.user.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	return nil
+}
 
 func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	if m.user != nil && m.user.Email == email && !m.anonymized {
+		return m.user, nil
+	}
 	return nil, fmt.Errorf("user not found")
 }
 
 func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
-	return nil, nil
+	if m.user != nil && m.user.ID == id && !m.anonymized {
+		return m.user, nil
+	}
+	return nil, fmt.Errorf("user not found")
 }
 
 func (m *mockUserStore) CreateUser(user types.User) error {
+	if m.user == nil {
+		user.ID = 1
+		m.user = &user
+	}
 	return nil
 }
 
 func (m *mockUserStore) UpdateUser(user types.User) error {
+	if m.user != nil && m.user.ID == user.ID {
+		if m.user.Email != user.Email {
+			m.user.EmailVerifiedAt = sql.NullTime{}
+		}
+		m.user.FirstName, m.user.LastName, m.user.Email = user.FirstName, user.LastName, user.Email
+	}
 	return nil
 }
 
@@ -102,3 +733,309 @@ func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error
   return nil
 }
 
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	m.anonymized = true
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	m.role = role
+	return nil
+}
+
+type mockMailer struct {
+	sent []types.Email
+}
+
+func (m *mockMailer) Send(email types.Email) error {
+	m.sent = append(m.sent, email)
+	return nil
+}
+
+// token returns the token of the link in the last email sent.
+func (m *mockMailer) token(t *testing.T) string {
+	t.Helper()
+
+	if len(m.sent) == 0 {
+		t.Fatal("expected an email to be sent")
+	}
+	_, rest, found := strings.Cut(m.sent[len(m.sent)-1].Text, "?token=")
+	if !found {
+		t.Fatal("expected the email to link to a token")
+	}
+	token, _, _ := strings.Cut(rest, "\n")
+	return token
+}
+
+type mockDataExportStore struct {
+	export *types.DataExport
+	done   chan struct{}
+}
+
+func (m *mockDataExportStore) CreateDataExport(userID int) (*types.DataExport, error) {
+	m.export = &types.DataExport{ID: 1, UserID: userID, Status: types.DataExportPending}
+	return m.export, nil
+}
+
+func (m *mockDataExportStore) GetDataExportByID(id int) (*types.DataExport, error) {
+	if m.export != nil && m.export.ID == id {
+		return m.export, nil
+	}
+	return nil, fmt.Errorf("data export not found")
+}
+
+func (m *mockDataExportStore) CompleteDataExport(id int, filePath string) error {
+	m.export.Status = types.DataExportCompleted
+	m.export.FilePath = sql.NullString{String: filePath, Valid: true}
+	close(m.done)
+	return nil
+}
+
+func (m *mockDataExportStore) FailDataExport(id int, reason string) error {
+	m.export.Status = types.DataExportFailed
+	close(m.done)
+	return nil
+}
+
+func (m *mockDataExportStore) GetConversationsByUserID(userID int) ([]types.Conversation, error) {
+	return []types.Conversation{}, nil
+}
+
+func (m *mockDataExportStore) GetMessagesBySenderID(userID int, fn func(*types.ExportedMessage) error) error {
+	return nil
+}
+
+type mockRefreshTokenStore struct {
+	tokens []*types.RefreshToken
+}
+
+func newMockRefreshTokenStore() *mockRefreshTokenStore {
+	return &mockRefreshTokenStore{}
+}
+
+func (m *mockRefreshTokenStore) CreateRefreshToken(token types.RefreshToken) error {
+	token.ID = len(m.tokens) + 1
+	m.tokens = append(m.tokens, &token)
+	return nil
+}
+
+func (m *mockRefreshTokenStore) GetRefreshTokenByHash(tokenHash string) (*types.RefreshToken, error) {
+	for _, t := range m.tokens {
+		if t.TokenHash == tokenHash {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("refresh token not found")
+}
+
+func (m *mockRefreshTokenStore) UseRefreshToken(id int) (bool, error) {
+	t := m.tokens[id-1]
+	if t.UsedAt.Valid {
+		return false, nil
+	}
+	t.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	return true, nil
+}
+
+func (m *mockRefreshTokenStore) RevokeRefreshTokenFamily(familyID string) error {
+	for _, t := range m.tokens {
+		if t.FamilyID == familyID {
+			t.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (m *mockRefreshTokenStore) RevokeUserRefreshTokens(userID int) error {
+	for _, t := range m.tokens {
+		if t.UserID == userID {
+			t.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+type mockTokenRevoker struct {
+	revokedUsers []int
+}
+
+func (m *mockTokenRevoker) RevokeToken(jti string, userID int, expiresAt time.Time) error {
+	return nil
+}
+
+func (m *mockTokenRevoker) RevokeUserTokens(userID int) error {
+	m.revokedUsers = append(m.revokedUsers, userID)
+	return nil
+}
+
+type mockRevocationStore struct {
+	tokens map[string]bool
+	users  map[int]time.Time
+}
+
+func newMockRevocationStore() *mockRevocationStore {
+	return &mockRevocationStore{tokens: map[string]bool{}, users: map[int]time.Time{}}
+}
+
+func (m *mockRevocationStore) RevokeToken(jti string, userID int, expiresAt time.Time) error {
+	m.tokens[jti] = true
+	return nil
+}
+
+func (m *mockRevocationStore) IsTokenRevoked(jti string) (bool, error) {
+	return m.tokens[jti], nil
+}
+
+func (m *mockRevocationStore) RevokeUserTokens(userID int, issuedBefore, expiresAt time.Time) error {
+	m.users[userID] = issuedBefore
+	return nil
+}
+
+func (m *mockRevocationStore) GetUserTokensRevokedBefore(userID int) (time.Time, error) {
+	return m.users[userID], nil
+}
+
+func (m *mockRevocationStore) DeleteExpiredRevocations(now time.Time) (int64, error) {
+	return 0, nil
+}
+
+type mockSessionRevoker struct{}
+
+func (m *mockSessionRevoker) RevokeSession(id string) error {
+	return nil
+}
+
+func (m *mockSessionRevoker) RevokeUserSessions(userID int) error {
+	return nil
+}
+
+type mockSessionStore struct {
+	sessions []*types.Session
+}
+
+func newMockSessionStore() *mockSessionStore {
+	return &mockSessionStore{}
+}
+
+func (m *mockSessionStore) CreateSession(session types.Session) error {
+	m.sessions = append(m.sessions, &session)
+	return nil
+}
+
+func (m *mockSessionStore) GetSessionByID(id string) (*types.Session, error) {
+	for _, session := range m.sessions {
+		if session.ID == id {
+			copied := *session
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("session not found")
+}
+
+func (m *mockSessionStore) GetUserSessions(userID int, activeSince time.Time) ([]types.Session, error) {
+	sessions := []types.Session{}
+	for _, session := range m.active(userID) {
+		if !session.LastActiveAt.Before(activeSince) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *mockSessionStore) TouchSession(id string, lastActiveAt time.Time, ip string) error {
+	for _, session := range m.sessions {
+		if session.ID == id {
+			session.LastActiveAt, session.IP = lastActiveAt, ip
+		}
+	}
+	return nil
+}
+
+func (m *mockSessionStore) RevokeSession(id string) error {
+	for _, session := range m.sessions {
+		if session.ID == id {
+			session.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (m *mockSessionStore) RevokeUserSessions(userID int) error {
+	for _, session := range m.sessions {
+		if session.UserID == userID {
+			session.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (m *mockSessionStore) DeleteStaleSessions(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockSessionStore) active(userID int) []types.Session {
+	sessions := []types.Session{}
+	for _, session := range m.sessions {
+		if session.UserID == userID && !session.RevokedAt.Valid {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions
+}
+
+type mockPasswordStore struct {
+	passwords map[int]string
+	tokens    []*types.PasswordResetToken
+}
+
+func newMockPasswordStore() *mockPasswordStore {
+	return &mockPasswordStore{passwords: map[int]string{}}
+}
+
+func (m *mockPasswordStore) UpdateUserPassword(userID int, hashedPassword string) error {
+	m.passwords[userID] = hashedPassword
+	return nil
+}
+
+func (m *mockPasswordStore) CreatePasswordResetToken(token types.PasswordResetToken) error {
+	token.ID = len(m.tokens) + 1
+	m.tokens = append(m.tokens, &token)
+	return nil
+}
+
+func (m *mockPasswordStore) GetPasswordResetTokenByHash(tokenHash string) (*types.PasswordResetToken, error) {
+	for _, t := range m.tokens {
+		if t.TokenHash == tokenHash {
+			copied := *t
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("password reset token not found")
+}
+
+func (m *mockPasswordStore) UsePasswordResetToken(id int) (bool, error) {
+	for _, t := range m.tokens {
+		if t.ID == id && !t.UsedAt.Valid {
+			t.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockPasswordStore) InvalidateUserPasswordResetTokens(userID int) error {
+	for _, t := range m.tokens {
+		if t.UserID == userID && !t.UsedAt.Valid {
+			t.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (m *mockPasswordStore) DeleteExpiredPasswordResetTokens(now time.Time) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,102 @@
+package user
+
+import (
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxDeviceNameLength = 100
+	maxUserAgentLength  = 512
+)
+
+// List the devices the user is logged in on
+func (h *Handler) handleGetSessions(c *fiber.Ctx) error {
+	claims := auth.GetClaimsFromContext(c)
+
+	// a session unused for as long as a refresh token lasts is logged out
+	activeSince := time.Now().Add(-time.Second * time.Duration(config.Envs.RefreshTokenExpInSeconds))
+	sessions, err := h.sessionStore.GetUserSessions(claims.UserID, activeSince)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+
+	return c.Status(fiber.StatusOK).JSON(sessions)
+}
+
+// Sign out one of the devices of the user
+func (h *Handler) handleDeleteSession(c *fiber.Ctx) error {
+	claims := auth.GetClaimsFromContext(c)
+
+	session, err := h.sessionStore.GetSessionByID(c.Params("id"))
+	if err != nil || session.UserID != claims.UserID || session.RevokedAt.Valid {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "session not found",
+		})
+	}
+
+	if err := h.revokeSession(session.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if session.ID == claims.SessionID {
+		clearTokenCookie(c)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "session deleted",
+	})
+}
+
+// newSession records a login from the device making the request.
+func (h *Handler) newSession(c *fiber.Ctx, userID int, deviceName string) (*types.Session, error) {
+	id, err := utils.RandomString(12)
+	if err != nil {
+		return nil, err
+	}
+
+	session := types.Session{
+		ID:           id,
+		UserID:       userID,
+		DeviceName:   truncate(deviceName, maxDeviceNameLength),
+		UserAgent:    truncate(c.Get(fiber.HeaderUserAgent), maxUserAgentLength),
+		IP:           c.IP(),
+		LastActiveAt: time.Now(),
+	}
+	if err := h.sessionStore.CreateSession(session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// revokeSession signs the session out along with its refresh tokens, which
+// share its id.
+func (h *Handler) revokeSession(id string) error {
+	if err := h.sessions.RevokeSession(id); err != nil {
+		return err
+	}
+
+	return h.refreshStore.RevokeRefreshTokenFamily(id)
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
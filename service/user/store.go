@@ -3,6 +3,7 @@ package user
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/dclouisDan/chat-app-api/types"
 )
@@ -16,7 +17,7 @@ func NewStore(db *sql.DB) *Store {
 }
 
 func (s *Store) GetUserByEmail(email string) (*types.User, error) {
-	rows, err := s.db.Query("SELECT * FROM users WHERE email = ?", email)
+	rows, err := s.db.Query("SELECT * FROM users WHERE email = ? AND deletedAt IS NULL", email)
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +38,7 @@ func (s *Store) GetUserByEmail(email string) (*types.User, error) {
 }
 
 func (s *Store) GetUserByID(userID int) (*types.User, error) {
-	rows, err := s.db.Query("SELECT * FROM users WHERE id = ?", userID)
+	rows, err := s.db.Query("SELECT * FROM users WHERE id = ? AND deletedAt IS NULL", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -74,13 +75,564 @@ func (s *Store) UpdateUserProfilePicture(userID int, path string) error {
 }
 
 func (s *Store) UpdateUser(user types.User) error {
-	_, err := s.db.Exec("UPDATE users SET firstname = ?, lastName = ?, email = ? WHERE id = ?;", user.FirstName, user.LastName, user.Email, user.ID)
+	// a new address has to be verified again, the check comes before the
+	// address is replaced as MySQL assigns from left to right
+	_, err := s.db.Exec(
+		"UPDATE users SET emailVerifiedAt = IF(email = ?, emailVerifiedAt, NULL), firstname = ?, lastName = ?, email = ? WHERE id = ?;",
+		user.Email, user.FirstName, user.LastName, user.Email, user.ID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) MarkEmailVerified(userID int, email string) error {
+	_, err := s.db.Exec(
+		"UPDATE users SET emailVerifiedAt = CURRENT_TIMESTAMP WHERE id = ? AND email = ? AND emailVerifiedAt IS NULL;",
+		userID, email,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) UpdateUserPassword(userID int, hashedPassword string) error {
+	_, err := s.db.Exec("UPDATE users SET password = ? WHERE id = ?;", hashedPassword, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) CreatePasswordResetToken(token types.PasswordResetToken) error {
+	_, err := s.db.Exec(
+		"INSERT INTO password_reset_tokens (user_id, tokenHash, expiresAt) VALUES (?, ?, ?)",
+		token.UserID, token.TokenHash, token.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) GetPasswordResetTokenByHash(tokenHash string) (*types.PasswordResetToken, error) {
+	rows, err := s.db.Query("SELECT * FROM password_reset_tokens WHERE tokenHash = ?", tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	t := new(types.PasswordResetToken)
+	for rows.Next() {
+		t, err = scanRowIntoPasswordResetToken(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if t.ID == 0 {
+		return nil, fmt.Errorf("Password reset token not found.")
+	}
+
+	return t, nil
+}
+
+func (s *Store) UsePasswordResetToken(id int) (bool, error) {
+	// only one of two concurrent resets with the same token gets through
+	res, err := s.db.Exec("UPDATE password_reset_tokens SET usedAt = CURRENT_TIMESTAMP WHERE id = ? AND usedAt IS NULL;", id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (s *Store) InvalidateUserPasswordResetTokens(userID int) error {
+	_, err := s.db.Exec("UPDATE password_reset_tokens SET usedAt = CURRENT_TIMESTAMP WHERE user_id = ? AND usedAt IS NULL;", userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) DeleteExpiredPasswordResetTokens(now time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM password_reset_tokens WHERE expiresAt <= ?;", now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// AnonymizeUser scrubs the personal data of an account while keeping the row,
+// so messages the user sent stay attributed to "Deleted user".
+func (s *Store) AnonymizeUser(userID int) error {
+	_, err := s.db.Exec(
+		`UPDATE users SET firstName = 'Deleted', lastName = 'user',
+		email = CONCAT('deleted-', id, '@deleted.invalid'), password = '',
+		profilePicture = NULL, deletedAt = CURRENT_TIMESTAMP
+		WHERE id = ? AND deletedAt IS NULL;`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) SuspendUser(userID int) error {
+	_, err := s.db.Exec("UPDATE users SET suspendedAt = CURRENT_TIMESTAMP WHERE id = ? AND suspendedAt IS NULL;", userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) UpdateUserRole(userID int, role string) error {
+	_, err := s.db.Exec("UPDATE users SET role = ? WHERE id = ?;", role, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) CreateRefreshToken(token types.RefreshToken) error {
+	_, err := s.db.Exec(
+		"INSERT INTO refresh_tokens (user_id, familyId, tokenHash, expiresAt) VALUES (?, ?, ?, ?)",
+		token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) GetRefreshTokenByHash(tokenHash string) (*types.RefreshToken, error) {
+	rows, err := s.db.Query("SELECT * FROM refresh_tokens WHERE tokenHash = ?", tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	t := new(types.RefreshToken)
+	for rows.Next() {
+		t, err = scanRowIntoRefreshToken(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if t.ID == 0 {
+		return nil, fmt.Errorf("Refresh token not found.")
+	}
+
+	return t, nil
+}
+
+func (s *Store) UseRefreshToken(id int) (bool, error) {
+	// only one of two concurrent refreshes with the same token gets through
+	res, err := s.db.Exec("UPDATE refresh_tokens SET usedAt = CURRENT_TIMESTAMP WHERE id = ? AND usedAt IS NULL;", id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (s *Store) RevokeRefreshTokenFamily(familyID string) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revokedAt = CURRENT_TIMESTAMP WHERE familyId = ? AND revokedAt IS NULL;", familyID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) RevokeUserRefreshTokens(userID int) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revokedAt = CURRENT_TIMESTAMP WHERE user_id = ? AND revokedAt IS NULL;", userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) RevokeToken(jti string, userID int, expiresAt time.Time) error {
+	_, err := s.db.Exec("INSERT IGNORE INTO revoked_tokens (jti, user_id, expiresAt) VALUES (?, ?, ?)", jti, userID, expiresAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) IsTokenRevoked(jti string) (bool, error) {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?", jti).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *Store) RevokeUserTokens(userID int, issuedBefore, expiresAt time.Time) error {
+	_, err := s.db.Exec(
+		`INSERT INTO user_token_revocations (user_id, revokedBefore, expiresAt) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE revokedBefore = VALUES(revokedBefore), expiresAt = VALUES(expiresAt)`,
+		userID, issuedBefore, expiresAt,
+	)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (s *Store) GetUserTokensRevokedBefore(userID int) (time.Time, error) {
+	var revokedBefore time.Time
+	err := s.db.QueryRow("SELECT revokedBefore FROM user_token_revocations WHERE user_id = ?", userID).Scan(&revokedBefore)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return revokedBefore, nil
+}
+
+func (s *Store) DeleteExpiredRevocations(now time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM revoked_tokens WHERE expiresAt <= ?;", now)
+	if err != nil {
+		return 0, err
+	}
+	tokens, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err = s.db.Exec("DELETE FROM user_token_revocations WHERE expiresAt <= ?;", now)
+	if err != nil {
+		return tokens, err
+	}
+	users, err := res.RowsAffected()
+	if err != nil {
+		return tokens, err
+	}
+
+	return tokens + users, nil
+}
+
+func (s *Store) CreateDataExport(userID int) (*types.DataExport, error) {
+	res, err := s.db.Exec("INSERT INTO data_exports (user_id) VALUES (?)", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetDataExportByID(int(id))
+}
+
+func (s *Store) GetDataExportByID(id int) (*types.DataExport, error) {
+	rows, err := s.db.Query("SELECT * FROM data_exports WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	e := new(types.DataExport)
+	for rows.Next() {
+		e, err = scanRowIntoDataExport(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.ID == 0 {
+		return nil, fmt.Errorf("Data export not found.")
+	}
+
+	return e, nil
+}
+
+func (s *Store) CompleteDataExport(id int, filePath string) error {
+	_, err := s.db.Exec("UPDATE data_exports SET status = ?, filePath = ?, completedAt = CURRENT_TIMESTAMP WHERE id = ?;", types.DataExportCompleted, filePath, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) FailDataExport(id int, reason string) error {
+	_, err := s.db.Exec("UPDATE data_exports SET status = ?, error = ?, completedAt = CURRENT_TIMESTAMP WHERE id = ?;", types.DataExportFailed, reason, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) GetConversationsByUserID(userID int) ([]types.Conversation, error) {
+	rows, err := s.db.Query(
+		`SELECT c.id, c.name, c.createdAt FROM conversations c
+		JOIN conversation_participants p ON p.conversation_id = c.id
+		WHERE p.user_id = ? ORDER BY c.id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []types.Conversation{}
+	for rows.Next() {
+		var c types.Conversation
+		if err := rows.Scan(&c.ID, &c.Name, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+
+	return conversations, nil
+}
+
+// GetMessagesBySenderID streams every message the user sent, across all
+// conversations, one row at a time.
+func (s *Store) GetMessagesBySenderID(userID int, fn func(*types.ExportedMessage) error) error {
+	rows, err := s.db.Query(
+		`SELECT m.id, m.conversation_id, m.content, m.sentAt, m.editedAt, a.fileName, a.path
+		FROM messages m
+		LEFT JOIN message_attachments a ON a.message_id = m.id
+		WHERE m.sender_id = ? AND m.deletedAt IS NULL
+		ORDER BY m.id, a.id`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var current *types.ExportedMessage
+	for rows.Next() {
+		var (
+			m        types.ExportedMessage
+			editedAt sql.NullTime
+			fileName sql.NullString
+			path     sql.NullString
+		)
+
+		err := rows.Scan(&m.ID, &m.ConversationID, &m.Content, &m.SentAt, &editedAt, &fileName, &path)
+		if err != nil {
+			return err
+		}
+
+		if current == nil || current.ID != m.ID {
+			if current != nil {
+				if err := fn(current); err != nil {
+					return err
+				}
+			}
+
+			m.SenderID = userID
+			if editedAt.Valid {
+				m.EditedAt = &editedAt.Time
+			}
+			m.Attachments = []types.ExportedAttachment{}
+			current = &m
+		}
+
+		if path.Valid {
+			current.Attachments = append(current.Attachments, types.ExportedAttachment{
+				FileName: fileName.String,
+				URL:      path.String,
+			})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if current != nil {
+		return fn(current)
+	}
+
+	return nil
+}
+
+func scanRowIntoDataExport(rows *sql.Rows) (*types.DataExport, error) {
+	e := new(types.DataExport)
+
+	err := rows.Scan(
+		&e.ID,
+		&e.UserID,
+		&e.Status,
+		&e.FilePath,
+		&e.Error,
+		&e.CreatedAt,
+		&e.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (s *Store) CreateSession(session types.Session) error {
+	_, err := s.db.Exec(
+		"INSERT INTO sessions (id, user_id, deviceName, userAgent, ip, lastActiveAt) VALUES (?, ?, ?, ?, ?, ?)",
+		session.ID, session.UserID, session.DeviceName, session.UserAgent, session.IP, session.LastActiveAt,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) GetSessionByID(id string) (*types.Session, error) {
+	rows, err := s.db.Query("SELECT * FROM sessions WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	session := new(types.Session)
+	for rows.Next() {
+		session, err = scanRowIntoSession(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if session.ID == "" {
+		return nil, fmt.Errorf("Session not found.")
+	}
+
+	return session, nil
+}
+
+func (s *Store) GetUserSessions(userID int, activeSince time.Time) ([]types.Session, error) {
+	rows, err := s.db.Query(
+		"SELECT * FROM sessions WHERE user_id = ? AND revokedAt IS NULL AND lastActiveAt >= ? ORDER BY lastActiveAt DESC",
+		userID, activeSince,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []types.Session{}
+	for rows.Next() {
+		session, err := scanRowIntoSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *Store) TouchSession(id string, lastActiveAt time.Time, ip string) error {
+	_, err := s.db.Exec("UPDATE sessions SET lastActiveAt = ?, ip = ? WHERE id = ?;", lastActiveAt, ip, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) RevokeSession(id string) error {
+	_, err := s.db.Exec("UPDATE sessions SET revokedAt = CURRENT_TIMESTAMP WHERE id = ? AND revokedAt IS NULL;", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) RevokeUserSessions(userID int) error {
+	_, err := s.db.Exec("UPDATE sessions SET revokedAt = CURRENT_TIMESTAMP WHERE user_id = ? AND revokedAt IS NULL;", userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) DeleteStaleSessions(before time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM sessions WHERE revokedAt < ? OR lastActiveAt < ?;", before, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanRowIntoRefreshToken(rows *sql.Rows) (*types.RefreshToken, error) {
+	t := new(types.RefreshToken)
+
+	err := rows.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.FamilyID,
+		&t.TokenHash,
+		&t.ExpiresAt,
+		&t.UsedAt,
+		&t.RevokedAt,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func scanRowIntoPasswordResetToken(rows *sql.Rows) (*types.PasswordResetToken, error) {
+	t := new(types.PasswordResetToken)
+
+	err := rows.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.TokenHash,
+		&t.ExpiresAt,
+		&t.UsedAt,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func scanRowIntoSession(rows *sql.Rows) (*types.Session, error) {
+	session := new(types.Session)
+
+	err := rows.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.DeviceName,
+		&session.UserAgent,
+		&session.IP,
+		&session.LastActiveAt,
+		&session.CreatedAt,
+		&session.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
 func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 	user := new(types.User)
 
@@ -92,6 +644,10 @@ func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 		&user.Password,
 		&user.ProfilePicture,
 		&user.CreatedAt,
+		&user.DeletedAt,
+		&user.SuspendedAt,
+		&user.Role,
+		&user.EmailVerifiedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,253 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Exchange a refresh token for a new access token and a new refresh token,
+// the old refresh token can not be used again
+func (h *Handler) handleRefreshToken(c *fiber.Ctx) error {
+	var payload types.RefreshTokenPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	stored, err := h.refreshStore.GetRefreshTokenByHash(hashToken(payload.RefreshToken))
+	if err != nil || stored.RevokedAt.Valid || time.Now().After(stored.ExpiresAt) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid refresh token",
+		})
+	}
+
+	used, err := h.refreshStore.UseRefreshToken(stored.ID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// a token that was already exchanged is presented again, the legitimate
+	// client and a thief can not be told apart so the whole login goes
+	if !used {
+		log.Printf("refresh token %d of user %d reused, revoking family %s", stored.ID, stored.UserID, stored.FamilyID)
+		if err := h.refreshStore.RevokeRefreshTokenFamily(stored.FamilyID); err != nil {
+			log.Printf("failed to revoke refresh token family %s: %v", stored.FamilyID, err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "refresh token reused, please log in again",
+		})
+	}
+
+	u, err := h.store.GetUserByID(stored.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid refresh token",
+		})
+	}
+
+	if u.SuspendedAt.Valid {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "account suspended",
+		})
+	}
+
+	if !u.EmailVerifiedAt.Valid && auth.VerificationRequired(auth.VerifyBeforeLogin) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "email not verified",
+		})
+	}
+
+	// logins from before sessions existed get one on their next refresh
+	session, err := h.sessionStore.GetSessionByID(stored.FamilyID)
+	if err != nil {
+		session = &types.Session{
+			ID:           stored.FamilyID,
+			UserID:       u.ID,
+			UserAgent:    truncate(c.Get(fiber.HeaderUserAgent), maxUserAgentLength),
+			IP:           c.IP(),
+			LastActiveAt: time.Now(),
+		}
+		if err := h.sessionStore.CreateSession(*session); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	} else if session.RevokedAt.Valid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid refresh token",
+		})
+	} else if err := h.sessionStore.TouchSession(session.ID, time.Now(), c.IP()); err != nil {
+		log.Printf("failed to record the activity of session %s: %v", session.ID, err)
+	}
+
+	return h.issueTokens(c, u, session.ID)
+}
+
+// Sign out the current device, the refresh token it holds can be revoked
+// along with the access token
+func (h *Handler) handleLogout(c *fiber.Ctx) error {
+	var payload types.LogoutPayload
+
+	// parse payload, there is none when only the access token goes
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&payload); err != nil {
+			log.Printf("Parse error: %s", err.Error())
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	claims := auth.GetClaimsFromContext(c)
+
+	if claims.SessionID != "" {
+		if err := h.revokeSession(claims.SessionID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	// tokens issued before they had an id can only go with logout-all
+	if claims.ID != "" {
+		if err := h.revoker.RevokeToken(claims.ID, claims.UserID, claims.ExpiresAt); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	if payload.RefreshToken != "" {
+		stored, err := h.refreshStore.GetRefreshTokenByHash(hashToken(payload.RefreshToken))
+		if err == nil && stored.UserID == claims.UserID {
+			if err := h.refreshStore.RevokeRefreshTokenFamily(stored.FamilyID); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+		}
+	}
+
+	clearTokenCookie(c)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "logged out",
+	})
+}
+
+// Sign out every device of the user
+func (h *Handler) handleLogoutAll(c *fiber.Ctx) error {
+	if err := h.SignOutEverywhere(auth.GetIDFromContext(c)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	clearTokenCookie(c)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "logged out of every device",
+	})
+}
+
+// SignOutEverywhere revokes the access tokens, the refresh tokens and the
+// sessions of the user.
+func (h *Handler) SignOutEverywhere(userID int) error {
+	if err := h.revoker.RevokeUserTokens(userID); err != nil {
+		return err
+	}
+
+	if err := h.refreshStore.RevokeUserRefreshTokens(userID); err != nil {
+		return err
+	}
+
+	return h.sessions.RevokeUserSessions(userID)
+}
+
+// issueTokens responds with a new access token for the session and a refresh
+// token of the family with the id of the session.
+func (h *Handler) issueTokens(c *fiber.Ctx, u *types.User, sessionID string) error {
+	secret := []byte(config.Envs.JWTSecret)
+	token, expireAt, err := auth.CreateJWT(secret, u.ID, u.Role, sessionID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	refreshToken, err := utils.RandomString(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	refreshExpireAt := time.Now().Add(time.Second * time.Duration(config.Envs.RefreshTokenExpInSeconds))
+	err = h.refreshStore.CreateRefreshToken(types.RefreshToken{
+		UserID:    u.ID,
+		FamilyID:  sessionID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: refreshExpireAt,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "token",
+		Value:    token,
+		Expires:  time.Unix(expireAt, 0),
+		HTTPOnly: true,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"token":                 token,
+		"expiresAt":             expireAt,
+		"refreshToken":          refreshToken,
+		"refreshTokenExpiresAt": refreshExpireAt.Unix(),
+	})
+}
+
+// clearTokenCookie removes the cookie set on login, browsers drop cookies
+// that expired.
+func clearTokenCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "token",
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+	})
+}
+
+// refresh tokens are stored hashed so a leaked database does not leak
+// working tokens
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
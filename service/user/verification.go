@@ -0,0 +1,113 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+const verificationTokenTTL = 48 * time.Hour
+
+// Verify the email address of a user with the token emailed to them
+func (h *Handler) handleVerifyEmail(c *fiber.Ctx) error {
+	var payload types.VerifyEmailPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	userID, email, err := auth.ParseEmailToken(auth.PurposeVerifyEmail, payload.Token)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid or expired verification token",
+		})
+	}
+
+	// the token was sent to an address the user no longer has
+	u, err := h.store.GetUserByID(userID)
+	if err != nil || u.Email != email {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid or expired verification token",
+		})
+	}
+
+	if err := h.verificationStore.MarkEmailVerified(u.ID, u.Email); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "email verified",
+	})
+}
+
+// Send the verification email again. The answer is the same whether the
+// address belongs to an account or not, so that it can not be used to find
+// out who signed up
+func (h *Handler) handleResendVerification(c *fiber.Ctx) error {
+	var payload types.ResendVerificationPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	// fiber reuses the request buffer the payload may point into
+	email := strings.Clone(payload.Email)
+	h.sendInBackground(func() {
+		u, err := h.store.GetUserByEmail(email)
+		if err == nil && !u.EmailVerifiedAt.Valid {
+			h.sendVerificationEmail(u)
+		}
+	})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "a verification email was sent if the address belongs to an account that is not verified yet",
+	})
+}
+
+// sendVerificationEmail emails the user a link to verify their current
+// address. A failure is only logged, the user can ask for another email.
+func (h *Handler) sendVerificationEmail(u *types.User) {
+	token, err := auth.CreateEmailToken(auth.PurposeVerifyEmail, u.ID, u.Email, verificationTokenTTL)
+	if err != nil {
+		log.Printf("failed to create the verification token of user %d: %v", u.ID, err)
+		return
+	}
+
+	err = h.sendEmail(u, "verify-email", "Verify your email address", "/verify-email", token, verificationTokenTTL)
+	if err != nil {
+		log.Printf("failed to send the verification email of user %d: %v", u.ID, err)
+	}
+}
@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+
+	"github.com/dclouisDan/chat-app-api/config"
+)
+
+// checkURL resolves the host of a webhook url and makes sure every address
+// it points to is public, so that conversation admins cannot have the server
+// call its own network or the metadata service of its cloud provider.
+func checkURL(ctx context.Context, rawURL string) error {
+	if config.Envs.AllowPrivateWebhooks {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("webhook url must be http or https")
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host: %w", err)
+	}
+	for _, addr := range addrs {
+		if !isPublic(addr.IP) {
+			return fmt.Errorf("webhook url must point to a public address")
+		}
+	}
+
+	return nil
+}
+
+// checkDial runs on the address a delivery is about to connect to, after
+// resolution. The host may resolve to another address than when the webhook
+// was registered, or the receiver may redirect somewhere else.
+func checkDial(network, address string, _ syscall.RawConn) error {
+	if config.Envs.AllowPrivateWebhooks {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+		return fmt.Errorf("refusing to deliver to non-public address %s", host)
+	}
+
+	return nil
+}
+
+func isPublic(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast()
+}
@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBaseDelay   = 2 * time.Second
+	requestTimeout     = 10 * time.Second
+)
+
+// Dispatcher delivers events to the webhooks of a conversation. Every
+// delivery runs in its own goroutine and is retried with exponential
+// backoff, a delivery that keeps failing ends up in the dead letters.
+type Dispatcher struct {
+	store       types.WebhookStore
+	client      *http.Client
+	maxAttempts int
+	baseDelay   time.Duration
+	wg          sync.WaitGroup
+}
+
+func NewDispatcher(store types.WebhookStore) *Dispatcher {
+	// deliveries connect straight to the receiver, a proxy would hide the
+	// address from checkDial
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{Timeout: requestTimeout, Control: checkDial}).DialContext
+
+	return &Dispatcher{
+		store:       store,
+		client:      &http.Client{Timeout: requestTimeout, Transport: transport},
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+	}
+}
+
+type eventPayload struct {
+	Event          string    `json:"event"`
+	ConversationID int       `json:"conversationId"`
+	OccurredAt     time.Time `json:"occurredAt"`
+	Data           any       `json:"data"`
+}
+
+func (d *Dispatcher) Dispatch(conversationID int, event string, data any) {
+	webhooks, err := d.store.GetActiveWebhooksForEvent(conversationID, event)
+	if err != nil {
+		log.Printf("failed to get webhooks of conversation %d: %v", conversationID, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(eventPayload{
+		Event:          event,
+		ConversationID: conversationID,
+		OccurredAt:     time.Now().UTC(),
+		Data:           data,
+	})
+	if err != nil {
+		log.Printf("failed to encode %s webhook payload: %v", event, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		delivery, err := d.store.CreateWebhookDelivery(types.WebhookDelivery{
+			WebhookID: webhook.ID,
+			Event:     event,
+			Payload:   string(body),
+		})
+		if err != nil {
+			log.Printf("failed to create delivery for webhook %d: %v", webhook.ID, err)
+			continue
+		}
+
+		d.wg.Add(1)
+		go func(webhook types.Webhook, delivery *types.WebhookDelivery) {
+			defer d.wg.Done()
+			d.deliver(webhook, delivery)
+		}(webhook, delivery)
+	}
+}
+
+// Wait blocks until every delivery in flight is done.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) deliver(webhook types.Webhook, delivery *types.WebhookDelivery) {
+	status := types.WebhookDeliveryDead
+
+	attempt := 1
+	for ; attempt <= d.maxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(d.baseDelay << (attempt - 2))
+		}
+
+		record := d.send(webhook, delivery)
+		record.DeliveryID = delivery.ID
+		record.Attempt = attempt
+		if err := d.store.RecordWebhookAttempt(record); err != nil {
+			log.Printf("failed to record attempt %d of delivery %d: %v", attempt, delivery.ID, err)
+		}
+
+		if !record.Error.Valid {
+			status = types.WebhookDeliverySucceeded
+			break
+		}
+	}
+
+	if attempt > d.maxAttempts {
+		attempt = d.maxAttempts
+	}
+
+	if err := d.store.UpdateWebhookDeliveryStatus(delivery.ID, status, attempt); err != nil {
+		log.Printf("failed to update status of delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send makes a single delivery attempt. Any response outside of the 2xx
+// range counts as a failure.
+func (d *Dispatcher) send(webhook types.Webhook, delivery *types.WebhookDelivery) types.WebhookAttempt {
+	var record types.WebhookAttempt
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		record.Error = sql.NullString{String: err.Error(), Valid: true}
+		return record
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "chat-app-webhooks")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-Webhook-Signature", Sign(webhook.Secret, []byte(delivery.Payload)))
+
+	start := time.Now()
+	res, err := d.client.Do(req)
+	record.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		record.Error = sql.NullString{String: err.Error(), Valid: true}
+		return record
+	}
+	res.Body.Close()
+
+	record.StatusCode = sql.NullInt64{Int64: int64(res.StatusCode), Valid: true}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		record.Error = sql.NullString{String: fmt.Sprintf("unexpected status %d", res.StatusCode), Valid: true}
+	}
+
+	return record
+}
+
+// Sign computes the value of the X-Webhook-Signature header, receivers
+// recompute it over the raw request body with the secret they were given.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
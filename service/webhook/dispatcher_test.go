@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatcher(t *testing.T) {
+	newDispatcher := func(store types.WebhookStore) *Dispatcher {
+		d := NewDispatcher(store)
+		d.maxAttempts = 3
+		d.baseDelay = time.Millisecond
+		return d
+	}
+
+	// the receivers listen on the loopback
+	config.Envs.AllowPrivateWebhooks = true
+	defer func() { config.Envs.AllowPrivateWebhooks = false }()
+
+	t.Run("should deliver a signed payload", func(t *testing.T) {
+		var (
+			received  map[string]any
+			signature string
+			event     string
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &received)
+			event = r.Header.Get("X-Webhook-Event")
+			if r.Header.Get("X-Webhook-Signature") == Sign("s3cret", body) {
+				signature = "valid"
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		store := newMockWebhookStore()
+		store.CreateWebhook(types.Webhook{ConversationID: 1, URL: server.URL, Secret: "s3cret", Events: []string{types.WebhookEventMessageCreated}})
+
+		d := newDispatcher(store)
+		d.Dispatch(1, types.WebhookEventMessageCreated, map[string]any{"content": "build passed"})
+		d.Wait()
+
+		assert.Equal(t, "valid", signature)
+		assert.Equal(t, types.WebhookEventMessageCreated, event)
+		assert.Equal(t, float64(1), received["conversationId"])
+		assert.Equal(t, "build passed", received["data"].(map[string]any)["content"])
+		assert.Equal(t, types.WebhookDeliverySucceeded, store.deliveries[1].Status)
+		assert.Len(t, store.deliveries[1].History, 1)
+	})
+
+	t.Run("should skip webhooks not subscribed to the event", func(t *testing.T) {
+		store := newMockWebhookStore()
+		store.CreateWebhook(types.Webhook{ConversationID: 1, URL: "http://127.0.0.1:1", Events: []string{types.WebhookEventMemberJoined}})
+
+		d := newDispatcher(store)
+		d.Dispatch(1, types.WebhookEventMessageCreated, nil)
+		d.Wait()
+
+		assert.Empty(t, store.deliveries)
+	})
+
+	t.Run("should retry until the receiver recovers", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		store := newMockWebhookStore()
+		store.CreateWebhook(types.Webhook{ConversationID: 1, URL: server.URL, Events: []string{types.WebhookEventMessageDeleted}})
+
+		d := newDispatcher(store)
+		d.Dispatch(1, types.WebhookEventMessageDeleted, nil)
+		d.Wait()
+
+		delivery := store.deliveries[1]
+		assert.Equal(t, types.WebhookDeliverySucceeded, delivery.Status)
+		assert.Equal(t, 3, delivery.Attempts)
+		assert.Equal(t, int64(http.StatusServiceUnavailable), delivery.History[0].StatusCode.Int64)
+		assert.False(t, delivery.History[2].Error.Valid)
+	})
+
+	t.Run("should dead-letter a delivery that keeps failing", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		store := newMockWebhookStore()
+		store.CreateWebhook(types.Webhook{ConversationID: 1, URL: server.URL, Events: []string{types.WebhookEventMemberLeft}})
+
+		d := newDispatcher(store)
+		d.Dispatch(1, types.WebhookEventMemberLeft, nil)
+		d.Wait()
+
+		dead, _ := store.GetDeadWebhookDeliveries(1)
+		assert.Len(t, dead, 1)
+		assert.Equal(t, 3, dead[0].Attempts)
+		assert.Len(t, dead[0].History, 3)
+		assert.Equal(t, "unexpected status 500", dead[0].History[2].Error.String)
+	})
+
+	t.Run("should refuse to deliver to a private address", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+		}))
+		defer server.Close()
+
+		config.Envs.AllowPrivateWebhooks = false
+		defer func() { config.Envs.AllowPrivateWebhooks = true }()
+
+		store := newMockWebhookStore()
+		store.CreateWebhook(types.Webhook{ConversationID: 1, URL: server.URL, Events: []string{types.WebhookEventMessageCreated}})
+
+		d := newDispatcher(store)
+		d.Dispatch(1, types.WebhookEventMessageCreated, nil)
+		d.Wait()
+
+		assert.Zero(t, calls.Load())
+		assert.Equal(t, types.WebhookDeliveryDead, store.deliveries[1].Status)
+		assert.Contains(t, store.deliveries[1].History[0].Error.String, "non-public address")
+	})
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/service/ratelimit"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Create an incoming webhook, its token is only shown once
+func (h *Handler) handleCreateIncomingWebhook(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	var payload types.CreateIncomingWebhookPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	token, err := utils.RandomString(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	hook, err := h.incomingStore.CreateIncomingWebhook(types.IncomingWebhook{
+		ConversationID: conversationID,
+		CreatedBy:      auth.GetIDFromContext(c),
+		Name:           payload.Name,
+		AvatarURL:      sql.NullString{String: payload.AvatarURL, Valid: payload.AvatarURL != ""},
+		TokenHash:      hashToken(token),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"incomingWebhook": hook,
+		"token":           token,
+		"url":             fmt.Sprintf("%s:%s/chat-app-api/v1/hooks/%s", config.Envs.PublicHost, config.Envs.Port, token),
+	})
+}
+
+// List the incoming webhooks of a conversation that were not revoked
+func (h *Handler) handleListIncomingWebhooks(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	hooks, err := h.incomingStore.GetIncomingWebhooksByConversationID(conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(hooks)
+}
+
+// Revoke an incoming webhook, its token stops working right away
+func (h *Handler) handleRevokeIncomingWebhook(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	hookID, err := c.ParamsInt("hookID")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid incoming webhook id",
+		})
+	}
+
+	hook, err := h.incomingStore.GetIncomingWebhookByID(hookID)
+	if err != nil || hook.ConversationID != conversationID || hook.RevokedAt.Valid {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "incoming webhook not found",
+		})
+	}
+
+	if err := h.incomingStore.RevokeIncomingWebhook(hook.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "incoming webhook revoked",
+	})
+}
+
+// Post a message as the bot of an incoming webhook, the token in the URL is
+// the only credential
+func (h *Handler) handlePostIncomingWebhook(c *fiber.Ctx) error {
+	hook, err := h.incomingStore.GetIncomingWebhookByTokenHash(hashToken(c.Params("token")))
+	if err != nil || hook.RevokedAt.Valid {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "incoming webhook not found",
+		})
+	}
+
+	if ok, retryAfter := h.limiter.Allow("hook:" + strconv.Itoa(hook.ID)); !ok {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(ratelimit.RetryAfterSeconds(retryAfter)))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "rate limit exceeded",
+		})
+	}
+
+	var payload types.IncomingWebhookMessagePayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	message := types.Message{
+		ConversationID:    hook.ConversationID,
+		Content:           payload.Text,
+		IncomingWebhookID: sql.NullInt64{Int64: int64(hook.ID), Valid: true},
+		SenderName:        sql.NullString{String: hook.Name, Valid: true},
+		SenderAvatar:      hook.AvatarURL,
+	}
+	if payload.Username != "" {
+		message.SenderName.String = payload.Username
+	}
+	if payload.AvatarURL != "" {
+		message.SenderAvatar = sql.NullString{String: payload.AvatarURL, Valid: true}
+	}
+
+	created, _, err := h.sender.SendMessage(message, "")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// tokens are stored hashed so a leaked database does not leak working URLs
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/dclouisDan/chat-app-api/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	store             types.WebhookStore
+	incomingStore     types.IncomingWebhookStore
+	conversationStore types.ConversationStore
+	userStore         types.UserStore
+	sender            types.MessageSender
+	limiter           types.RateLimiter
+}
+
+// NewHandler limits the messages posted through each incoming webhook with
+// limiter.
+func NewHandler(store types.WebhookStore, incomingStore types.IncomingWebhookStore, conversationStore types.ConversationStore, userStore types.UserStore, sender types.MessageSender, limiter types.RateLimiter) *Handler {
+	return &Handler{
+		store:             store,
+		incomingStore:     incomingStore,
+		conversationStore: conversationStore,
+		userStore:         userStore,
+		sender:            sender,
+		limiter:           limiter,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	router.Post("/conversations/:id/webhooks", auth.WithJWTAuth(h.handleCreateWebhook, h.userStore))
+	router.Get("/conversations/:id/webhooks", auth.WithJWTAuth(h.handleListWebhooks, h.userStore))
+	router.Get("/conversations/:id/webhooks/dead-letters", auth.WithJWTAuth(h.handleListDeadLetters, h.userStore))
+	router.Delete("/conversations/:id/webhooks/:webhookID", auth.WithJWTAuth(h.handleDeleteWebhook, h.userStore))
+	router.Post("/conversations/:id/incoming-webhooks", auth.WithJWTAuth(h.handleCreateIncomingWebhook, h.userStore))
+	router.Get("/conversations/:id/incoming-webhooks", auth.WithJWTAuth(h.handleListIncomingWebhooks, h.userStore))
+	router.Delete("/conversations/:id/incoming-webhooks/:hookID", auth.WithJWTAuth(h.handleRevokeIncomingWebhook, h.userStore))
+	router.Post("/hooks/:token", h.handlePostIncomingWebhook)
+}
+
+// Register a webhook, its signing secret is only shown once
+func (h *Handler) handleCreateWebhook(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	var payload types.CreateWebhookPayload
+
+	// parse payload
+	if err := c.BodyParser(&payload); err != nil {
+		log.Printf("Parse error: %s", err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// validate payload
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload %v", errors),
+		})
+	}
+
+	if err := checkURL(c.Context(), payload.URL); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	secret, err := utils.RandomString(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	webhook, err := h.store.CreateWebhook(types.Webhook{
+		ConversationID: conversationID,
+		CreatedBy:      auth.GetIDFromContext(c),
+		URL:            payload.URL,
+		Secret:         secret,
+		Events:         payload.Events,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"webhook": webhook,
+		"secret":  secret,
+	})
+}
+
+// List the active webhooks of a conversation
+func (h *Handler) handleListWebhooks(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	webhooks, err := h.store.GetWebhooksByConversationID(conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(webhooks)
+}
+
+// List the deliveries that ran out of attempts
+func (h *Handler) handleListDeadLetters(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	deliveries, err := h.store.GetDeadWebhookDeliveries(conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(deliveries)
+}
+
+// Remove a webhook, it stops receiving events right away
+func (h *Handler) handleDeleteWebhook(c *fiber.Ctx) error {
+	conversationID, ok := h.requireAdmin(c)
+	if !ok {
+		return nil
+	}
+
+	webhookID, err := c.ParamsInt("webhookID")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid webhook id",
+		})
+	}
+
+	webhook, err := h.store.GetWebhookByID(webhookID)
+	if err != nil || webhook.ConversationID != conversationID || !webhook.Active {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "webhook not found",
+		})
+	}
+
+	if err := h.store.DeleteWebhook(webhook.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "webhook deleted",
+	})
+}
+
+// requireAdmin parses the conversation id and makes sure the current user is
+// one of its admins. It writes the error response itself when the check fails.
+func (h *Handler) requireAdmin(c *fiber.Ctx) (int, bool) {
+	conversationID, err := c.ParamsInt("id")
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid conversation id",
+		})
+		return 0, false
+	}
+
+	p, err := h.conversationStore.GetParticipant(conversationID, auth.GetIDFromContext(c))
+	if err != nil || p.Role != types.RoleAdmin {
+		c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only conversation admins can manage webhooks",
+		})
+		return 0, false
+	}
+
+	return conversationID, true
+}
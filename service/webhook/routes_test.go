@@ -0,0 +1,479 @@
+package webhook
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dclouisDan/chat-app-api/config"
+	"github.com/dclouisDan/chat-app-api/service/auth"
+	"github.com/dclouisDan/chat-app-api/service/ratelimit"
+	"github.com/dclouisDan/chat-app-api/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookServiceHandlers(t *testing.T) {
+	webhookStore := newMockWebhookStore()
+	conversationStore := &mockConversationStore{
+		participants: map[int]string{1: types.RoleAdmin, 2: types.RoleMember},
+	}
+	handler := NewHandler(webhookStore, newMockIncomingWebhookStore(), conversationStore, &mockUserStore{}, &mockSender{}, nil)
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	t.Run("should only let admins register webhooks", func(t *testing.T) {
+		payload := types.CreateWebhookPayload{URL: "https://203.0.113.10/hook", Events: []string{types.WebhookEventMessageCreated}}
+		req := newRequest(t, http.MethodPost, "/conversations/1/webhooks", payload, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should fail for an unknown event", func(t *testing.T) {
+		payload := types.CreateWebhookPayload{URL: "https://203.0.113.10/hook", Events: []string{"message.read"}}
+		req := newRequest(t, http.MethodPost, "/conversations/1/webhooks", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should fail for a url pointing to a private address", func(t *testing.T) {
+		for _, url := range []string{"http://127.0.0.1:8080/hook", "http://10.0.0.5/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]/hook"} {
+			payload := types.CreateWebhookPayload{URL: url, Events: []string{types.WebhookEventMessageCreated}}
+			req := newRequest(t, http.MethodPost, "/conversations/1/webhooks", payload, 1)
+
+			resp, err := app.Test(req)
+			assert.NoError(t, err, "error testing request")
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, url)
+		}
+		assert.Empty(t, webhookStore.webhooks)
+	})
+
+	t.Run("should register a webhook and return its secret once", func(t *testing.T) {
+		payload := types.CreateWebhookPayload{URL: "https://203.0.113.10/hook", Events: []string{types.WebhookEventMessageCreated}}
+		req := newRequest(t, http.MethodPost, "/conversations/1/webhooks", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var body struct {
+			Webhook map[string]any `json:"webhook"`
+			Secret  string         `json:"secret"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.NotEmpty(t, body.Secret)
+		assert.Equal(t, body.Secret, webhookStore.webhooks[1].Secret)
+		assert.NotContains(t, body.Webhook, "secret")
+	})
+
+	t.Run("should not delete a webhook of another conversation", func(t *testing.T) {
+		webhookStore.webhooks[2] = &types.Webhook{ID: 2, ConversationID: 5, Active: true}
+		req := newRequest(t, http.MethodDelete, "/conversations/1/webhooks/2", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.True(t, webhookStore.webhooks[2].Active)
+	})
+
+	t.Run("should delete a webhook", func(t *testing.T) {
+		req := newRequest(t, http.MethodDelete, "/conversations/1/webhooks/1", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.False(t, webhookStore.webhooks[1].Active)
+	})
+}
+
+func TestIncomingWebhookHandlers(t *testing.T) {
+	incomingStore := newMockIncomingWebhookStore()
+	conversationStore := &mockConversationStore{
+		participants: map[int]string{1: types.RoleAdmin, 2: types.RoleMember},
+	}
+	sender := &mockSender{}
+	handler := NewHandler(newMockWebhookStore(), incomingStore, conversationStore, &mockUserStore{}, sender, ratelimit.NewLimiter(ratelimit.NewMemory(), "incoming-webhooks", 2))
+
+	app := fiber.New()
+	handler.RegisterRoutes(app)
+
+	var token string
+
+	t.Run("should only let admins create incoming webhooks", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/conversations/1/incoming-webhooks", types.CreateIncomingWebhookPayload{Name: "CI"}, 2)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should create an incoming webhook and return its url", func(t *testing.T) {
+		payload := types.CreateIncomingWebhookPayload{Name: "CI", AvatarURL: "https://ci.example.com/logo.png"}
+		req := newRequest(t, http.MethodPost, "/conversations/1/incoming-webhooks", payload, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var body struct {
+			Token string `json:"token"`
+			URL   string `json:"url"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.True(t, strings.HasSuffix(body.URL, "/hooks/"+body.Token))
+		assert.Equal(t, hashToken(body.Token), incomingStore.hooks[1].TokenHash)
+		token = body.Token
+	})
+
+	t.Run("should fail for an unknown token", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/hooks/unknown", types.IncomingWebhookMessagePayload{Text: "hi"}, 0)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("should post a message as the bot", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/hooks/"+token, types.IncomingWebhookMessagePayload{Text: "build #12 passed"}, 0)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Len(t, sender.sent, 1)
+		assert.Equal(t, 0, sender.sent[0].SenderID)
+		assert.Equal(t, int64(1), sender.sent[0].IncomingWebhookID.Int64)
+		assert.Equal(t, "CI", sender.sent[0].SenderName.String)
+		assert.Equal(t, "https://ci.example.com/logo.png", sender.sent[0].SenderAvatar.String)
+	})
+
+	t.Run("should let the payload override the bot identity", func(t *testing.T) {
+		payload := types.IncomingWebhookMessagePayload{Text: "deployed", Username: "Deploy bot", AvatarURL: "https://ci.example.com/deploy.png"}
+		req := newRequest(t, http.MethodPost, "/hooks/"+token, payload, 0)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "Deploy bot", sender.sent[1].SenderName.String)
+		assert.Equal(t, "https://ci.example.com/deploy.png", sender.sent[1].SenderAvatar.String)
+	})
+
+	t.Run("should rate limit a token", func(t *testing.T) {
+		req := newRequest(t, http.MethodPost, "/hooks/"+token, types.IncomingWebhookMessagePayload{Text: "one too many"}, 0)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+		assert.Len(t, sender.sent, 2)
+	})
+
+	t.Run("should stop accepting messages once revoked", func(t *testing.T) {
+		req := newRequest(t, http.MethodDelete, "/conversations/1/incoming-webhooks/1", nil, 1)
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		handler.limiter = ratelimit.NewLimiter(ratelimit.NewMemory(), "incoming-webhooks", 2)
+		req = newRequest(t, http.MethodPost, "/hooks/"+token, types.IncomingWebhookMessagePayload{Text: "hi"}, 0)
+
+		resp, err = app.Test(req)
+		assert.NoError(t, err, "error testing request")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func newRequest(t *testing.T, method, target string, payload any, userID int) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, _, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, types.SystemRoleUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+type mockWebhookStore struct {
+	mu         sync.Mutex
+	webhooks   map[int]*types.Webhook
+	deliveries map[int]*types.WebhookDelivery
+}
+
+func newMockWebhookStore() *mockWebhookStore {
+	return &mockWebhookStore{
+		webhooks:   map[int]*types.Webhook{},
+		deliveries: map[int]*types.WebhookDelivery{},
+	}
+}
+
+func (m *mockWebhookStore) CreateWebhook(webhook types.Webhook) (*types.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook.ID = len(m.webhooks) + 1
+	webhook.Active = true
+	m.webhooks[webhook.ID] = &webhook
+	return &webhook, nil
+}
+
+func (m *mockWebhookStore) GetWebhookByID(id int) (*types.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if w, ok := m.webhooks[id]; ok {
+		return w, nil
+	}
+	return nil, fmt.Errorf("webhook not found")
+}
+
+func (m *mockWebhookStore) GetWebhooksByConversationID(conversationID int) ([]types.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhooks := []types.Webhook{}
+	for _, w := range m.webhooks {
+		if w.ConversationID == conversationID && w.Active {
+			webhooks = append(webhooks, *w)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockWebhookStore) GetActiveWebhooksForEvent(conversationID int, event string) ([]types.Webhook, error) {
+	all, _ := m.GetWebhooksByConversationID(conversationID)
+
+	webhooks := []types.Webhook{}
+	for _, w := range all {
+		for _, e := range w.Events {
+			if e == event {
+				webhooks = append(webhooks, w)
+			}
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockWebhookStore) DeleteWebhook(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.webhooks[id].Active = false
+	return nil
+}
+
+func (m *mockWebhookStore) CreateWebhookDelivery(delivery types.WebhookDelivery) (*types.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery.ID = len(m.deliveries) + 1
+	delivery.Status = types.WebhookDeliveryPending
+	m.deliveries[delivery.ID] = &delivery
+	return &delivery, nil
+}
+
+func (m *mockWebhookStore) RecordWebhookAttempt(attempt types.WebhookAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d := m.deliveries[attempt.DeliveryID]
+	d.History = append(d.History, attempt)
+	return nil
+}
+
+func (m *mockWebhookStore) UpdateWebhookDeliveryStatus(id int, status string, attempts int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deliveries[id].Status = status
+	m.deliveries[id].Attempts = attempts
+	return nil
+}
+
+func (m *mockWebhookStore) GetDeadWebhookDeliveries(conversationID int) ([]types.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := []types.WebhookDelivery{}
+	for _, d := range m.deliveries {
+		if d.Status == types.WebhookDeliveryDead && m.webhooks[d.WebhookID].ConversationID == conversationID {
+			deliveries = append(deliveries, *d)
+		}
+	}
+	return deliveries, nil
+}
+
+type mockIncomingWebhookStore struct {
+	hooks map[int]*types.IncomingWebhook
+}
+
+func newMockIncomingWebhookStore() *mockIncomingWebhookStore {
+	return &mockIncomingWebhookStore{hooks: map[int]*types.IncomingWebhook{}}
+}
+
+func (m *mockIncomingWebhookStore) CreateIncomingWebhook(hook types.IncomingWebhook) (*types.IncomingWebhook, error) {
+	hook.ID = len(m.hooks) + 1
+	m.hooks[hook.ID] = &hook
+	return &hook, nil
+}
+
+func (m *mockIncomingWebhookStore) GetIncomingWebhookByID(id int) (*types.IncomingWebhook, error) {
+	if h, ok := m.hooks[id]; ok {
+		return h, nil
+	}
+	return nil, fmt.Errorf("incoming webhook not found")
+}
+
+func (m *mockIncomingWebhookStore) GetIncomingWebhookByTokenHash(tokenHash string) (*types.IncomingWebhook, error) {
+	for _, h := range m.hooks {
+		if h.TokenHash == tokenHash {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("incoming webhook not found")
+}
+
+func (m *mockIncomingWebhookStore) GetIncomingWebhooksByConversationID(conversationID int) ([]types.IncomingWebhook, error) {
+	return nil, nil
+}
+
+func (m *mockIncomingWebhookStore) RevokeIncomingWebhook(id int) error {
+	m.hooks[id].RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	return nil
+}
+
+type mockSender struct {
+	sent []types.Message
+}
+
+func (m *mockSender) SendMessage(message types.Message, deviceID string) (*types.Message, *types.CommandResult, error) {
+	m.sent = append(m.sent, message)
+	return &message, nil, nil
+}
+
+type mockConversationStore struct {
+	participants map[int]string
+}
+
+func (m *mockConversationStore) CreateConversation(name string, creatorID int, participantIDs []int) (*types.Conversation, error) {
+	return &types.Conversation{ID: 1}, nil
+}
+
+func (m *mockConversationStore) GetConversationByID(id int) (*types.Conversation, error) {
+	return &types.Conversation{ID: id}, nil
+}
+
+func (m *mockConversationStore) GetParticipant(conversationID, userID int) (*types.Participant, error) {
+	if role, ok := m.participants[userID]; ok {
+		return &types.Participant{ConversationID: conversationID, UserID: userID, Role: role}, nil
+	}
+	return nil, fmt.Errorf("participant not found")
+}
+
+func (m *mockConversationStore) GetParticipants(conversationID int) ([]types.Participant, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) RemoveParticipant(conversationID, userID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) MarkRead(conversationID, userID, messageID int) error {
+	return nil
+}
+
+func (m *mockConversationStore) GetContactIDs(userID int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockConversationStore) ExportMessages(conversationID int, fn func(*types.ExportedMessage) error) error {
+	return nil
+}
+
+func (m *mockConversationStore) UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error {
+	return nil
+}
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id}, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserProfilePicture(userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) AnonymizeUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SuspendUser(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
@@ -0,0 +1,322 @@
+package webhook
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/dclouisDan/chat-app-api/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateWebhook(webhook types.Webhook) (*types.Webhook, error) {
+	res, err := s.db.Exec(
+		"INSERT INTO webhooks (conversation_id, created_by, url, secret, events) VALUES (?, ?, ?, ?, ?)",
+		webhook.ConversationID, webhook.CreatedBy, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetWebhookByID(int(id))
+}
+
+func (s *Store) GetWebhookByID(id int) (*types.Webhook, error) {
+	rows, err := s.db.Query("SELECT * FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	w := new(types.Webhook)
+	for rows.Next() {
+		w, err = scanRowIntoWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if w.ID == 0 {
+		return nil, fmt.Errorf("Webhook not found.")
+	}
+
+	return w, nil
+}
+
+func (s *Store) GetWebhooksByConversationID(conversationID int) ([]types.Webhook, error) {
+	return s.queryWebhooks("SELECT * FROM webhooks WHERE conversation_id = ? AND active = TRUE ORDER BY id", conversationID)
+}
+
+func (s *Store) GetActiveWebhooksForEvent(conversationID int, event string) ([]types.Webhook, error) {
+	return s.queryWebhooks("SELECT * FROM webhooks WHERE conversation_id = ? AND active = TRUE AND FIND_IN_SET(?, events) > 0", conversationID, event)
+}
+
+func (s *Store) DeleteWebhook(id int) error {
+	_, err := s.db.Exec("UPDATE webhooks SET active = FALSE WHERE id = ?;", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) CreateWebhookDelivery(delivery types.WebhookDelivery) (*types.WebhookDelivery, error) {
+	res, err := s.db.Exec(
+		"INSERT INTO webhook_deliveries (webhook_id, event, payload) VALUES (?, ?, ?)",
+		delivery.WebhookID, delivery.Event, delivery.Payload,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.ID = int(id)
+	delivery.Status = types.WebhookDeliveryPending
+
+	return &delivery, nil
+}
+
+func (s *Store) RecordWebhookAttempt(attempt types.WebhookAttempt) error {
+	_, err := s.db.Exec(
+		"INSERT INTO webhook_delivery_attempts (delivery_id, attempt, statusCode, error, durationMs) VALUES (?, ?, ?, ?, ?)",
+		attempt.DeliveryID, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.DurationMs,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) UpdateWebhookDeliveryStatus(id int, status string, attempts int) error {
+	_, err := s.db.Exec("UPDATE webhook_deliveries SET status = ?, attempts = ? WHERE id = ?;", status, attempts, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetDeadWebhookDeliveries lists the dead letters of a conversation along
+// with the history of every attempt made to deliver them.
+func (s *Store) GetDeadWebhookDeliveries(conversationID int) ([]types.WebhookDelivery, error) {
+	rows, err := s.db.Query(
+		`SELECT d.* FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE w.conversation_id = ? AND d.status = ?
+		ORDER BY d.id DESC`,
+		conversationID, types.WebhookDeliveryDead,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []types.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanRowIntoDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	rows.Close()
+
+	for i := range deliveries {
+		history, err := s.getAttempts(deliveries[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		deliveries[i].History = history
+	}
+
+	return deliveries, nil
+}
+
+func (s *Store) getAttempts(deliveryID int) ([]types.WebhookAttempt, error) {
+	rows, err := s.db.Query("SELECT * FROM webhook_delivery_attempts WHERE delivery_id = ? ORDER BY attempt", deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []types.WebhookAttempt{}
+	for rows.Next() {
+		a := types.WebhookAttempt{}
+		err := rows.Scan(&a.ID, &a.DeliveryID, &a.Attempt, &a.StatusCode, &a.Error, &a.DurationMs, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+
+	return attempts, nil
+}
+
+func (s *Store) queryWebhooks(query string, args ...any) ([]types.Webhook, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []types.Webhook{}
+	for rows.Next() {
+		w, err := scanRowIntoWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+
+	return webhooks, nil
+}
+
+func scanRowIntoWebhook(rows *sql.Rows) (*types.Webhook, error) {
+	w := new(types.Webhook)
+
+	var events string
+	err := rows.Scan(
+		&w.ID,
+		&w.ConversationID,
+		&w.CreatedBy,
+		&w.URL,
+		&w.Secret,
+		&events,
+		&w.Active,
+		&w.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	w.Events = strings.Split(events, ",")
+
+	return w, nil
+}
+
+func scanRowIntoDelivery(rows *sql.Rows) (*types.WebhookDelivery, error) {
+	d := new(types.WebhookDelivery)
+
+	err := rows.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.Event,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (s *Store) CreateIncomingWebhook(hook types.IncomingWebhook) (*types.IncomingWebhook, error) {
+	res, err := s.db.Exec(
+		"INSERT INTO incoming_webhooks (conversation_id, created_by, name, avatarUrl, tokenHash) VALUES (?, ?, ?, ?, ?)",
+		hook.ConversationID, hook.CreatedBy, hook.Name, hook.AvatarURL, hook.TokenHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetIncomingWebhookByID(int(id))
+}
+
+func (s *Store) GetIncomingWebhookByID(id int) (*types.IncomingWebhook, error) {
+	return s.getIncomingWebhook("SELECT * FROM incoming_webhooks WHERE id = ?", id)
+}
+
+func (s *Store) GetIncomingWebhookByTokenHash(tokenHash string) (*types.IncomingWebhook, error) {
+	return s.getIncomingWebhook("SELECT * FROM incoming_webhooks WHERE tokenHash = ?", tokenHash)
+}
+
+func (s *Store) GetIncomingWebhooksByConversationID(conversationID int) ([]types.IncomingWebhook, error) {
+	rows, err := s.db.Query("SELECT * FROM incoming_webhooks WHERE conversation_id = ? AND revokedAt IS NULL ORDER BY id", conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []types.IncomingWebhook{}
+	for rows.Next() {
+		h, err := scanRowIntoIncomingWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *h)
+	}
+
+	return hooks, nil
+}
+
+func (s *Store) RevokeIncomingWebhook(id int) error {
+	_, err := s.db.Exec("UPDATE incoming_webhooks SET revokedAt = CURRENT_TIMESTAMP WHERE id = ? AND revokedAt IS NULL;", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) getIncomingWebhook(query string, arg any) (*types.IncomingWebhook, error) {
+	rows, err := s.db.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	h := new(types.IncomingWebhook)
+	for rows.Next() {
+		h, err = scanRowIntoIncomingWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if h.ID == 0 {
+		return nil, fmt.Errorf("Incoming webhook not found.")
+	}
+
+	return h, nil
+}
+
+func scanRowIntoIncomingWebhook(rows *sql.Rows) (*types.IncomingWebhook, error) {
+	h := new(types.IncomingWebhook)
+
+	err := rows.Scan(
+		&h.ID,
+		&h.ConversationID,
+		&h.CreatedBy,
+		&h.Name,
+		&h.AvatarURL,
+		&h.TokenHash,
+		&h.RevokedAt,
+		&h.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
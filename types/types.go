@@ -2,6 +2,7 @@ package types
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
@@ -9,8 +10,11 @@ type UserStore interface {
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id int) (*User, error)
 	CreateUser(User) error
-  UpdateUser(User) error
-  UpdateUserProfilePicture(userID int, path string) error
+	UpdateUser(User) error
+	UpdateUserProfilePicture(userID int, path string) error
+	AnonymizeUser(userID int) error
+	SuspendUser(userID int) error
+	UpdateUserRole(userID int, role string) error
 }
 
 type User struct {
@@ -21,6 +25,24 @@ type User struct {
 	Password       string         `json:"password"`
 	ProfilePicture sql.NullString `json:"profilePicture"`
 	CreatedAt      time.Time      `json:"createdAt"`
+	DeletedAt      sql.NullTime   `json:"deletedAt"`
+	// suspended accounts can no longer log in or use their tokens
+	SuspendedAt sql.NullTime `json:"suspendedAt"`
+	Role        string       `json:"role"`
+	// set once the user followed the link emailed to their address
+	EmailVerifiedAt sql.NullTime `json:"emailVerifiedAt"`
+}
+
+// System roles, from the least to the most privileged. They apply to the
+// whole instance, unlike the roles of conversation participants.
+const (
+	SystemRoleUser      = "user"
+	SystemRoleModerator = "moderator"
+	SystemRoleAdmin     = "admin"
+)
+
+type UpdateUserRolePayload struct {
+	Role string `json:"role" validate:"required,oneof=user moderator admin"`
 }
 
 type RegisterUserPayload struct {
@@ -39,4 +61,965 @@ type UpdateUserPayload struct {
 type LoginUserPayload struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
+	// shown in the list of sessions, e.g. "Jane's laptop"
+	DeviceName string `json:"deviceName" validate:"max=100"`
+}
+
+type RefreshTokenStore interface {
+	CreateRefreshToken(RefreshToken) error
+	GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error)
+	// UseRefreshToken marks the token as exchanged, it reports false when
+	// the token already was.
+	UseRefreshToken(id int) (bool, error)
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeUserRefreshTokens(userID int) error
+}
+
+// RefreshToken is exchanged for a new access token and a new refresh token.
+// Every token obtained from the same login shares a family, presenting a
+// token of the family twice revokes all of them.
+type RefreshToken struct {
+	ID        int          `json:"id"`
+	UserID    int          `json:"userId"`
+	FamilyID  string       `json:"familyId"`
+	TokenHash string       `json:"-"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+	UsedAt    sql.NullTime `json:"usedAt"`
+	RevokedAt sql.NullTime `json:"revokedAt"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+// TokenRevocationStore keeps the access tokens that may no longer be used
+// until they would have expired anyway.
+type TokenRevocationStore interface {
+	RevokeToken(jti string, userID int, expiresAt time.Time) error
+	IsTokenRevoked(jti string) (bool, error)
+	// RevokeUserTokens revokes every token of the user issued up to
+	// issuedBefore, the revocation is kept until expiresAt.
+	RevokeUserTokens(userID int, issuedBefore, expiresAt time.Time) error
+	// GetUserTokensRevokedBefore returns the zero time when the tokens of
+	// the user were never revoked together.
+	GetUserTokensRevokedBefore(userID int) (time.Time, error)
+	DeleteExpiredRevocations(now time.Time) (int64, error)
+}
+
+// TokenRevoker signs users out before their tokens expire.
+type TokenRevoker interface {
+	RevokeToken(jti string, userID int, expiresAt time.Time) error
+	RevokeUserTokens(userID int) error
+}
+
+// SessionStore keeps a session per login, the refresh tokens of the login
+// belong to the family with the id of the session.
+type SessionStore interface {
+	CreateSession(Session) error
+	GetSessionByID(id string) (*Session, error)
+	// GetUserSessions returns the sessions of the user not signed out and
+	// active since the given time, most recently active first.
+	GetUserSessions(userID int, activeSince time.Time) ([]Session, error)
+	TouchSession(id string, lastActiveAt time.Time, ip string) error
+	RevokeSession(id string) error
+	RevokeUserSessions(userID int) error
+	// DeleteStaleSessions deletes the sessions signed out or last active
+	// before the given time.
+	DeleteStaleSessions(before time.Time) (int64, error)
+}
+
+type Session struct {
+	ID           string       `json:"id"`
+	UserID       int          `json:"-"`
+	DeviceName   string       `json:"deviceName"`
+	UserAgent    string       `json:"userAgent"`
+	IP           string       `json:"ip"`
+	LastActiveAt time.Time    `json:"lastActiveAt"`
+	CreatedAt    time.Time    `json:"createdAt"`
+	RevokedAt    sql.NullTime `json:"-"`
+	// Current is set on the session of the request listing them
+	Current bool `json:"current"`
+}
+
+// SessionRevoker signs a single device, or every device of a user, out.
+type SessionRevoker interface {
+	RevokeSession(id string) error
+	RevokeUserSessions(userID int) error
+}
+
+// EmailVerificationStore records that users own their email address.
+type EmailVerificationStore interface {
+	// MarkEmailVerified only verifies the address the user still has.
+	MarkEmailVerified(userID int, email string) error
+}
+
+type VerifyEmailPayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResendVerificationPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// PasswordStore changes passwords, and keeps the tokens emailed to users
+// who forgot theirs.
+type PasswordStore interface {
+	UpdateUserPassword(userID int, hashedPassword string) error
+	CreatePasswordResetToken(PasswordResetToken) error
+	GetPasswordResetTokenByHash(tokenHash string) (*PasswordResetToken, error)
+	// UsePasswordResetToken marks the token as used, it reports false when
+	// the token already was.
+	UsePasswordResetToken(id int) (bool, error)
+	// InvalidateUserPasswordResetTokens marks every unused token of the user
+	// as used.
+	InvalidateUserPasswordResetTokens(userID int) error
+	DeleteExpiredPasswordResetTokens(now time.Time) (int64, error)
+}
+
+// PasswordResetToken lets a user who forgot their password choose a new one,
+// once and for a limited time.
+type PasswordResetToken struct {
+	ID        int          `json:"id"`
+	UserID    int          `json:"userId"`
+	TokenHash string       `json:"-"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+	UsedAt    sql.NullTime `json:"usedAt"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=3,max=130"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,min=3,max=130"`
+	// keeps only the session of the request signed in
+	SignOutOtherSessions bool `json:"signOutOtherSessions"`
+}
+
+type LogoutPayload struct {
+	// revoked along with the access token when given
+	RefreshToken string `json:"refreshToken"`
+}
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type DataExportStore interface {
+	CreateDataExport(userID int) (*DataExport, error)
+	GetDataExportByID(id int) (*DataExport, error)
+	CompleteDataExport(id int, filePath string) error
+	FailDataExport(id int, reason string) error
+	GetConversationsByUserID(userID int) ([]Conversation, error)
+	GetMessagesBySenderID(userID int, fn func(*ExportedMessage) error) error
+}
+
+type DataExport struct {
+	ID          int            `json:"id"`
+	UserID      int            `json:"userId"`
+	Status      string         `json:"status"`
+	FilePath    sql.NullString `json:"-"`
+	Error       sql.NullString `json:"error"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	CompletedAt sql.NullTime   `json:"completedAt"`
+}
+
+const (
+	DataExportPending   = "pending"
+	DataExportCompleted = "completed"
+	DataExportFailed    = "failed"
+)
+
+type ConversationStore interface {
+	CreateConversation(name string, creatorID int, participantIDs []int) (*Conversation, error)
+	GetConversationByID(id int) (*Conversation, error)
+	GetParticipant(conversationID, userID int) (*Participant, error)
+	GetParticipants(conversationID int) ([]Participant, error)
+	RemoveParticipant(conversationID, userID int) error
+	MarkRead(conversationID, userID, messageID int) error
+	// GetContactIDs lists the users sharing at least one conversation with the user
+	GetContactIDs(userID int) ([]int, error)
+	ExportMessages(conversationID int, fn func(*ExportedMessage) error) error
+	UpdateNotificationSettings(conversationID, userID int, notifications string, mutedUntil sql.NullTime) error
+}
+
+type Conversation struct {
+	ID        int            `json:"id"`
+	Name      sql.NullString `json:"name"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+type Participant struct {
+	ConversationID    int           `json:"conversationId"`
+	UserID            int           `json:"userId"`
+	Role              string        `json:"role"`
+	JoinedAt          time.Time     `json:"joinedAt"`
+	LastReadMessageID sql.NullInt64 `json:"lastReadMessageId"`
+	Notifications     string        `json:"notifications"`
+	MutedUntil        sql.NullTime  `json:"mutedUntil"`
+}
+
+// Which messages of a conversation a participant is notified of. Mentions
+// are written <@userId> in the content of a message.
+const (
+	NotifyAll      = "all"
+	NotifyMentions = "mentions"
+	NotifyNone     = "none"
+)
+
+type UpdateNotificationSettingsPayload struct {
+	Notifications string     `json:"notifications" validate:"required,oneof=all mentions none"`
+	MutedUntil    *time.Time `json:"mutedUntil"`
+}
+
+type ExportedMessage struct {
+	ID             int                  `json:"id"`
+	ConversationID int                  `json:"conversationId"`
+	SenderID       int                  `json:"senderId"`
+	SenderName     string               `json:"senderName"`
+	Content        string               `json:"content"`
+	SentAt         time.Time            `json:"sentAt"`
+	EditedAt       *time.Time           `json:"editedAt,omitempty"`
+	Attachments    []ExportedAttachment `json:"attachments"`
+}
+
+type ExportedAttachment struct {
+	FileName string `json:"fileName"`
+	URL      string `json:"url"`
+}
+
+const (
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+)
+
+type CreateConversationPayload struct {
+	Name           string `json:"name" validate:"max=255"`
+	ParticipantIDs []int  `json:"participantIds" validate:"required,min=1"`
+}
+
+type InviteStore interface {
+	CreateInvite(Invite) (*Invite, error)
+	GetInviteByCode(code string) (*Invite, error)
+	GetInvitesByConversationID(conversationID int) ([]Invite, error)
+	RevokeInvite(inviteID int) error
+	AcceptInvite(inviteID, userID int) error
+	CreateJoinRequest(inviteID, userID int) (*JoinRequest, error)
+	GetJoinRequestByID(id int) (*JoinRequest, error)
+	GetPendingJoinRequests(conversationID int) ([]JoinRequest, error)
+	HasPendingJoinRequest(conversationID, userID int) (bool, error)
+	ApproveJoinRequest(id, adminID int) error
+	RejectJoinRequest(id, adminID int) error
+}
+
+type Invite struct {
+	ID               int           `json:"id"`
+	ConversationID   int           `json:"conversationId"`
+	CreatedBy        int           `json:"createdBy"`
+	Code             string        `json:"code"`
+	MaxUses          sql.NullInt64 `json:"maxUses"`
+	Uses             int           `json:"uses"`
+	RequiresApproval bool          `json:"requiresApproval"`
+	ExpiresAt        sql.NullTime  `json:"expiresAt"`
+	RevokedAt        sql.NullTime  `json:"revokedAt"`
+	CreatedAt        time.Time     `json:"createdAt"`
+}
+
+type JoinRequest struct {
+	ID             int           `json:"id"`
+	ConversationID int           `json:"conversationId"`
+	UserID         int           `json:"userId"`
+	InviteID       int           `json:"inviteId"`
+	Status         string        `json:"status"`
+	ResolvedBy     sql.NullInt64 `json:"resolvedBy"`
+	ResolvedAt     sql.NullTime  `json:"resolvedAt"`
+	CreatedAt      time.Time     `json:"createdAt"`
+}
+
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+)
+
+type CreateInvitePayload struct {
+	ExpiresInSeconds int64 `json:"expiresInSeconds" validate:"omitempty,min=60"`
+	MaxUses          int64 `json:"maxUses" validate:"omitempty,min=1"`
+	RequiresApproval bool  `json:"requiresApproval"`
+}
+
+type Event struct {
+	// ID increases with every event delivered to a user, clients resume a
+	// stream from the last one they saw
+	ID uint64 `json:"id,omitempty"`
+	// Seq is the position of the event in the persistent log of the user,
+	// only set for the events kept there
+	Seq     uint64 `json:"seq,omitempty"`
+	Type    string `json:"type"`
+	Payload any    `json:"payload"`
+}
+
+// EventPublisher pushes real-time events to the connected devices of users.
+type EventPublisher interface {
+	SendToUser(userID int, event Event, exceptDevice string)
+	SendToUsers(userIDs []int, event Event)
+}
+
+type MessageStore interface {
+	CreateMessage(Message) (*Message, error)
+	GetMessageByID(id int) (*Message, error)
+	GetMessagesByConversationID(conversationID, beforeID, limit int) ([]Message, error)
+	UpdateMessageContent(id int, content string) error
+	DeleteMessage(id int) error
+	GetMessageByClientID(senderID int, clientMessageID string) (*Message, error)
+	// CreateEncryptedMessage stores a message together with the ciphertexts
+	// of its recipient devices.
+	CreateEncryptedMessage(message Message, ciphertexts []DeviceCiphertext) (*Message, error)
+	// GetCiphertexts returns, by message id, the ciphertexts addressed to the
+	// devices of the user.
+	GetCiphertexts(messageIDs []int, userID int) (map[int][]DeviceCiphertext, error)
+	GetHeldMessages(conversationID int) ([]Message, error)
+	// ReleaseMessage makes a message held for review visible.
+	ReleaseMessage(id int) error
+}
+
+type Message struct {
+	ID             int          `json:"id"`
+	ConversationID int          `json:"conversationId"`
+	SenderID       int          `json:"senderId"`
+	Content        string       `json:"content"`
+	SentAt         time.Time    `json:"sentAt"`
+	EditedAt       sql.NullTime `json:"editedAt"`
+	ReadAt         sql.NullTime `json:"readAt"`
+	DeletedAt      sql.NullTime `json:"deletedAt"`
+	Type           string       `json:"type"`
+	Poll           *Poll        `json:"poll,omitempty"`
+	// set instead of SenderID when the message was posted by an incoming webhook
+	IncomingWebhookID sql.NullInt64  `json:"incomingWebhookId"`
+	SenderName        sql.NullString `json:"senderName"`
+	SenderAvatar      sql.NullString `json:"senderAvatar"`
+	// generated by the sending client so retries do not duplicate the message
+	ClientMessageID sql.NullString `json:"clientMessageId"`
+	// encrypted messages have no content, only the ciphertexts of the
+	// devices of the reader are attached
+	Ciphertexts []DeviceCiphertext `json:"ciphertexts,omitempty"`
+	// set while the message waits for a review, only its sender sees it
+	HeldAt sql.NullTime `json:"heldAt"`
+}
+
+const (
+	MessageTypeText      = "text"
+	MessageTypePoll      = "poll"
+	MessageTypeEncrypted = "encrypted"
+)
+
+// SendMessagePayload carries either plaintext content or, for end-to-end
+// encrypted conversations, one ciphertext per recipient device.
+type SendMessagePayload struct {
+	Content         string                    `json:"content" validate:"required_without=Ciphertexts,excluded_with=Ciphertexts,max=4000"`
+	Ciphertexts     []DeviceCiphertextPayload `json:"ciphertexts" validate:"omitempty,max=500,dive"`
+	ClientMessageID string                    `json:"clientMessageId" validate:"omitempty,max=64"`
+}
+
+// DeviceCiphertext is a message encrypted for one device of a recipient, the
+// server never looks inside.
+type DeviceCiphertext struct {
+	MessageID  int    `json:"messageId"`
+	UserID     int    `json:"userId"`
+	DeviceID   string `json:"deviceId"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+type DeviceCiphertextPayload struct {
+	UserID     int    `json:"userId" validate:"required"`
+	DeviceID   string `json:"deviceId" validate:"required,max=64"`
+	Ciphertext string `json:"ciphertext" validate:"required,base64,max=65536"`
+}
+
+type UpdateMessagePayload struct {
+	Content string `json:"content" validate:"required,max=4000"`
+}
+
+type PollStore interface {
+	CreatePoll(message Message, poll Poll) (*Message, error)
+	GetPollByID(id int) (*Poll, error)
+	SetPollVotes(pollID, userID int, optionIDs []int) error
+	RetractPollVotes(pollID, userID int) error
+}
+
+// Poll carries its aggregated results. Voters are only listed for polls
+// that are not anonymous.
+type Poll struct {
+	ID             int          `json:"id"`
+	MessageID      int          `json:"messageId"`
+	Question       string       `json:"question"`
+	MultipleChoice bool         `json:"multipleChoice"`
+	Anonymous      bool         `json:"anonymous"`
+	ClosesAt       sql.NullTime `json:"closesAt"`
+	CreatedAt      time.Time    `json:"createdAt"`
+	Options        []PollOption `json:"options"`
+	TotalVoters    int          `json:"totalVoters"`
+}
+
+type PollOption struct {
+	ID       int    `json:"id"`
+	PollID   int    `json:"pollId"`
+	Text     string `json:"text"`
+	Position int    `json:"position"`
+	Votes    int    `json:"votes"`
+	Voters   []int  `json:"voters,omitempty"`
+}
+
+type CreatePollPayload struct {
+	Question        string   `json:"question" validate:"required,max=500"`
+	Options         []string `json:"options" validate:"required,min=2,max=10,dive,required,max=255"`
+	MultipleChoice  bool     `json:"multipleChoice"`
+	Anonymous       bool     `json:"anonymous"`
+	ClosesInSeconds int64    `json:"closesInSeconds" validate:"omitempty,min=60"`
+}
+
+type VotePollPayload struct {
+	OptionIDs []int `json:"optionIds" validate:"required,min=1"`
+}
+
+type DraftStore interface {
+	GetDraft(userID, conversationID int) (*Draft, error)
+	SaveDraft(Draft) error
+	DeleteDraft(userID, conversationID int) error
+}
+
+type Draft struct {
+	UserID         int       `json:"userId"`
+	ConversationID int       `json:"conversationId"`
+	Content        string    `json:"content"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+type SaveDraftPayload struct {
+	Content string `json:"content" validate:"max=4000"`
+}
+
+const (
+	EventMessageCreated = "message.created"
+	EventMessageUpdated = "message.updated"
+	EventMessageDeleted = "message.deleted"
+	EventDraftUpdated   = "draft.updated"
+	EventDraftDeleted   = "draft.deleted"
+	EventPollUpdated    = "poll.updated"
+	EventReceiptRead    = "receipt.read"
+	EventTyping         = "typing"
+	EventPresence       = "presence.updated"
+	EventMemberJoined   = "member.joined"
+	EventMemberLeft     = "member.left"
+	EventReportResolved = "report.resolved"
+	// EventMessageSend is sent by clients over the socket, the server answers
+	// the sending connection with EventMessageAck
+	EventMessageSend = "message.send"
+	EventMessageAck  = "message.ack"
+	// EventResync tells a client its stream could not be resumed and it has
+	// to catch up through GET /sync
+	EventResync = "resync"
+)
+
+type WebhookStore interface {
+	CreateWebhook(Webhook) (*Webhook, error)
+	GetWebhookByID(id int) (*Webhook, error)
+	GetWebhooksByConversationID(conversationID int) ([]Webhook, error)
+	GetActiveWebhooksForEvent(conversationID int, event string) ([]Webhook, error)
+	DeleteWebhook(id int) error
+	CreateWebhookDelivery(WebhookDelivery) (*WebhookDelivery, error)
+	RecordWebhookAttempt(WebhookAttempt) error
+	UpdateWebhookDeliveryStatus(id int, status string, attempts int) error
+	GetDeadWebhookDeliveries(conversationID int) ([]WebhookDelivery, error)
+}
+
+// WebhookDispatcher delivers conversation events to registered webhooks.
+type WebhookDispatcher interface {
+	Dispatch(conversationID int, event string, data any)
+}
+
+type Webhook struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversationId"`
+	CreatedBy      int       `json:"createdBy"`
+	URL            string    `json:"url"`
+	Secret         string    `json:"-"`
+	Events         []string  `json:"events"`
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type WebhookDelivery struct {
+	ID        int              `json:"id"`
+	WebhookID int              `json:"webhookId"`
+	Event     string           `json:"event"`
+	Payload   string           `json:"payload"`
+	Status    string           `json:"status"`
+	Attempts  int              `json:"attempts"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+	History   []WebhookAttempt `json:"history,omitempty"`
+}
+
+type WebhookAttempt struct {
+	ID         int            `json:"id"`
+	DeliveryID int            `json:"deliveryId"`
+	Attempt    int            `json:"attempt"`
+	StatusCode sql.NullInt64  `json:"statusCode"`
+	Error      sql.NullString `json:"error"`
+	DurationMs int64          `json:"durationMs"`
+	CreatedAt  time.Time      `json:"createdAt"`
+}
+
+type CreateWebhookPayload struct {
+	URL    string   `json:"url" validate:"required,url,max=2048"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=message.created message.edited message.deleted member.joined member.left"`
+}
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryDead      = "dead"
+)
+
+const (
+	WebhookEventMessageCreated = "message.created"
+	WebhookEventMessageEdited  = "message.edited"
+	WebhookEventMessageDeleted = "message.deleted"
+	WebhookEventMemberJoined   = "member.joined"
+	WebhookEventMemberLeft     = "member.left"
+)
+
+type IncomingWebhookStore interface {
+	CreateIncomingWebhook(IncomingWebhook) (*IncomingWebhook, error)
+	GetIncomingWebhookByID(id int) (*IncomingWebhook, error)
+	GetIncomingWebhookByTokenHash(tokenHash string) (*IncomingWebhook, error)
+	GetIncomingWebhooksByConversationID(conversationID int) ([]IncomingWebhook, error)
+	RevokeIncomingWebhook(id int) error
+}
+
+// MessageDeleter deletes a message through the same path as the messages
+// API, letting the participants know.
+type MessageDeleter interface {
+	DeleteMessage(id int) error
+}
+
+// SignOuter signs a user out of every device, revoking their access tokens,
+// refresh tokens and sessions.
+type SignOuter interface {
+	SignOutEverywhere(userID int) error
+}
+
+// ConnectionCloser closes the real-time connections of a user.
+type ConnectionCloser interface {
+	DisconnectUser(userID int)
+}
+
+// MessageSender posts a message through the same path as the messages API,
+// so real-time events and outgoing webhooks fire for it too. Slash commands
+// typed by users run on the way, an ephemeral one answers the sender alone
+// with its result instead of a message.
+type MessageSender interface {
+	SendMessage(message Message, deviceID string) (*Message, *CommandResult, error)
+}
+
+type IncomingWebhook struct {
+	ID             int            `json:"id"`
+	ConversationID int            `json:"conversationId"`
+	CreatedBy      int            `json:"createdBy"`
+	Name           string         `json:"name"`
+	AvatarURL      sql.NullString `json:"avatarUrl"`
+	TokenHash      string         `json:"-"`
+	RevokedAt      sql.NullTime   `json:"revokedAt"`
+	CreatedAt      time.Time      `json:"createdAt"`
+}
+
+type CreateIncomingWebhookPayload struct {
+	Name      string `json:"name" validate:"required,max=64"`
+	AvatarURL string `json:"avatarUrl" validate:"omitempty,url,max=2048"`
+}
+
+type IncomingWebhookMessagePayload struct {
+	Text      string `json:"text" validate:"required,max=4000"`
+	Username  string `json:"username" validate:"omitempty,max=64"`
+	AvatarURL string `json:"avatarUrl" validate:"omitempty,url,max=2048"`
+}
+
+type SlashCommandStore interface {
+	CreateSlashCommand(SlashCommand) (*SlashCommand, error)
+	GetSlashCommandByID(id int) (*SlashCommand, error)
+	GetSlashCommandByName(conversationID int, name string) (*SlashCommand, error)
+	GetSlashCommandsByConversationID(conversationID int) ([]SlashCommand, error)
+	DeleteSlashCommand(id int) error
+}
+
+// CommandExecutor intercepts slash commands typed into the composer. It
+// returns a nil result when the content is not a command.
+type CommandExecutor interface {
+	Execute(conversationID, userID int, content string) (*CommandResult, error)
+}
+
+// SlashCommand is a custom command of a conversation, served by an HTTP
+// endpoint.
+type SlashCommand struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversationId"`
+	CreatedBy      int       `json:"createdBy"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	URL            string    `json:"url"`
+	Secret         string    `json:"-"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type CommandResult struct {
+	Command      string `json:"command"`
+	ResponseType string `json:"responseType"`
+	Text         string `json:"text"`
+}
+
+type CreateSlashCommandPayload struct {
+	Name        string `json:"name" validate:"required,max=32,alphanum,lowercase"`
+	Description string `json:"description" validate:"max=255"`
+	URL         string `json:"url" validate:"required,url,max=2048"`
+}
+
+const (
+	CommandResponseEphemeral = "ephemeral"
+	CommandResponsePublic    = "public"
+)
+
+type MarkReadPayload struct {
+	MessageID int `json:"messageId" validate:"required"`
+}
+
+// PubSub relays messages between the instances of the API.
+type PubSub interface {
+	Publish(channel string, data []byte) error
+	// Subscribe calls fn with every message published on the channel by any
+	// instance, until the PubSub is closed.
+	Subscribe(channel string, fn func(data []byte)) error
+	Close() error
+}
+
+// RateLimiter tells whether one more action may go ahead for a key, and
+// otherwise how long to wait before trying again.
+type RateLimiter interface {
+	Allow(key string) (bool, time.Duration)
+}
+
+// RateLimitStore holds token buckets, in process or shared by the instances.
+type RateLimitStore interface {
+	// Take removes a token from the bucket of key, which holds up to burst
+	// tokens and is refilled at rate tokens per second. An empty bucket gives
+	// false along with the time until the next token.
+	Take(key string, rate float64, burst int) (bool, time.Duration, error)
+	Close() error
+}
+
+// IdempotencyStore remembers the responses of POST requests sent with an
+// Idempotency-Key header, per user.
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey claims the key for a new request. When the key is
+	// already taken the existing record is returned with created false.
+	ReserveIdempotencyKey(userID int, key, fingerprint string) (record *IdempotencyRecord, created bool, err error)
+	CompleteIdempotencyKey(userID int, key string, statusCode int, body []byte) error
+	ReleaseIdempotencyKey(userID int, key string) error
+}
+
+// IdempotencyRecord has no status code while its request is in progress.
+type IdempotencyRecord struct {
+	ID          int
+	UserID      int
+	Key         string
+	Fingerprint string
+	StatusCode  sql.NullInt64
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// EventLogStore keeps the events of every user under a sequence number
+// increasing per user, for clients catching up after a reconnect.
+type EventLogStore interface {
+	// AppendUserEvents records the event for each user and returns the
+	// sequence number it got for them.
+	AppendUserEvents(userIDs []int, eventType string, payload []byte) (map[int]uint64, error)
+	GetUserEventsSince(userID int, since uint64, limit int) ([]UserEvent, error)
+	GetLastUserEventSeq(userID int) (uint64, error)
+	DeleteUserEventsBefore(before time.Time) (int64, error)
+}
+
+type UserEvent struct {
+	ID        int             `json:"-"`
+	UserID    int             `json:"-"`
+	Seq       uint64          `json:"seq"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// KeyStore is the directory of the public keys devices publish for end-to-end
+// encryption. Private keys never reach the server.
+type KeyStore interface {
+	// SetDeviceKeys publishes the identity key and signed prekey of a device.
+	// One-time prekeys left from an earlier identity key are dropped.
+	SetDeviceKeys(keys DeviceKeys) error
+	GetDeviceKeys(userID int) ([]DeviceKeys, error)
+	DeleteDeviceKeys(userID int, deviceID string) error
+	AddOneTimePrekeys(userID int, deviceID string, prekeys []OneTimePrekey) error
+	CountOneTimePrekeys(userID int, deviceID string) (int, error)
+	// ClaimOneTimePrekey removes and returns a one-time prekey of the device,
+	// nil once they ran out.
+	ClaimOneTimePrekey(userID int, deviceID string) (*OneTimePrekey, error)
+}
+
+type DeviceKeys struct {
+	UserID       int          `json:"userId"`
+	DeviceID     string       `json:"deviceId"`
+	IdentityKey  string       `json:"identityKey"`
+	SignedPrekey SignedPrekey `json:"signedPrekey"`
+	UpdatedAt    time.Time    `json:"updatedAt"`
+}
+
+type SignedPrekey struct {
+	KeyID     uint32 `json:"keyId"`
+	PublicKey string `json:"publicKey" validate:"required,base64,max=1024"`
+	Signature string `json:"signature" validate:"required,base64,max=1024"`
+}
+
+type OneTimePrekey struct {
+	KeyID     uint32 `json:"keyId"`
+	PublicKey string `json:"publicKey" validate:"required,base64,max=1024"`
+}
+
+// PrekeyBundle is what a sender needs to start a session with a device. It
+// comes without one-time prekey once the device ran out of them.
+type PrekeyBundle struct {
+	DeviceKeys
+	OneTimePrekey *OneTimePrekey `json:"oneTimePrekey"`
+}
+
+type PublishDeviceKeysPayload struct {
+	IdentityKey    string          `json:"identityKey" validate:"required,base64,max=1024"`
+	SignedPrekey   SignedPrekey    `json:"signedPrekey"`
+	OneTimePrekeys []OneTimePrekey `json:"oneTimePrekeys" validate:"max=100,dive"`
+}
+
+type AddOneTimePrekeysPayload struct {
+	OneTimePrekeys []OneTimePrekey `json:"oneTimePrekeys" validate:"required,min=1,max=100,dive"`
+}
+
+// MessageModerator screens the text of messages before they are sent.
+type MessageModerator interface {
+	// Moderate returns the verdict on the text, its Text is what may be sent.
+	Moderate(text string) (*ModerationVerdict, error)
+	// Record keeps a decision taken on a message for audit.
+	Record(decision ModerationDecision) error
+}
+
+type ModerationStore interface {
+	CreateModerationDecision(ModerationDecision) error
+	GetModerationDecisionsByConversationID(conversationID, beforeID, limit int) ([]ModerationDecision, error)
+}
+
+type ModerationVerdict struct {
+	Action    string `json:"action"`
+	Text      string `json:"text"`
+	Moderator string `json:"moderator"`
+	Reason    string `json:"reason"`
+}
+
+// ModerationDecision is the audit record of a verdict other than allow. A
+// rejected message was never stored and has no MessageID.
+type ModerationDecision struct {
+	ID             int           `json:"id"`
+	MessageID      sql.NullInt64 `json:"messageId"`
+	ConversationID int           `json:"conversationId"`
+	UserID         sql.NullInt64 `json:"userId"`
+	Action         string        `json:"action"`
+	Moderator      string        `json:"moderator"`
+	Reason         string        `json:"reason"`
+	Content        string        `json:"content"`
+	CreatedAt      time.Time     `json:"createdAt"`
+}
+
+// Moderation actions, from the mildest to the most severe.
+const (
+	ModerationAllow  = "allow"
+	ModerationMask   = "mask"
+	ModerationHold   = "hold"
+	ModerationReject = "reject"
+)
+
+type ReportStore interface {
+	CreateReport(Report) (*Report, error)
+	GetReportByID(id int) (*Report, error)
+	GetReportsByStatus(status string, afterID, limit int) ([]Report, error)
+	ResolveReport(id, resolvedBy int, action string) error
+}
+
+// Report flags a message, or a user, to the moderators of the instance. The
+// content of a reported message is kept as it was when reported, it may have
+// been edited or deleted since.
+type Report struct {
+	ID             int            `json:"id"`
+	ReporterID     int            `json:"reporterId"`
+	ReportedUserID sql.NullInt64  `json:"reportedUserId"`
+	MessageID      sql.NullInt64  `json:"messageId"`
+	ConversationID sql.NullInt64  `json:"conversationId"`
+	Reason         string         `json:"reason"`
+	Content        sql.NullString `json:"content"`
+	Status         string         `json:"status"`
+	Action         sql.NullString `json:"action"`
+	ResolvedBy     sql.NullInt64  `json:"resolvedBy"`
+	ResolvedAt     sql.NullTime   `json:"resolvedAt"`
+	CreatedAt      time.Time      `json:"createdAt"`
+}
+
+const (
+	ReportOpen     = "open"
+	ReportResolved = "resolved"
+)
+
+const (
+	ReportActionDismiss       = "dismiss"
+	ReportActionDeleteMessage = "delete_message"
+	ReportActionSuspendUser   = "suspend_user"
+)
+
+type CreateReportPayload struct {
+	MessageID int    `json:"messageId" validate:"required_without=UserID,excluded_with=UserID"`
+	UserID    int    `json:"userId"`
+	Reason    string `json:"reason" validate:"required,max=500"`
+}
+
+type ResolveReportPayload struct {
+	Action string `json:"action" validate:"required,oneof=dismiss delete_message suspend_user"`
+}
+
+// PresenceChecker tells whether a user has a live connection to the API.
+type PresenceChecker interface {
+	IsOnline(userID int) bool
+}
+
+// NotificationProvider delivers notifications through one channel, such as
+// Web Push.
+type NotificationProvider interface {
+	Name() string
+	Notify(Notification) error
+}
+
+type Notification struct {
+	UserID         int    `json:"-"`
+	ConversationID int    `json:"conversationId"`
+	MessageID      int    `json:"messageId"`
+	Title          string `json:"title"`
+	Body           string `json:"body"`
+}
+
+type PushSubscriptionStore interface {
+	// SavePushSubscription registers the subscription, or updates it when
+	// the endpoint is known already.
+	SavePushSubscription(PushSubscription) error
+	GetPushSubscriptionsByUserID(userID int) ([]PushSubscription, error)
+	DeletePushSubscription(id int) error
+	DeletePushSubscriptionByEndpoint(userID int, endpoint string) error
+	DeleteExpiredPushSubscriptions(now time.Time) (int64, error)
+}
+
+type PushSubscription struct {
+	ID        int          `json:"id"`
+	UserID    int          `json:"userId"`
+	Endpoint  string       `json:"endpoint"`
+	P256dh    string       `json:"p256dh"`
+	Auth      string       `json:"auth"`
+	ExpiresAt sql.NullTime `json:"expiresAt"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+// PushSubscriptionPayload is what PushSubscription.toJSON() gives in the
+// browser.
+type PushSubscriptionPayload struct {
+	Endpoint string `json:"endpoint" validate:"required,url,max=700"`
+	// milliseconds since the epoch, null when the subscription does not expire
+	ExpirationTime *int64               `json:"expirationTime"`
+	Keys           PushSubscriptionKeys `json:"keys"`
+}
+
+type PushSubscriptionKeys struct {
+	P256dh string `json:"p256dh" validate:"required,base64rawurl,max=128"`
+	Auth   string `json:"auth" validate:"required,base64rawurl,max=64"`
+}
+
+type DeletePushSubscriptionPayload struct {
+	Endpoint string `json:"endpoint" validate:"required"`
+}
+
+// Mailer sends emails, with a plain text body and an HTML alternative.
+type Mailer interface {
+	Send(Email) error
+}
+
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type DigestStore interface {
+	// GetDigestSettings returns the default settings when the user never
+	// changed them.
+	GetDigestSettings(userID int) (*DigestSettings, error)
+	UpdateDigestFrequency(userID int, frequency string) error
+	// GetDueDigestRecipients lists the users receiving digests at the
+	// frequency whose last one was sent before the given time.
+	GetDueDigestRecipients(frequency string, sentBefore time.Time) ([]DigestRecipient, error)
+	// GetUnreadMessagesSince lists the newest unread messages of the user
+	// sent after the given time, in the conversations they did not mute.
+	GetUnreadMessagesSince(userID int, since time.Time, limit int) ([]DigestMessage, error)
+	MarkDigestSent(userID int, sentAt time.Time) error
+}
+
+// How often a user gets an email summing up the messages they missed.
+const (
+	DigestOff    = "off"
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+type DigestSettings struct {
+	UserID     int          `json:"userId"`
+	Frequency  string       `json:"frequency"`
+	LastSentAt sql.NullTime `json:"lastSentAt"`
+}
+
+type DigestRecipient struct {
+	UserID     int
+	Email      string
+	FirstName  string
+	LastSentAt sql.NullTime
+}
+
+type DigestMessage struct {
+	ID               int
+	ConversationID   int
+	ConversationName sql.NullString
+	SenderName       string
+	Content          string
+	Type             string
+	SentAt           time.Time
+}
+
+type UpdateDigestSettingsPayload struct {
+	Frequency string `json:"frequency" validate:"required,oneof=off hourly daily weekly"`
 }
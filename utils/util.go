@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -54,3 +56,24 @@ func GetTokenFromRequest(c *fiber.Ctx) string {
 
 	return ""
 }
+
+// RandomString returns a URL safe random string built from n random bytes.
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GetDeviceIDFromRequest returns the id a client uses to tell its devices
+// apart, so real-time echoes can skip the device a change came from. The id
+// is copied out of the request buffer, connections keep it past the handler.
+func GetDeviceIDFromRequest(c *fiber.Ctx) string {
+	if deviceID := c.Get("X-Device-ID"); deviceID != "" {
+		return strings.Clone(deviceID)
+	}
+
+	return strings.Clone(c.Query("deviceId"))
+}